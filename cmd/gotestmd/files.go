@@ -0,0 +1,95 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gotestmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// files saves the generated files or, in check mode, compares them with the files on disk and keeps the diffs of the stale ones
+type files struct {
+	check bool
+	log   *log.Logger
+	mu    sync.Mutex
+	diffs map[string]string
+}
+
+// save writes the source to the location, missing dirs are created. In check mode the file on disk is only compared with the source
+func (f *files) save(location, source string, perm os.FileMode) error {
+	if !f.check {
+		_ = os.MkdirAll(filepath.Dir(location), os.ModePerm)
+		if err := os.WriteFile(location, []byte(source), perm); err != nil {
+			return err
+		}
+		f.log.Printf("generated %v", location)
+		return nil
+	}
+	current, err := os.ReadFile(filepath.Clean(location))
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return err
+	}
+	if string(current) == source {
+		f.log.Printf("%v is up to date", location)
+		return nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(current)),
+		B:        difflib.SplitLines(source),
+		FromFile: location,
+		ToFile:   location + " (generated)",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	if missing {
+		diff = fmt.Sprintf("%v is missing\n%v", location, diff)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.diffs == nil {
+		f.diffs = map[string]string{}
+	}
+	f.diffs[location] = diff
+	return nil
+}
+
+// report prints the diffs of the stale files ordered by their locations. Returns an error if any file is stale
+func (f *files) report(w io.Writer) error {
+	if len(f.diffs) == 0 {
+		return nil
+	}
+	var locations []string
+	for location := range f.diffs {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	for _, location := range locations {
+		_, _ = fmt.Fprint(w, f.diffs[location])
+	}
+	return errors.Errorf("%v generated files are out of date, run gotestmd to regenerate them", len(locations))
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gotestmd
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
+)
+
+// addFlags adds the flags of the command to the set
+func addFlags(flags *pflag.FlagSet) {
+	addOutputFlags(flags)
+	addParserFlags(flags)
+	addGoFlags(flags)
+	addBashFlags(flags)
+	flags.SetNormalizeFunc(func(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+		// --jobs is the name of the same flag in make and other build tools
+		if name == "jobs" {
+			name = "workers"
+		}
+		return pflag.NormalizedName(name)
+	})
+}
+
+// addOutputFlags adds the flags that select what is generated and where it's written
+func addOutputFlags(flags *pflag.FlagSet) {
+	flags.BoolP("verbose", "v", false, "log found examples, the sections of their code blocks, their dependencies and generated files to stderr")
+	flags.BoolP("quiet", "q", false, "don't print the summary of the generated suites to stdout")
+	flags.Bool("keep-going", false, "continue generation if a suite can't be generated, all errors are reported at the end. "+
+		"By default the generation stops on the first suite that can't be generated")
+	flags.Bool("makefile", false, "generate a Makefile in the output dir with a target for each suite. "+
+		"Targets run bash scripts or the suites with go test, required suites are prerequisites. "+
+		"Golang suites additionally get suite.gen_test.go with TestGeneratedSuite function, that their targets run")
+	flags.Bool("incremental", false, "regenerate only the suites whose markdown files or the files of their dependencies "+
+		"changed since the previous generation, the hashes are kept in "+generator.ManifestFile+" of the output dir. "+
+		"All the suites are regenerated if the manifest is missing or gotestmd version or options changed")
+	flags.Bool("check-generated", false, "don't write the generated files, compare them with the files on disk instead. "+
+		"Prints a unified diff of each stale or missing file and fails if any, e.g. to check in CI that committed files are up to date")
+	flags.Bool("sources", false, "additionally write "+generator.SourcesFile+" to the output dir, that maps the generated suites "+
+		"and tests to the markdown files and the lines of their commands, e.g. for failure triage")
+	flags.Int("workers", 1, "number of dirs that are parsed and suites that are generated in parallel. "+
+		"Generated files and reported errors don't depend on it. Bash scripts are always generated sequentially. --jobs is an alias")
+	flags.StringArray("var", nil, "key=value variable substituted for {{gotestmd:key}} placeholders of the commands "+
+		"at generation time, so the value is fixed in generated code unlike shell variables like ${KEY}, that are expanded when the commands run. Can be repeated")
+	flags.String("dirs", "", "how dirs of the examples are referenced in generated code: absolute or relative. "+
+		"By default golang tests use dirs as they are passed to gotestmd and bash scripts use absolute dirs")
+	flags.String("dirs-base", "", "base dir of the relative dirs of bash scripts for --dirs=relative. Defaults to the root of the go module. "+
+		"Golang tests resolve relative dirs against the root of the go module, so their dirs are always relative to it")
+	flags.String("env-file", "", "env file loaded by the examples that don't declare envFile in the front matter")
+	flags.String("env-file-missing", "fail", "what to do if an env file doesn't exist at runtime: fail or warn")
+	flags.Bool("dot", false, "print the graph of the examples in Graphviz DOT format instead of generating the suites: "+
+		"the nodes are the dirs of the examples, solid edges go to the required examples and dashed edges to the included ones. "+
+		"The output-dir arg is optional, nothing is written")
+	flags.Bool("report-orphans", false, "log a warning for each orphaned example: an example in a nested subdir of the input dir "+
+		"that doesn't include or require other examples and is not reachable by includes and requires from the examples that do, "+
+		"the examples of the input dir and its direct subdirs")
+	flags.Bool("fail-on-orphans", false, "fail the generation if an example is not included or required like with --report-orphans")
+	flags.Bool("list", false, "print the suites that would be generated instead of generating them: "+
+		"one tab separated record per line for each suite, its tests and the suites it requires and includes. "+
+		"The output-dir arg is optional, nothing is written")
+	flags.String("out", "", "output dir for generated suites. Mirrors the input dir structure. Replaces output-dir arg")
+}
+
+// addParserFlags adds the flags that change how the markdown files are read
+func addParserFlags(flags *pflag.FlagSet) {
+	flags.String("shell", parser.ShellBash, "shell of the examples that don't declare it in the front matter: bash or powershell")
+	flags.Bool("scenarios", false, "split examples into scenarios by level 2 headings that have own Run or Cleanup sections. "+
+		"Each scenario becomes a separate test")
+	flags.StringToString("sections", nil, "comma separated list of heading=kind pairs, where kind is run, cleanup, assert, verify, includes, requires or ignore. "+
+		"Contents of all the headings of a kind are concatenated in the order of the file, e.g. --sections=Start=run,Check=assert. "+
+		"Overrides the sections of the config file")
+	flags.String("config", "", "yaml or json config file, sections maps the headings to the sections like --sections flag")
+	flags.Bool("strict", false, "fail if a code block with commands is not under a Run, Cleanup, Assert or Verify heading, "+
+		"e.g. because of a typo in the heading, instead of dropping its commands silently")
+	flags.Bool("indented-blocks", false, "read the code blocks indented with 4 spaces or a tab as the blocks "+
+		"of the shell of the example, e.g. bash. The blocks must be separated by blank lines and not continue list items. "+
+		"By default they are not run")
+	flags.Bool("no-cache", false, "don't cache the parsed files in "+parser.CacheFile+" of the output dir. By default the files "+
+		"that didn't change since the previous generation with the same build of gotestmd are taken from the cache instead of being parsed again")
+	flags.StringArray("snippets", nil, "markdown file with the snippets shared by the examples: code blocks that begin "+
+		"with # gotestmd:snippet <name> line. A # gotestmd:include-snippet <name> line of a code block is replaced with the commands of the snippet. Can be repeated")
+	flags.Bool("split-commands", false, "run each command line of bash code blocks as a separate command instead of the whole block, "+
+		"so a failure points to the command. Multi-line commands, e.g. continued with \\, heredocs or if/fi, stay together. "+
+		"Blocks with the expected output, stdin or other checks of the whole block are not split")
+	flags.Bool("strip-comments", false, "remove blank and comment lines from bash code blocks, so they are not run as commands. "+
+		"Lines of heredocs and multi-line strings are kept, blocks that have only comments are not run at all")
+}
+
+// addGoFlags adds the flags of generated golang tests
+func addGoFlags(flags *pflag.FlagSet) {
+	flags.Bool("log-commands", false, "log each command of generated golang tests with s.T().Log before it runs, "+
+		"so the test log shows the sequence of the commands even if the runner doesn't log them. Does not affect bash scripts")
+	flags.Duration("command-timeout", 0, "timeout for a single run of a command in generated golang tests. Zero means no timeout")
+	flags.Bool("require-no-error", false, "check each command of generated golang tests with require.NoError, "+
+		"so the failed command is shown in the assertion message")
+	flags.Bool("shared-session", false, "run the commands of each generated golang suite and its tests in a single shell session, "+
+		"so exported variables and the current dir are kept. Each test changes the dir to its example. Doesn't affect bash scripts and standalone programs")
+	flags.StringSlice("env-inherit", nil, "comma separated list of the env variables inherited by the runners of generated golang tests. "+
+		"Other variables are not inherited, if the flag is set")
+	flags.Bool("standalone-tests", false, "additionally generate a top-level test function for each test of a suite, "+
+		"so the tests can be run with go test -run. Each function sets up the suite on its own")
+	flags.Bool("main", false, "additionally generate a standalone program for each suite in main dir of the suite. "+
+		"The program runs the suite like go test and exits with non-zero code if it fails")
+	flags.String("suite-type", "Suite", "name of the generated suite types, * is replaced with the title-cased package name, "+
+		"e.g. *Suite gives FooSuite for foo package")
+	flags.String("unsafe-commands", generator.UnsafeEscape, "what to do with the commands with characters that can't be "+
+		"written to go raw strings, e.g. backticks or control characters: escape writes such lines to interpreted string literals, "+
+		"reject fails the generation of golang code with the file and the lines of the command")
+	flags.Bool("qualified-names", false, "import the suites with the same package name from different dirs, "+
+		"e.g. one/basic and two/basic, by their paths: one_basic and two_basic. By default such imports fail the generation of the suite")
+	flags.Bool("flatten", false, "run the setup of the required and included suites inline in the setup of each suite "+
+		"instead of nested suites, the tests of the included suites become tests of the suite. Can be used only with testify suites")
+	flags.Bool("single-file", false, "generate all golang suites into "+generator.SingleFileName+" of the output dir "+
+		"instead of a package per dir. The types of the suites are named by their dirs, e.g. ProducerConsumerSuite, and the suites "+
+		"embed the required and included suites as the types of the same file")
+	flags.String("format", generator.FormatTestify, "format of generated golang tests: testify suites or ginkgo specs. "+
+		"Ginkgo specs can't be used with --bash and --standalone-tests")
+}
+
+// addBashFlags adds the flags of generated bash scripts
+func addBashFlags(flags *pflag.FlagSet) {
+	flags.Bool("bash", false, "generates bash scripts for tests. Can be used only with --match flag")
+	flags.String("match", "", "regex for matching suite or test name. Can be used only with --bash flag")
+	flags.Bool("retry", false, "add retry to commands in generated bash scripts. Does not affect golang tests")
+	flags.Bool("timing", false, "echo each command and its duration in generated bash scripts. Does not affect golang tests")
+	flags.Int("retry-max-attempts", 0, "default number of attempts of the retried commands in generated bash scripts, "+
+		"can be overridden with RETRY_MAX_ATTEMPTS env. Zero means no limit, RETRY_TIMEOUT_SECONDS is always the other bound")
+	flags.Duration("retry-jitter", 0, "default maximum random delay added to the 1s interval between the retries "+
+		"in generated bash scripts, so the retries of parallel scripts are spread out. Can be overridden with RETRY_JITTER_MS env, "+
+		"RETRY_JITTER_SEED env makes the delays reproducible")
+	flags.Duration("retry-timeout", 5*time.Minute, "default timeout of the retried commands in generated bash scripts, "+
+		"can be overridden with RETRY_TIMEOUT_SECONDS env. A suite can set own timeout with # gotestmd:retry-timeout <seconds> line of its markdown")
+	flags.Bool("persist-env", false, "save the variables exported by the setup of generated bash scripts to the state dir "+
+		"and restore them for the other targets, so the targets can be run separately, e.g. setup and then a test. "+
+		"Without it a warning is logged for each exported variable used by other targets")
+}
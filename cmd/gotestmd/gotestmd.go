@@ -18,101 +18,456 @@
 package gotestmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/networkservicemesh/gotestmd/internal/config"
-	"github.com/networkservicemesh/gotestmd/internal/generator"
 	"github.com/networkservicemesh/gotestmd/internal/linker"
 	"github.com/networkservicemesh/gotestmd/internal/parser"
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
 )
 
+// suiteTypeRegex matches valid --suite-type values, * is replaced with a package name that is a valid identifier
+var suiteTypeRegex = regexp.MustCompile(`^[A-Za-z_*][A-Za-z0-9_*]*$`)
+
+// Option is an option of the command
+type Option func(o *options)
+
+type options struct {
+	transforms []generator.Transform
+}
+
+// WithTransform adds a function that rewrites each command before it's written to generated golang tests, bash scripts and
+// standalone programs, e.g. to add a flag to every invocation of a tool. Transforms are applied in the order they are added,
+// after --var values and before {{matrix:name}} placeholders are substituted, shell variables are expanded later when the commands run.
+// --incremental doesn't track changes of the transforms, regenerate all the suites if a transform changes
+func WithTransform(transform func(cmd string) string) Option {
+	return func(o *options) {
+		o.transforms = append(o.transforms, transform)
+	}
+}
+
 // New creates new cmd/gotestmd
-func New() *cobra.Command {
+func New(opts ...Option) *cobra.Command {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 	gotestmdCmd := &cobra.Command{
 		Use:     "gotestmd",
 		Short:   "Command for generating integration tests",
 		Version: "0.0.1",
+		// the args are the dirs of the examples, they are not the names of the subcommands
+		Args:              cobra.ArbitraryArgs,
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
 
 		RunE: func(cmd *cobra.Command, args []string) error {
-			match := cmd.Flag("match").Value.String()
-			bash := false
-			if value, err := cmd.Flags().GetBool("bash"); err == nil {
-				bash = value
-			}
-			retry := false
-			if value, err := cmd.Flags().GetBool("retry"); err == nil {
-				retry = value
+			rc, err := newRunConfig(cmd, args)
+			if err != nil {
+				return err
 			}
+			return run(cmd, rc, &o)
+		},
+	}
+	addFlags(gotestmdCmd.Flags())
+	gotestmdCmd.AddCommand(newInitCommand())
 
-			if bash && match == "" {
-				return errors.New("Flag --bash can be used only with flag --match")
-			}
+	return gotestmdCmd
+}
 
-			c := config.FromArgs(args)
-			c.Bash = bash
-			c.Match = match
-			_ = os.MkdirAll(c.OutputDir, os.ModePerm)
-			var examples []*parser.Example
-
-			var p = parser.New()
-			var l = linker.New(c.InputDir)
-			var g = generator.New(c)
-			dirs := getRecursiveDirectories(c.InputDir)
-			for _, dir := range dirs {
-				ex, err := p.ParseFile(path.Join(dir, "README.md"))
-				if err == nil {
-					examples = append(examples, ex)
-				}
-			}
-			linkedExamples, err := l.Link(examples...)
-			if err != nil {
-				return errors.Errorf("cannot build examples: %v", err.Error())
-			}
+// run parses the examples and generates the suites of the parsed ones. With --keep-going the examples that can't be parsed
+// are skipped and reported at the end
+func run(cmd *cobra.Command, rc *runConfig, o *options) error {
+	if rc.writes() {
+		_ = os.MkdirAll(rc.OutputDir, os.ModePerm)
+	}
+	examples, failed, err := parseExamples(rc)
+	if err != nil {
+		return err
+	}
+	err = generate(cmd, rc, o, examples)
+	if failed == 0 {
+		return err
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %v examples", failed)
+	}
+	return errors.Errorf("failed to parse %v examples", failed)
+}
 
-			suites := g.Generate(linkedExamples...)
+// generate links the examples and writes the generated suites, or prints their list or graph
+func generate(cmd *cobra.Command, rc *runConfig, o *options, examples []*parser.Example) error {
+	linkedExamples, err := linker.New(rc.InputDir).Link(examples...)
+	if err != nil {
+		return errors.Errorf("cannot build examples: %v", err.Error())
+	}
+	if err := checkOrphans(cmd, linkedExamples); err != nil {
+		return err
+	}
+	if rc.dot {
+		_, _ = fmt.Fprint(cmd.OutOrStdout(), linker.Dot(linkedExamples))
+		return nil
+	}
+	logLinked(rc.log, linkedExamples)
 
-			if !bash {
-				return processGoSuites(suites)
-			}
+	var generatorOptions []generator.Option
+	for _, t := range o.transforms {
+		generatorOptions = append(generatorOptions, generator.WithTransform(t))
+	}
+	suites := generator.New(rc.Config, generatorOptions...).Generate(linkedExamples...)
+	if err := generator.CheckLocations(suites); err != nil {
+		return err
+	}
+	if rc.list {
+		_, _ = fmt.Fprint(cmd.OutOrStdout(), generator.List(suites))
+		return nil
+	}
+	// bash scripts have no raw strings, the commands are written as is
+	if rc.unsafeCommands == generator.UnsafeReject && !rc.Bash {
+		if err := generator.CheckCommands(suites); err != nil {
+			return err
+		}
+	}
+	return writeSuites(cmd, rc, suites)
+}
 
-			matchRegex, err := regexp.Compile(match)
-			if err != nil {
-				return err
-			}
+// parseExamples parses README.md files of the input dir and its subdirs, the cache is saved if the files are written.
+// With --keep-going the files that can't be parsed are skipped, their errors are logged and failed is their count
+func parseExamples(rc *runConfig) (examples []*parser.Example, failed int, err error) {
+	p := parser.New(rc.parserOptions...)
+	dirs := getRecursiveDirectories(rc.InputDir)
+	parsed := make([]*parser.Example, len(dirs))
+	parseErrs := forEach(rc.workers, len(dirs), func(i int) error {
+		ex, err := p.ParseFile(path.Join(dirs[i], "README.md"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot parse %v", dirs[i])
+		}
+		parsed[i] = ex
+		return nil
+	})
+	errs := &errorCollector{keepGoing: rc.keepGoing}
+	for i, dir := range dirs {
+		if err := errs.collect(parseErrs[i]); err != nil {
+			return nil, 0, err
+		}
+		if parsed[i] == nil {
+			continue
+		}
+		logExample(rc.log, path.Join(dir, "README.md"), parsed[i])
+		examples = append(examples, parsed[i])
+	}
+	if rc.cache != nil && rc.writes() {
+		if err := rc.cache.Save(filepath.Join(rc.OutputDir, parser.CacheFile)); err != nil {
+			return nil, 0, err
+		}
+	}
+	return examples, errs.count, nil
+}
 
-			return processBashSuites(suites, matchRegex, retry)
-		},
+// writeSuites writes the files of the suites and the files of the whole generation: Makefile, source map and manifest.
+// In check mode the files are compared with the files on disk instead
+func writeSuites(cmd *cobra.Command, rc *runConfig, suites []*generator.Suite) error {
+	out := &files{check: rc.checkGenerated, log: rc.log}
+	var sources string
+	if rc.withSources {
+		sources = generator.Sources(suites)
+	}
+	written := suites
+	var manifest *generator.Manifest
+	if rc.incremental {
+		var err error
+		if written, manifest, err = staleSuites(cmd, rc, suites); err != nil {
+			return err
+		}
+	}
+	written, err := renderSuites(out, rc, suites, written)
+	if err != nil {
+		return err
 	}
 
-	gotestmdCmd.Flags().Bool("bash", false, "generates bash scripts for tests. Can be used only with --match flag")
-	gotestmdCmd.Flags().String("match", "", "regex for matching suite or test name. Can be used only with --bash flag")
-	gotestmdCmd.Flags().Bool("retry", false, "add retry to commands in generated bash scripts. Does not affect golang tests")
+	if rc.makefile {
+		// golang suites are run by the targets of all the suites, bash scripts only by the targets of the written ones
+		targets := suites
+		if rc.Bash {
+			targets = written
+		}
+		if err := writeMakefile(out, rc.OutputDir, targets, rc.Bash); err != nil {
+			return err
+		}
+	}
+	if rc.withSources {
+		if err := out.save(filepath.Join(rc.OutputDir, generator.SourcesFile), sources, 0o600); err != nil {
+			return errors.Errorf("cannot save source map: %v", err.Error())
+		}
+	}
+	if rc.checkGenerated {
+		return out.report(cmd.OutOrStdout())
+	}
+	if manifest != nil {
+		if err := manifest.Save(filepath.Join(rc.OutputDir, generator.ManifestFile)); err != nil {
+			return err
+		}
+	}
+	if !rc.quiet {
+		summary := generator.Summarize(written)
+		if manifest != nil {
+			summary.Unchanged = len(manifest.Suites) - len(written)
+		}
+		_, _ = fmt.Fprint(cmd.OutOrStdout(), summary)
+	}
+	return nil
+}
 
-	return gotestmdCmd
+// renderSuites writes bash scripts of the suites matching --match or golang files of the stale suites. Returns the written suites
+func renderSuites(out *files, rc *runConfig, suites, stale []*generator.Suite) ([]*generator.Suite, error) {
+	if rc.Bash {
+		matchRegex, err := regexp.Compile(rc.Match)
+		if err != nil {
+			return nil, err
+		}
+		return processBashSuites(out, suites, matchRegex, rc.retry, rc.keepGoing)
+	}
+	if rc.SingleFile {
+		files, err := generator.Render(stale)
+		if err != nil {
+			return nil, err
+		}
+		return stale, writeFiles(out, files)
+	}
+	renderOptions := []generator.RenderOption{generator.WithFormat(rc.format)}
+	if rc.makefile {
+		renderOptions = append(renderOptions, generator.WithSuiteTest())
+	}
+	if rc.standalone {
+		renderOptions = append(renderOptions, generator.WithStandaloneTests())
+	}
+	if rc.withMain {
+		renderOptions = append(renderOptions, generator.WithMain())
+	}
+	return stale, processGoSuites(out, stale, renderOptions, rc.workers, rc.keepGoing)
+}
+
+// getVars returns the variables of --var flags by their names
+func getVars(flags *pflag.FlagSet) (map[string]string, error) {
+	values, err := flags.GetStringArray("var")
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, errors.Errorf("invalid --var value: %v, expected key=value", v)
+		}
+		result[name] = value
+	}
+	return result, nil
 }
 
-func processGoSuites(suites []*generator.Suite) error {
+// getSections returns the sections of the config file overridden by --sections flag. Returns nil if the sections are not configured
+func getSections(cmd *cobra.Command) (map[string]string, error) {
+	var result map[string]string
+	if configFile := cmd.Flag("config").Value.String(); configFile != "" {
+		f, err := config.LoadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		result = f.Sections
+	}
+	if cmd.Flags().Changed("sections") {
+		sections, err := cmd.Flags().GetStringToString("sections")
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = map[string]string{}
+		}
+		for title, kind := range sections {
+			result[title] = kind
+		}
+	}
+	for title, kind := range result {
+		if !parser.IsSectionKind(kind) {
+			return nil, errors.Errorf("unknown section of %v heading: %v", title, kind)
+		}
+	}
+	return result, nil
+}
+
+// staleSuites returns the suites that should be regenerated and the manifest of all the suites. All the suites are stale
+// if the manifest of the previous generation is missing or it was generated by another version or with other options
+func staleSuites(cmd *cobra.Command, rc *runConfig, suites []*generator.Suite) ([]*generator.Suite, *generator.Manifest, error) {
+	options, err := optionsHash(cmd, rc.args)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := &generator.Manifest{Version: cmd.Version, Options: options, Suites: map[string]string{}}
+	previous, err := generator.LoadManifest(filepath.Join(rc.OutputDir, generator.ManifestFile))
+	switch {
+	case err != nil:
+		rc.log.Printf("all the suites are generated: %v", err)
+		previous = nil
+	case previous.Version != manifest.Version:
+		rc.log.Printf("all the suites are generated: the suites were generated by version %v", previous.Version)
+		previous = nil
+	case previous.Options != manifest.Options:
+		rc.log.Print("all the suites are generated: the suites were generated with other options")
+		previous = nil
+	}
+
+	var result []*generator.Suite
 	for _, suite := range suites {
-		dir, _ := filepath.Split(suite.Location)
-		_ = os.MkdirAll(dir, os.ModePerm)
-		err := os.WriteFile(suite.Location, []byte(suite.String()), os.ModePerm)
+		hash, err := suite.InputHash()
 		if err != nil {
-			return errors.Errorf("cannot save suite %v, : %v", suite.Name(), err.Error())
+			return nil, nil, err
+		}
+		manifest.Suites[suite.Location] = hash
+		if previous == nil || previous.Changed(suite, hash) {
+			result = append(result, suite)
+			continue
+		}
+		rc.log.Printf("%v is unchanged", suite.Location)
+	}
+	return result, manifest, nil
+}
+
+// checkOrphans logs a warning for each example that is not reachable from the targets with --report-orphans
+// and returns an error if there are such examples with --fail-on-orphans
+func checkOrphans(cmd *cobra.Command, examples []*linker.LinkedExample) error {
+	report, err := cmd.Flags().GetBool("report-orphans")
+	if err != nil {
+		return err
+	}
+	fail, err := cmd.Flags().GetBool("fail-on-orphans")
+	if err != nil {
+		return err
+	}
+	if !report && !fail {
+		return nil
+	}
+	orphans := linker.Orphans(examples)
+	for _, e := range orphans {
+		logrus.Warnf("example %v is not included or required by any example", e.Dir)
+	}
+	if fail && len(orphans) > 0 {
+		return errors.Errorf("%v examples are not included or required by any example", len(orphans))
+	}
+	return nil
+}
+
+// optionsHash returns a hash of the args and the flags that affect generated files, including the content of the config file
+// and the snippets files
+func optionsHash(cmd *cobra.Command, args []string) (string, error) {
+	h := sha256.New()
+	for _, arg := range args {
+		_, _ = fmt.Fprintf(h, "%v\n", arg)
+	}
+	ignored := map[string]bool{"incremental": true, "verbose": true, "quiet": true, "workers": true, "no-cache": true}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if !ignored[f.Name] {
+			_, _ = fmt.Fprintf(h, "--%v=%v\n", f.Name, f.Value.String())
+		}
+	})
+	if path := cmd.Flag("config").Value.String(); path != "" {
+		source, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot read config file %v", path)
+		}
+		_, _ = h.Write(source)
+	}
+	snippetFiles, err := cmd.Flags().GetStringArray("snippets")
+	if err != nil {
+		return "", err
+	}
+	for _, path := range snippetFiles {
+		source, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot read snippets %v", path)
+		}
+		_, _ = h.Write(source)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// processGoSuites renders the golang files of each suite and writes them
+func processGoSuites(out *files, suites []*generator.Suite, options []generator.RenderOption, workers int, keepGoing bool) error {
+	return collectErrors(keepGoing, forEach(workers, len(suites), func(i int) error {
+		sources, err := suites[i].Files(options...)
+		if err != nil {
+			return err
+		}
+		return writeFiles(out, sources)
+	}))
+}
+
+// writeFiles saves the rendered files ordered by their locations
+func writeFiles(out *files, sources map[string][]byte) error {
+	var locations []string
+	for location := range sources {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	for _, location := range locations {
+		if err := writeFile(out, location, string(sources[location])); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// writeFile saves the generated file, missing dirs are created
+func writeFile(out *files, location, source string) error {
+	if err := out.save(location, source, os.ModePerm); err != nil {
+		return errors.Errorf("cannot save %v: %v", location, err.Error())
+	}
 	return nil
 }
 
-func processBashSuites(suites []*generator.Suite, matchRegex *regexp.Regexp, retry bool) error {
+// processBashSuites writes bash scripts of the suites matching the regex or having matching tests. Returns written suites
+func processBashSuites(out *files, suites []*generator.Suite, matchRegex *regexp.Regexp, retry, keepGoing bool) ([]*generator.Suite, error) {
 	matchFound := false
+	errs := &errorCollector{keepGoing: keepGoing}
+	var written []*generator.Suite
+	warned := map[string]bool{}
+	writeBashSuite := func(suite *generator.Suite) error {
+		if err := checkBashShell(suite); err != nil {
+			return err
+		}
+		if err := writeSuite(out, suite, func() (string, error) {
+			return suite.BashSource(retry)
+		}); err != nil {
+			return err
+		}
+		// a suite is written again with its matching tests, the warnings of the previous script are not repeated
+		for _, warning := range suite.BashWarnings() {
+			if !warned[warning] {
+				warned[warning] = true
+				logrus.Warn(warning)
+			}
+		}
+		for _, w := range written {
+			if w == suite {
+				return nil
+			}
+		}
+		written = append(written, suite)
+		return nil
+	}
 
 	for _, suite := range suites {
 		if !matchRegex.MatchString(suite.Name()) {
@@ -120,11 +475,8 @@ func processBashSuites(suites []*generator.Suite, matchRegex *regexp.Regexp, ret
 		}
 		matchFound = true
 		suite.Tests = nil
-		dir, _ := filepath.Split(suite.Location)
-		_ = os.MkdirAll(dir, os.ModePerm)
-		err := os.WriteFile(suite.Location, []byte(suite.BashString(retry)), os.ModePerm)
-		if err != nil {
-			return errors.Errorf("cannot save suite %v, : %v", suite.Name(), err.Error())
+		if err := errs.collect(writeBashSuite(suite)); err != nil {
+			return nil, err
 		}
 	}
 
@@ -141,21 +493,88 @@ func processBashSuites(suites []*generator.Suite, matchRegex *regexp.Regexp, ret
 		}
 
 		suite.Tests = matchedTests
-		dir, _ := filepath.Split(suite.Location)
-		_ = os.MkdirAll(dir, os.ModePerm)
-		err := os.WriteFile(suite.Location, []byte(suite.BashString(retry)), os.ModePerm)
-		if err != nil {
-			return errors.Errorf("cannot save suite %v, : %v", suite.Name(), err.Error())
+		if err := errs.collect(writeBashSuite(suite)); err != nil {
+			return nil, err
 		}
 	}
 
 	if !matchFound {
-		return errors.Errorf("No matches found for pattern: %s", matchRegex.String())
+		return nil, errors.Errorf("No matches found for pattern: %s", matchRegex.String())
 	}
 
+	return written, errs.err()
+}
+
+// checkBashShell returns an error if the suite or its tests are not written for bash
+func checkBashShell(suite *generator.Suite) error {
+	shells := []string{suite.Shell}
+	for _, test := range suite.Tests {
+		shells = append(shells, test.Shell)
+	}
+	for _, shell := range shells {
+		if shell != parser.ShellBash {
+			return errors.Errorf("failed to generate suite for %v: bash script can't be generated for %v examples", suite.Dir, shell)
+		}
+	}
 	return nil
 }
 
+// writeSuite renders the suite and saves it
+func writeSuite(out *files, suite *generator.Suite, render func() (string, error)) error {
+	source, err := render()
+	if err != nil {
+		return err
+	}
+	if err := out.save(suite.Location, source, os.ModePerm); err != nil {
+		return errors.Errorf("cannot save suite %v, : %v", suite.Name(), err.Error())
+	}
+
+	return nil
+}
+
+// writeMakefile saves a Makefile with a target for each suite to the output dir
+func writeMakefile(out *files, outputDir string, suites []*generator.Suite, bash bool) error {
+	location := filepath.Join(outputDir, "Makefile")
+	if err := out.save(location, generator.Makefile(outputDir, suites, bash), 0o600); err != nil {
+		return errors.Errorf("cannot save Makefile: %v", err.Error())
+	}
+
+	return nil
+}
+
+// errorCollector returns the first error or, if keepGoing is set, logs and counts errors to report them at the end
+type errorCollector struct {
+	keepGoing bool
+	count     int
+}
+
+func (c *errorCollector) collect(err error) error {
+	if err == nil || !c.keepGoing {
+		return err
+	}
+	logrus.Error(err.Error())
+	c.count++
+	return nil
+}
+
+// collectErrors returns the first of the errors or, if keepGoing is set, logs all of them and reports their count
+func collectErrors(keepGoing bool, errs []error) error {
+	c := &errorCollector{keepGoing: keepGoing}
+	for _, err := range errs {
+		if err := c.collect(err); err != nil {
+			return err
+		}
+	}
+	return c.err()
+}
+
+func (c *errorCollector) err() error {
+	if c.count == 0 {
+		return nil
+	}
+	return errors.Errorf("failed to generate %v suites", c.count)
+}
+
 func getFilter(root string) func(string) bool {
 	var ignored []string
 	ignored = append(ignored, filepath.Join(root, ".git"))
@@ -0,0 +1,153 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gotestmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// initReadmeTemplate is the default README.md of the examples created by init, it has the sections that gotestmd reads
+const initReadmeTemplate = "# {{ .Title }}\n\n" +
+	"Describe what this example shows. gotestmd generates a test from the bash code blocks of the sections below.\n\n" +
+	"## Requires\n\n" +
+	"List the links to the examples that must be set up before this one, e.g. a cluster.\n\n" +
+	"## Run\n\n" +
+	"```bash\necho \"hello from {{ .Title }}\"\n```\n\n" +
+	"The output of the command is checked:\n\n" +
+	"```output\nhello from {{ .Title }}\n```\n\n" +
+	"## Cleanup\n\n" +
+	"```bash\necho \"cleanup {{ .Title }}\"\n```\n"
+
+// initGoVersion is the go directive of the go.mod created by init
+const initGoVersion = "1.20"
+
+// packageNameRegex matches the characters that are replaced with _ in the package name created by init, like in the names
+// of generated packages
+var packageNameRegex = regexp.MustCompile(`[^a-z0-9_]`)
+
+// newInitCommand creates the command that creates a starter example
+func newInitCommand() *cobra.Command {
+	initCmd := &cobra.Command{
+		Use:   "init <dir>",
+		Short: "Create a starter example in the dir",
+		Long: "Create a starter example in the dir: README.md with Requires, Run and Cleanup sections and a sample command. " +
+			"If the dir is not in a go module, go.mod and gen.go with go:generate directive that generates the tests into ./tests are created too. " +
+			"Existing files are not changed",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source := initReadmeTemplate
+			if path := cmd.Flag("template").Value.String(); path != "" {
+				bytes, err := os.ReadFile(filepath.Clean(path))
+				if err != nil {
+					return errors.Wrap(err, "cannot read template")
+				}
+				source = string(bytes)
+			}
+			return initExample(cmd.OutOrStdout(), args[0], source)
+		},
+	}
+	initCmd.Flags().String("template", "", "text/template file of README.md used instead of the default one, "+
+		"{{ .Title }} is the name of the dir and {{ .Package }} is the name of the package of the example")
+	return initCmd
+}
+
+// initExample creates the files of a starter example in the dir and prints their paths to w. README.md is rendered
+// from the template source. Existing files are skipped with a warning
+func initExample(w io.Writer, dir, source string) error {
+	tmpl, err := template.New("README.md").Parse(source)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse template")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Title   string
+		Package string
+	}{
+		Title:   filepath.Base(abs),
+		Package: packageName(filepath.Base(abs)),
+	}
+	var readme strings.Builder
+	if err := tmpl.Execute(&readme, data); err != nil {
+		return errors.Wrap(err, "cannot render template")
+	}
+
+	type file struct {
+		name   string
+		source string
+	}
+	result := []file{{name: "README.md", source: readme.String()}}
+	// the dir becomes the root of a new module, so the tests are generated and run from it
+	if !inModule(abs) {
+		result = append(result,
+			file{name: "go.mod", source: fmt.Sprintf("module %v\n\ngo %v\n", data.Package, initGoVersion)},
+			file{name: "gen.go", source: fmt.Sprintf("// Package %[1]v contains the examples that gotestmd generates tests from.\n"+
+				"// Run go generate ./... and go mod tidy, then go test ./tests/...\npackage %[1]v\n\n"+
+				"//go:generate gotestmd . ./tests --makefile\n", data.Package)})
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, f := range result {
+		path := filepath.Join(dir, f.name)
+		if _, err := os.Stat(path); err == nil {
+			logrus.Warnf("%v already exists, it's not changed", path)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(f.source), os.ModePerm); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "created %v\n", path)
+	}
+	return nil
+}
+
+// inModule returns true if the dir or one of its parents has go.mod
+func inModule(dir string) bool {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// packageName returns the name of the dir as a name of a go package
+func packageName(name string) string {
+	result := packageNameRegex.ReplaceAllString(strings.ToLower(name), "_")
+	if result == "" || result[0] >= '0' && result[0] <= '9' {
+		result = "examples_" + result
+	}
+	return result
+}
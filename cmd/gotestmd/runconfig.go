@@ -0,0 +1,358 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gotestmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/networkservicemesh/gotestmd/internal/config"
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
+)
+
+// runConfig is the configuration of a generation built from the args and the flags of the command
+type runConfig struct {
+	config.Config
+	// args are the args of the command with the output dir of --out and the default output dir of --list and --dot
+	args []string
+	log  *log.Logger
+
+	list, dot, quiet bool
+	retry            bool
+	checkGenerated   bool
+	incremental      bool
+	keepGoing        bool
+	makefile         bool
+	standalone       bool
+	withMain         bool
+	withSources      bool
+	workers          int
+	format           string
+	unsafeCommands   string
+	parserOptions    []parser.Option
+	cache            *parser.Cache
+}
+
+// newRunConfig builds the configuration of a generation from the args and the flags of the command
+func newRunConfig(cmd *cobra.Command, args []string) (*runConfig, error) {
+	flags := cmd.Flags()
+	verbose, err := flags.GetBool("verbose")
+	if err != nil {
+		return nil, err
+	}
+	rc := &runConfig{log: newLogger(cmd.ErrOrStderr(), verbose)}
+	if err := boolFlags(flags, map[string]*bool{"list": &rc.list, "dot": &rc.dot}); err != nil {
+		return nil, err
+	}
+	if rc.args, err = rc.outputArgs(flags, args); err != nil {
+		return nil, err
+	}
+	rc.Config = config.FromArgs(rc.args)
+
+	for _, read := range []func(*pflag.FlagSet) error{
+		rc.readBashFlags,
+		rc.readOutputFlags,
+		rc.readGoFlags,
+		rc.readFormatFlags,
+		rc.readIncrementalFlags,
+	} {
+		if err := read(flags); err != nil {
+			return nil, err
+		}
+	}
+	if err := rc.readParserFlags(cmd); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// outputArgs returns the args with the output dir of --out, the output dir is optional for --list and --dot
+func (rc *runConfig) outputArgs(flags *pflag.FlagSet, args []string) ([]string, error) {
+	if rc.list && rc.dot {
+		return nil, errors.New("flag --list can't be used with flag --dot")
+	}
+	out := flags.Lookup("out").Value.String()
+	// the output dir only affects the package paths of the listed suites
+	if (rc.list || rc.dot) && len(args) == 1 && out == "" {
+		args = append(args, args[0])
+	}
+	if out != "" {
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errors.New("flag --out can be used only with args: (string)input-dir (string)base-pkg[optional]")
+		}
+		args = append([]string{args[0], out}, args[1:]...)
+	}
+	return args, nil
+}
+
+// readBashFlags reads the flags of generated bash scripts
+func (rc *runConfig) readBashFlags(flags *pflag.FlagSet) error {
+	err := boolFlags(flags, map[string]*bool{"bash": &rc.Bash, "retry": &rc.retry, "timing": &rc.Timing, "persist-env": &rc.PersistEnv})
+	if err != nil {
+		return err
+	}
+	rc.Match = flags.Lookup("match").Value.String()
+	if rc.Bash && rc.Match == "" {
+		return errors.New("flag --bash can be used only with flag --match")
+	}
+	if rc.RetryMaxAttempts, err = flags.GetInt("retry-max-attempts"); err != nil {
+		return err
+	}
+	if rc.RetryMaxAttempts < 0 {
+		return errors.New("flag --retry-max-attempts can't be negative")
+	}
+	if rc.RetryJitter, err = flags.GetDuration("retry-jitter"); err != nil {
+		return err
+	}
+	if rc.RetryJitter < 0 {
+		return errors.New("flag --retry-jitter can't be negative")
+	}
+	if rc.RetryTimeout, err = flags.GetDuration("retry-timeout"); err != nil {
+		return err
+	}
+	// the timeout of generated scripts is a number of seconds
+	if rc.RetryTimeout < time.Second {
+		return errors.New("flag --retry-timeout can't be less than 1s")
+	}
+	return nil
+}
+
+// readOutputFlags reads the flags that select what is generated and where it's written
+func (rc *runConfig) readOutputFlags(flags *pflag.FlagSet) error {
+	err := boolFlags(flags, map[string]*bool{
+		"quiet":           &rc.quiet,
+		"check-generated": &rc.checkGenerated,
+		"makefile":        &rc.makefile,
+		"sources":         &rc.withSources,
+		"keep-going":      &rc.keepGoing,
+		"split-commands":  &rc.SplitCommands,
+		"strip-comments":  &rc.StripComments,
+	})
+	if err != nil {
+		return err
+	}
+	if rc.workers, err = flags.GetInt("workers"); err != nil {
+		return err
+	}
+	if rc.workers < 1 {
+		return errors.Errorf("--workers should be positive, got %v", rc.workers)
+	}
+	rc.Dirs = flags.Lookup("dirs").Value.String()
+	switch rc.Dirs {
+	case generator.DirsDefault, generator.DirsAbsolute, generator.DirsRelative:
+	default:
+		return errors.Errorf("unknown --dirs value: %v", rc.Dirs)
+	}
+	rc.DirsBase = flags.Lookup("dirs-base").Value.String()
+	rc.EnvFile = flags.Lookup("env-file").Value.String()
+	switch missing := flags.Lookup("env-file-missing").Value.String(); missing {
+	case "fail":
+	case "warn":
+		rc.EnvFileMissingOK = true
+	default:
+		return errors.Errorf("unknown --env-file-missing value: %v", missing)
+	}
+	rc.Vars, err = getVars(flags)
+	return err
+}
+
+// readGoFlags reads the flags of generated golang tests
+func (rc *runConfig) readGoFlags(flags *pflag.FlagSet) error {
+	err := boolFlags(flags, map[string]*bool{
+		"require-no-error": &rc.RequireNoError,
+		"shared-session":   &rc.SharedSession,
+		"log-commands":     &rc.LogCommands,
+		"qualified-names":  &rc.QualifiedNames,
+		"flatten":          &rc.Flatten,
+		"single-file":      &rc.SingleFile,
+		"standalone-tests": &rc.standalone,
+		"main":             &rc.withMain,
+	})
+	if err != nil {
+		return err
+	}
+	if rc.CommandTimeout, err = flags.GetDuration("command-timeout"); err != nil {
+		return err
+	}
+	if flags.Changed("env-inherit") {
+		rc.HermeticEnv = true
+		if rc.EnvInherit, err = flags.GetStringSlice("env-inherit"); err != nil {
+			return err
+		}
+	}
+	rc.SuiteType = flags.Lookup("suite-type").Value.String()
+	if !suiteTypeRegex.MatchString(rc.SuiteType) {
+		return errors.Errorf("invalid --suite-type value: %v", rc.SuiteType)
+	}
+	rc.unsafeCommands = flags.Lookup("unsafe-commands").Value.String()
+	switch rc.unsafeCommands {
+	case generator.UnsafeEscape, generator.UnsafeReject:
+	default:
+		return errors.Errorf("unknown --unsafe-commands value: %v", rc.unsafeCommands)
+	}
+	if rc.standalone && rc.Bash {
+		return errors.New("flag --standalone-tests can't be used with flag --bash")
+	}
+	if rc.withMain && rc.Bash {
+		return errors.New("flag --main can't be used with flag --bash")
+	}
+	return nil
+}
+
+// readFormatFlags reads the format of generated golang tests and checks the flags that can't be used with it
+func (rc *runConfig) readFormatFlags(flags *pflag.FlagSet) error {
+	rc.format = flags.Lookup("format").Value.String()
+	switch rc.format {
+	case generator.FormatTestify:
+	case generator.FormatGinkgo:
+		if rc.Bash || rc.standalone {
+			return errors.New("flag --format=ginkgo can't be used with flags --bash and --standalone-tests")
+		}
+		if rc.SharedSession {
+			return errors.New("flag --format=ginkgo can't be used with flag --shared-session")
+		}
+		if len(rc.args) > 2 {
+			return errors.New("flag --format=ginkgo can't be used with base-pkg arg")
+		}
+	default:
+		return errors.Errorf("unknown --format value: %v", rc.format)
+	}
+	if rc.Flatten && (rc.Bash || rc.withMain || rc.format == generator.FormatGinkgo) {
+		return errors.New("flag --flatten can't be used with flags --bash, --main and --format=ginkgo")
+	}
+	return nil
+}
+
+// readIncrementalFlags reads --incremental and checks the modes that generate the files of all the suites at once
+func (rc *runConfig) readIncrementalFlags(flags *pflag.FlagSet) error {
+	var err error
+	if rc.incremental, err = flags.GetBool("incremental"); err != nil {
+		return err
+	}
+	if rc.incremental && rc.Bash {
+		return errors.New("flag --incremental can't be used with flag --bash")
+	}
+	if rc.incremental && rc.checkGenerated {
+		return errors.New("flag --incremental can't be used with flag --check-generated")
+	}
+	if rc.SingleFile && (rc.Bash || rc.withMain || rc.standalone || rc.makefile || rc.incremental || rc.format == generator.FormatGinkgo) {
+		return errors.New("flag --single-file can't be used with flags --bash, --main, --standalone-tests, --makefile, " +
+			"--incremental and --format=ginkgo")
+	}
+	return nil
+}
+
+// readParserFlags reads the flags that change how the markdown files are read to the options of the parser
+func (rc *runConfig) readParserFlags(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	rc.Shell = flags.Lookup("shell").Value.String()
+	var scenarios, strict, indentedBlocks, noCache bool
+	err := boolFlags(flags, map[string]*bool{
+		"scenarios":       &scenarios,
+		"strict":          &strict,
+		"indented-blocks": &indentedBlocks,
+		"no-cache":        &noCache,
+	})
+	if err != nil {
+		return err
+	}
+	rc.parserOptions = []parser.Option{parser.WithDefaultShell(rc.Shell), parser.WithLogger(rc.log)}
+	if scenarios {
+		rc.parserOptions = append(rc.parserOptions, parser.WithScenarios())
+	}
+	if strict {
+		rc.parserOptions = append(rc.parserOptions, parser.WithStrict())
+	}
+	if indentedBlocks {
+		rc.parserOptions = append(rc.parserOptions, parser.WithIndentedBlocks())
+	}
+	// the lines of the blocks are used by the source map and the comments of golang code
+	if rc.withSources || !rc.Bash {
+		rc.parserOptions = append(rc.parserOptions, parser.WithSourceLines())
+	}
+	sections, err := getSections(cmd)
+	if err != nil {
+		return err
+	}
+	if sections != nil {
+		rc.parserOptions = append(rc.parserOptions, parser.WithSections(sections))
+	}
+	snippetFiles, err := flags.GetStringArray("snippets")
+	if err != nil {
+		return err
+	}
+	snippets, err := parser.LoadSnippets(snippetFiles...)
+	if err != nil {
+		return err
+	}
+	rc.parserOptions = append(rc.parserOptions, parser.WithSnippets(snippets))
+	if noCache {
+		return nil
+	}
+	build, err := buildHash()
+	if err != nil {
+		return errors.Wrap(err, "cannot use the cache of the parsed files, use --no-cache")
+	}
+	rc.cache = parser.LoadCache(filepath.Join(rc.OutputDir, parser.CacheFile), build, rc.log)
+	rc.parserOptions = append(rc.parserOptions, parser.WithCache(rc.cache))
+	return nil
+}
+
+// buildHash returns the hash of the executable of gotestmd, so the cache of another build, e.g. after an upgrade, is not used
+func buildHash() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writes returns true if the generated files are written to the output dir
+func (rc *runConfig) writes() bool {
+	return !rc.checkGenerated && !rc.list && !rc.dot
+}
+
+// boolFlags reads the bool flags to the targets by the names of the flags
+func boolFlags(flags *pflag.FlagSet, targets map[string]*bool) error {
+	for name, target := range targets {
+		value, err := flags.GetBool(name)
+		if err != nil {
+			return err
+		}
+		*target = value
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gotestmd
+
+import (
+	"io"
+	"log"
+	"strings"
+
+	"github.com/networkservicemesh/gotestmd/internal/linker"
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+)
+
+// debugPrefix is the level prefix of the diagnostics of --verbose
+const debugPrefix = "[DEBUG] "
+
+// newLogger returns the logger of the diagnostics of --verbose. It writes the messages to w or discards them if verbose is not set
+func newLogger(w io.Writer, verbose bool) *log.Logger {
+	if !verbose {
+		w = io.Discard
+	}
+	return log.New(w, debugPrefix, 0)
+}
+
+// logExample logs the blocks of the example found in the file by the sections they are classified to
+func logExample(l *log.Logger, file string, ex *parser.Example) {
+	l.Printf("found %v", file)
+	logBlocks(l, file, "run", ex.Run)
+	logBlocks(l, file, "assert", ex.Assert)
+	logBlocks(l, file, "cleanup", ex.Cleanup)
+	for _, s := range ex.Suites {
+		logBlocks(l, file, "suite "+s.Name+": run", s.Run)
+		logBlocks(l, file, "suite "+s.Name+": cleanup", s.Cleanup)
+	}
+	for _, s := range ex.Scenarios {
+		logBlocks(l, file, "scenario "+s.Name+": run", s.Run)
+		logBlocks(l, file, "scenario "+s.Name+": cleanup", s.Cleanup)
+	}
+	l.Printf("%v: includes: %v, requires: %v", file, ex.Includes, ex.Requires)
+}
+
+// logBlocks logs the first command of each block of the section
+func logBlocks(l *log.Logger, file, section string, blocks []string) {
+	for i, block := range blocks {
+		l.Printf("%v: %v block %v: %v", file, section, i+1, firstCommand(block))
+	}
+}
+
+// logLinked logs whether the examples are suites or tests, the run blocks of the suites are their setup
+func logLinked(l *log.Logger, examples []*linker.LinkedExample) {
+	for _, e := range examples {
+		if e.IsLeaf() {
+			var parents []string
+			for _, parent := range e.Parents {
+				parents = append(parents, parent.Dir)
+			}
+			l.Printf("example %v is a test of %v, its run blocks are the test", e.Dir, parents)
+			continue
+		}
+		l.Printf("example %v is a suite, its run blocks are the setup, dependencies: %v", e.Dir, e.Dependencies())
+	}
+}
+
+// firstCommand returns the first line of the block that is not an annotation, ... marks the blocks with more lines
+func firstCommand(block string) string {
+	lines := strings.Split(block, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, parser.AnnotationPrefix) {
+			continue
+		}
+		if i < len(lines)-1 {
+			return line + " ..."
+		}
+		return line
+	}
+	return ""
+}
@@ -20,6 +20,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -30,6 +32,52 @@ type Config struct {
 	BasePkg   string
 	Bash      bool
 	Match     string
+	// CommandTimeout is a timeout for a single run of a command in generated suites. Zero means no timeout
+	CommandTimeout time.Duration
+	// Dirs defines how dirs of the examples are referenced in the generated code: "", "absolute" or "relative"
+	Dirs string
+	// DirsBase is a dir that relative dirs are calculated from. Defaults to the root of the go module
+	DirsBase string
+	// Shell is the shell of the examples that don't declare it in the front matter
+	Shell string
+	// RequireNoError makes generated golang tests check each command with require.NoError
+	RequireNoError bool
+	// SharedSession makes each generated golang suite run the commands of the suite and its tests in a single shell session
+	SharedSession bool
+	// HermeticEnv makes runners of generated golang tests inherit only EnvInherit variables
+	HermeticEnv bool
+	EnvInherit  []string
+	// EnvFile is a path to the env file loaded by all the suites that don't declare own env file
+	EnvFile string
+	// EnvFileMissingOK makes a missing env file a warning instead of a failure
+	EnvFileMissingOK bool
+	// Timing makes generated bash scripts echo each command and its duration
+	Timing bool
+	// LogCommands makes generated golang tests log each command with s.T().Log before it runs
+	LogCommands bool
+	// RetryMaxAttempts is the default number of attempts of the retried commands in bash scripts. Zero means no limit
+	RetryMaxAttempts int
+	// RetryJitter is the default maximum random delay added to the interval between the retries of the commands in bash scripts
+	RetryJitter time.Duration
+	// RetryTimeout is the default timeout of the retried commands in bash scripts, the suites can override it. Zero means 300s
+	RetryTimeout time.Duration
+	// SuiteType is the name of the generated suite types, "*" is replaced with the title-cased package name. Defaults to Suite
+	SuiteType string
+	// Vars are the values of {{gotestmd:name}} placeholders of the commands, substituted at generation time
+	Vars map[string]string
+	// SplitCommands makes each command line of the bash code blocks a separate command of generated code
+	SplitCommands bool
+	// StripComments removes blank and comment lines from the bash code blocks, blocks of only comments are not run
+	StripComments bool
+	// PersistEnv makes generated bash scripts save the variables exported by the setup of a suite and restore them
+	// for the other targets, so the targets can be run separately
+	PersistEnv bool
+	// QualifiedNames makes generated suites import the suites with the same package name from different dirs by their paths
+	QualifiedNames bool
+	// Flatten makes generated suites run the setup of the required and included suites inline instead of nested suites
+	Flatten bool
+	// SingleFile makes all the golang suites generated into one file of the package of the output dir instead of a package per suite
+	SingleFile bool
 }
 
 // FromArgs returns Config from the os.Args
@@ -0,0 +1,44 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a config file of gotestmd
+type File struct {
+	// Sections maps titles of the headings to the sections they are parsed as: run, cleanup, includes, requires or ignore
+	Sections map[string]string `yaml:"sections" json:"sections"`
+}
+
+// LoadFile reads the config file. Both yaml and json files are supported
+func LoadFile(path string) (*File, error) {
+	source, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read config file %v", path)
+	}
+	var result File
+	if err := yaml.Unmarshal(source, &result); err != nil {
+		return nil, errors.Wrapf(err, "cannot parse config file %v", path)
+	}
+	return &result, nil
+}
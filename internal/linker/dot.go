@@ -0,0 +1,49 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dot returns the graph of the linked examples in Graphviz DOT format. The nodes are the dirs of the examples, an edge goes
+// from an example to each example it requires. The examples included by an example are linked with dashed edges
+func Dot(examples []*LinkedExample) string {
+	dirs := map[string]string{}
+	for _, e := range examples {
+		dirs[e.Name] = e.Dir
+	}
+	var sb strings.Builder
+	sb.WriteString("digraph gotestmd {\n")
+	for _, e := range examples {
+		_, _ = fmt.Fprintf(&sb, "\t%q;\n", e.Dir)
+	}
+	for _, e := range examples {
+		for _, require := range e.Requires {
+			// optional requires that don't match any example are not linked
+			if dir, ok := dirs[require]; ok {
+				_, _ = fmt.Fprintf(&sb, "\t%q -> %q;\n", e.Dir, dir)
+			}
+		}
+		for _, child := range e.Children {
+			_, _ = fmt.Fprintf(&sb, "\t%q -> %q [style=dashed];\n", e.Dir, child.Dir)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -97,6 +97,9 @@ func NewLinkedExample(root string, e *parser.Example) *LinkedExample {
 	for i := 0; i < len(e.Requires); i++ {
 		e.Requires[i] = filepath.Join(result.Name, e.Requires[i])
 	}
+	for i := 0; i < len(e.Optional); i++ {
+		e.Optional[i] = filepath.Join(result.Name, e.Optional[i])
+	}
 
 	return result
 }
@@ -18,7 +18,12 @@
 package linker
 
 import (
+	"path/filepath"
+	"sort"
+	"strings"
+
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	"github.com/networkservicemesh/gotestmd/internal/parser"
 )
@@ -44,6 +49,13 @@ func (l *Linker) Link(examples ...*parser.Example) ([]*LinkedExample, error) {
 		index[linkedExample.Name] = linkedExample
 		result = append(result, linkedExample)
 	}
+	for _, linkedExample := range result {
+		requires, err := expandRequires(index, linkedExample)
+		if err != nil {
+			return nil, err
+		}
+		linkedExample.Requires = requires
+	}
 	for _, linkedExample := range result {
 		for _, include := range linkedExample.Includes {
 			child := index[include]
@@ -63,5 +75,88 @@ func (l *Linker) Link(examples ...*parser.Example) ([]*LinkedExample, error) {
 		}
 		linkedExample.Requires = filteredRequires
 	}
+	return hoistGlobal(result)
+}
+
+// hoistGlobal moves the global example to the beginning of the examples, so it's set up first.
+// Returns error if there are several global examples or the global example is linked with other examples
+func hoistGlobal(examples []*LinkedExample) ([]*LinkedExample, error) {
+	var global *LinkedExample
+	var rest []*LinkedExample
+	for _, e := range examples {
+		if !e.Global {
+			rest = append(rest, e)
+			continue
+		}
+		if global != nil {
+			return nil, errors.Errorf("only one example can be global, found %v and %v", global.Name, e.Name)
+		}
+		if len(e.Includes) > 0 || len(e.Requires) > 0 {
+			return nil, errors.Errorf("global example %v can't include or require other examples", e.Name)
+		}
+		global = e
+	}
+	if global == nil {
+		return examples, nil
+	}
+	for _, e := range rest {
+		for _, link := range append(append([]string{}, e.Includes...), e.Requires...) {
+			if link == global.Name {
+				return nil, errors.Errorf("global example %v can't be included or required by %v, it's set up for all the examples", global.Name, e.Name)
+			}
+		}
+	}
+	return append([]*LinkedExample{global}, rest...), nil
+}
+
+// expandRequires replaces glob requires of the example with the names of the matching examples. Requires are deduplicated,
+// the example doesn't require itself. Optional requires that don't match any example are skipped with a warning
+func expandRequires(index map[string]*LinkedExample, e *LinkedExample) ([]string, error) {
+	var result []string
+	seen := map[string]bool{e.Name: true}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	optional := map[string]bool{}
+	for _, require := range e.Optional {
+		optional[require] = true
+	}
+	for _, require := range e.Requires {
+		if !strings.ContainsAny(require, "*?[") {
+			switch {
+			case index[require] != nil:
+				add(require)
+			case optional[require]:
+				logrus.Warnf("optional require %v for example %v is not found, it's skipped", require, e.Name)
+			default:
+				return nil, errors.Errorf("unknown require %v for example %v", require, e.Name)
+			}
+			continue
+		}
+		var matches []string
+		for name := range index {
+			ok, err := filepath.Match(require, name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid require %v for example %v", require, e.Name)
+			}
+			if ok {
+				matches = append(matches, name)
+			}
+		}
+		if len(matches) == 0 && optional[require] {
+			logrus.Warnf("optional require %v for example %v doesn't match any example, it's skipped", require, e.Name)
+			continue
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("require %v for example %v doesn't match any example", require, e.Name)
+		}
+		sort.Strings(matches)
+		for _, name := range matches {
+			add(name)
+		}
+	}
 	return result, nil
 }
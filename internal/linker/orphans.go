@@ -0,0 +1,63 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linker
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// IsTarget returns true if the example is a target of the generation on its own: it's in the root dir or in its direct
+// subdir, it's global or it includes or requires other examples
+func (e *LinkedExample) IsTarget() bool {
+	return e.Global || len(e.Children) > 0 || len(e.Requires) > 0 || !strings.Contains(strings.Trim(filepath.ToSlash(e.Name), "/"), "/")
+}
+
+// Orphans returns the examples that are not reachable from the targets by includes and requires, in the order
+// of the examples. Such examples are nested in the subdirs, but nothing includes or requires them
+func Orphans(examples []*LinkedExample) []*LinkedExample {
+	index := map[string]*LinkedExample{}
+	for _, e := range examples {
+		index[e.Name] = e
+	}
+	reachable := map[*LinkedExample]bool{}
+	var visit func(e *LinkedExample)
+	visit = func(e *LinkedExample) {
+		if e == nil || reachable[e] {
+			return
+		}
+		reachable[e] = true
+		for _, child := range e.Children {
+			visit(child)
+		}
+		for _, require := range e.Requires {
+			visit(index[require])
+		}
+	}
+	for _, e := range examples {
+		if e.IsTarget() {
+			visit(e)
+		}
+	}
+	var result []*LinkedExample
+	for _, e := range examples {
+		if !reachable[e] {
+			result = append(result, e)
+		}
+	}
+	return result
+}
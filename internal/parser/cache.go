@@ -0,0 +1,146 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CacheFile is the name of the cache of the parsed files in the output dir
+const CacheFile = ".gotestmd-cache.json"
+
+// cacheSchema is the version of the cached examples, it must be increased when Example or the parsing changes
+const cacheSchema = 1
+
+// Cache keeps the parsed examples by the hashes of the files and the options of the parser, so unchanged files are
+// not parsed again. A file is parsed on its own, so changes of the included or required files don't invalidate its entry
+type Cache struct {
+	// Version is the schema of the entries and the build of gotestmd that parsed the files, entries of another version are dropped
+	Version string `json:"version"`
+	// Entries are the parsed examples by the hashes of the files and the options
+	Entries map[string]json.RawMessage `json:"entries"`
+
+	mu sync.Mutex
+	// used are the entries of the current generation, only they are saved
+	used map[string]json.RawMessage
+}
+
+// LoadCache reads the cache from the file. build identifies the build of the parser, e.g. the hash of the executable.
+// Returns an empty cache if the file is missing, invalid or written by another build or schema, the reason is logged to the logger
+func LoadCache(path, build string, logger *log.Logger) *Cache {
+	version := fmt.Sprintf("%v/%v", cacheSchema, build)
+	result := &Cache{Version: version, Entries: map[string]json.RawMessage{}}
+	source, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		logger.Printf("all the files are parsed: %v", err)
+		return result
+	}
+	var previous Cache
+	switch err := json.Unmarshal(source, &previous); {
+	case err != nil:
+		logger.Printf("all the files are parsed: cannot parse cache %v: %v", path, err)
+	case previous.Version != version:
+		logger.Printf("all the files are parsed: the cache was written by another build of gotestmd: %v", previous.Version)
+	case previous.Entries != nil:
+		result.Entries = previous.Entries
+	}
+	return result
+}
+
+// Save writes the entries used since the cache was loaded to the file, entries of the removed or changed files are dropped
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, err := json.Marshal(&Cache{Version: c.Version, Entries: c.used})
+	if err != nil {
+		return errors.Wrap(err, "cannot encode cache")
+	}
+	if err := os.WriteFile(path, append(source, '\n'), 0o600); err != nil {
+		return errors.Errorf("cannot save cache %v: %v", path, err.Error())
+	}
+	return nil
+}
+
+// get returns a copy of the cached example, so the callers can change it
+func (c *Cache) get(key string) (*Example, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, ok := c.Entries[key]
+	if !ok {
+		return nil, false
+	}
+	var result Example
+	if err := json.Unmarshal(source, &result); err != nil {
+		return nil, false
+	}
+	c.use(key, source)
+	return &result, true
+}
+
+// put adds the parsed example to the cache
+func (c *Cache) put(key string, example *Example) {
+	source, err := json.Marshal(example)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.use(key, source)
+}
+
+func (c *Cache) use(key string, source json.RawMessage) {
+	if c.used == nil {
+		c.used = map[string]json.RawMessage{}
+	}
+	c.used[key] = source
+}
+
+// cacheKey returns the key of the cache entry of the file source parsed with the options of the parser
+func (p *Parser) cacheKey(source []byte) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "shell=%v\nscenarios=%v\nstrict=%v\nindented=%v\nlines=%v\n", p.defaultShell, p.scenarios, p.strict,
+		p.indentedBlocks, p.sourceLines)
+	var titles []string
+	for title := range p.sections {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+	for _, title := range titles {
+		_, _ = fmt.Fprintf(h, "section %q=%v\n", title, p.sections[title])
+	}
+	var names []string
+	for name := range p.snippets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(h, "snippet %q=%q\n", name, p.snippets[name])
+	}
+	sum := sha256.Sum256(source)
+	_, _ = h.Write([]byte(hex.EncodeToString(sum[:])))
+	return hex.EncodeToString(h.Sum(nil))
+}
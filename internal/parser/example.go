@@ -20,7 +20,48 @@ package parser
 type Example struct {
 	Includes []string
 	Requires []string
+	// Optional are the requires marked as optional, they are skipped with a warning if they don't match any example
+	Optional []string
 	Run      []string
 	Cleanup  []string
-	Dir      string
+	// Assert are the commands that verify the result of Run, they are run after it
+	Assert []string
+	Dir    string
+	// Matrix contains values of the variables to run the example with, declared in the front matter
+	Matrix map[string][]string
+	// Shell is the shell to run the commands with
+	Shell string
+	// Scenarios are independent parts of the example that have own Run and Cleanup sections
+	Scenarios []*Scenario
+	// Suites are the parts of the example that have own Run and Cleanup sections and are generated as separate suites
+	// in the package of the example
+	Suites []*Scenario
+	// Env is the environment of the commands declared in the front matter. Nil means the environment is not declared
+	Env *Env
+	// EnvFile is a path to the env file loaded before the commands, relative to the dir of the example
+	EnvFile string
+	// NoChdir leaves the commands in the current dir instead of the dir of the example
+	NoChdir bool
+	// Order is the order of the included suites declared in the front matter, dirs are relative to the dir of the example
+	Order []string
+	// Global marks the example that is set up once before all the other suites and cleaned up after them
+	Global bool
+	// RetryTimeout is the timeout of the retried commands of the suite in seconds declared with # gotestmd:retry-timeout.
+	// Zero means the default timeout is used
+	RetryTimeout int
+	// Serial marks the example declared with # gotestmd:serial, its suite must not run concurrently with other suites
+	Serial bool
+}
+
+// Env is the environment of the commands. Only the listed variables are inherited from the environment of the tests
+type Env struct {
+	Inherit []string          `yaml:"inherit"`
+	Vars    map[string]string `yaml:"vars"`
+}
+
+// Scenario is a level 2 section of the example that has own Run and Cleanup sections
+type Scenario struct {
+	Name    string
+	Run     []string
+	Cleanup []string
 }
@@ -0,0 +1,193 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is returned for a malformed markdown file, e.g. a code block that is not closed
+type ParseError struct {
+	// File is the markdown file, empty if the source is parsed with Parser.Parse
+	File string
+	// Line is the line of the file where the malformed part begins
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %v: %v", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Msg)
+}
+
+// cutFence returns the fence and the info string if the line opens or closes a code block: three or more backticks
+// or tildes. Info strings of backtick fences can't contain backticks, such lines are inline code
+func cutFence(line string) (fence, info string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	for _, c := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == c {
+			n++
+		}
+		if n < 3 {
+			continue
+		}
+		info = strings.TrimSpace(trimmed[n:])
+		if c == '`' && strings.Contains(info, "`") {
+			return "", "", false
+		}
+		return trimmed[:n], info, true
+	}
+	return "", "", false
+}
+
+// checkFences returns ParseError if a code block is not closed till the end of the source. A code block is closed
+// only by a fence of the same character that is at least as long as the opening one and has no info string, so
+// a block opened with ``` and closed with ~~~ is reported too. firstLine is the number of the first line of the source in the file
+func checkFences(source string, firstLine int) error {
+	var open, mismatch string
+	var openLine, mismatchLine int
+	for i, line := range strings.Split(source, "\n") {
+		fence, info, ok := cutFence(line)
+		switch {
+		case !ok:
+		case open == "":
+			open, openLine, mismatch = fence, firstLine+i, ""
+		case info != "":
+		case fence[0] == open[0] && len(fence) >= len(open):
+			open = ""
+		case mismatch == "":
+			mismatch, mismatchLine = fence, firstLine+i
+		}
+	}
+	switch {
+	case open == "":
+		return nil
+	case mismatch != "":
+		return &ParseError{Line: openLine, Msg: fmt.Sprintf("code block opened with %v is not closed, %v at line %v doesn't close it",
+			open, mismatch, mismatchLine)}
+	}
+	return &ParseError{Line: openLine, Msg: fmt.Sprintf("code block opened with %v is not closed", open)}
+}
+
+// normalizeFences rewrites tilde fences and backtick fences longer than three backticks to ``` fences, the only fences
+// that the rest of the parser reads. Blocks with lines that start with ``` are kept as is, they would be closed early.
+// If lang is not empty, the indented code blocks are fenced as the blocks of lang: the blank line before the block
+// becomes the opening fence and the blank line after it becomes the closing one, so the lines of the file keep their numbers.
+// Indented blocks that are not separated by blank lines or follow list items are not code blocks
+func normalizeFences(source, lang string) string {
+	lines := strings.Split(source, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence, info, ok := cutFence(lines[i])
+		if !ok {
+			if lang != "" {
+				i = fenceIndented(&lines, i, lang)
+			}
+			continue
+		}
+		end := i + 1
+		for ; end < len(lines); end++ {
+			if closing, closingInfo, ok := cutFence(lines[end]); ok && closingInfo == "" && closing[0] == fence[0] && len(closing) >= len(fence) {
+				break
+			}
+		}
+		if end == len(lines) {
+			break
+		}
+		if fence != "```" && !strings.Contains(info, "`") && !hasFenceLine(lines[i+1:end]) {
+			lines[i] = strings.Replace(lines[i], fence, "```", 1)
+			lines[end] = strings.Replace(lines[end], strings.TrimSpace(lines[end]), "```", 1)
+		}
+		i = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fenceIndented fences the indented code block that follows the blank line i, if any. Returns the last line of the block
+// or i if there is no block
+func fenceIndented(lines *[]string, i int, lang string) int {
+	l := *lines
+	if strings.TrimSpace(l[i]) != "" || i+1 == len(l) || !isIndented(l[i+1]) {
+		return i
+	}
+	for prev := i - 1; prev >= 0; prev-- {
+		if trimmed := strings.TrimSpace(l[prev]); trimmed != "" {
+			if isListItem(trimmed) || isIndented(l[prev]) {
+				return i
+			}
+			break
+		}
+	}
+	last := i
+	for j := i + 1; j < len(l); j++ {
+		if isIndented(l[j]) {
+			last = j
+		} else if strings.TrimSpace(l[j]) != "" {
+			break
+		}
+	}
+	if last+1 < len(l) && strings.TrimSpace(l[last+1]) != "" {
+		return i
+	}
+	block := make([]string, 0, last-i)
+	for _, line := range l[i+1 : last+1] {
+		if strings.HasPrefix(line, "\t") {
+			line = line[1:]
+		} else {
+			line = strings.TrimPrefix(line, "    ")
+		}
+		block = append(block, line)
+	}
+	if hasFenceLine(block) {
+		return i
+	}
+	l[i] = "```" + lang
+	copy(l[i+1:], block)
+	if last+1 == len(l) {
+		l = append(l, "")
+	}
+	l[last+1] = "```"
+	*lines = l
+	return last + 1
+}
+
+// isIndented returns true if the line is indented enough to be a line of an indented code block
+func isIndented(line string) bool {
+	return strings.TrimSpace(line) != "" && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t"))
+}
+
+// isListItem returns true if the trimmed line begins a list item, the indented lines that follow it continue the item
+func isListItem(trimmed string) bool {
+	if strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ ") {
+		return true
+	}
+	digits := len(trimmed) - len(strings.TrimLeft(trimmed, "0123456789"))
+	return digits > 0 && (strings.HasPrefix(trimmed[digits:], ". ") || strings.HasPrefix(trimmed[digits:], ") "))
+}
+
+// hasFenceLine returns true if a line starts with ```, such lines are read as fences by the rest of the parser
+func hasFenceLine(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			return true
+		}
+	}
+	return false
+}
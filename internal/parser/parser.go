@@ -20,37 +20,291 @@
 package parser
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const frontMatterDelim = "---"
+
+const (
+	// ShellBash is the default shell of the examples
+	ShellBash = "bash"
+	// ShellPowerShell is PowerShell
+	ShellPowerShell = "powershell"
+)
+
+// scriptLanguages are languages of the code blocks that contain commands for the shell
+var scriptLanguages = map[string][]string{
+	ShellBash:       {"bash"},
+	ShellPowerShell: {"powershell", "pwsh"},
+}
+
+// interpreterAnnotation is the beginning of the first line of the code blocks of any language that are run with an interpreter
+const interpreterAnnotation = "# gotestmd:interpreter "
+
+// interpreterBlockRegex matches the beginning of a code block of any language that is run with an interpreter
+var interpreterBlockRegex = regexp.MustCompile("```[\\w-]*\n# gotestmd:interpreter ")
+
+// envNameRegex matches the names of the environment variables of the conditions and the captures of the code blocks
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// AnnotationPrefix is the beginning of the annotation lines of the code blocks, e.g. # gotestmd:retry
+const AnnotationPrefix = "# gotestmd:"
+
+const (
+	// outputBlock is the beginning of a code block with the expected output of the previous command
+	outputBlock = "```output"
+	// outputAnnotation and outputRegexAnnotation are added to the commands followed by an output block
+	outputAnnotation      = "# gotestmd:output "
+	outputRegexAnnotation = "# gotestmd:output-regex "
+	// expectFailAnnotation declares that the command of a code block is expected to fail, optionally with the exit code
+	expectFailAnnotation = "# gotestmd:expect-fail"
+	// stdinBlock is the beginning of a code block with the stdin of the previous command
+	stdinBlock = "```stdin"
+	// stdinAnnotation is added to the commands followed by a stdin block
+	stdinAnnotation = "# gotestmd:stdin "
+	// linesAnnotation is added to the code blocks with commands, its args are the first and the last lines of the block in the file
+	linesAnnotation = "# gotestmd:lines "
+	// optionalMark follows the links of the requires that are skipped if they don't match any example
+	optionalMark = "(optional)"
+	// ifPrefix declares the condition of a code block after its language, e.g. ```bash if:CLUSTER_TYPE=kind
+	ifPrefix = "if:"
+	// ifAnnotation is added to the code blocks with a condition, they are run only if the environment variable has the value
+	ifAnnotation = "# gotestmd:if "
+	// capturePrefix binds the stdout of a code block to a variable after its language, e.g. ```bash capture:POD_NAME
+	capturePrefix = "capture:"
+	// captureAnnotation is added to the code blocks whose stdout is captured, its arg is the name of the variable
+	captureAnnotation = "# gotestmd:capture "
+	// retryAnnotation is added to the code blocks of verify sections, so generated bash scripts retry them
+	retryAnnotation = "# gotestmd:retry"
+	// retryTimeoutDirective is a line of the markdown file outside of the code blocks, its arg is the timeout of the retried
+	// commands of the suite in seconds. The line can be wrapped in an html comment, so it's not rendered
+	retryTimeoutDirective = "# gotestmd:retry-timeout"
+	// serialDirective is a line of the markdown file outside of the code blocks that marks the suite that must not run
+	// concurrently with other suites
+	serialDirective = "# gotestmd:serial"
+)
+
+// frontMatter is a yaml header of the markdown file
+type frontMatter struct {
+	Matrix  map[string][]string `yaml:"matrix"`
+	Shell   string              `yaml:"shell"`
+	Env     *Env                `yaml:"env"`
+	Chdir   *bool               `yaml:"chdir"`
+	EnvFile string              `yaml:"envFile"`
+	Order   []string            `yaml:"order"`
+	Global  bool                `yaml:"global"`
+	// Suites splits the file into suites by level 2 headings that have own Run or Cleanup sections
+	Suites bool `yaml:"suites"`
+	// Cleanup is the order of the cleanup commands: "" or "reverse"
+	Cleanup string `yaml:"cleanup"`
+	// Output is the mode of the output blocks that don't declare it
+	Output string `yaml:"output"`
+}
+
+// outputAnnotations are the annotations added to the commands followed by an output block by the modes of the check
+var outputAnnotations = map[string]string{
+	OutputExact:      outputAnnotation,
+	OutputTrimmed:    "# gotestmd:output-trimmed ",
+	OutputNormalized: "# gotestmd:output-normalized ",
+	OutputRegex:      outputRegexAnnotation,
+}
+
+// Modes of the check of the expected output
+const (
+	// OutputExact compares the output without trailing newlines, it's the default
+	OutputExact = "exact"
+	// OutputTrimmed ignores trailing whitespace of the lines
+	OutputTrimmed = "trimmed"
+	// OutputNormalized ignores trailing whitespace of the lines and collapses runs of spaces and tabs
+	OutputNormalized = "normalized"
+	// OutputRegex matches the output with a regular expression
+	OutputRegex = "regex"
+)
+
+// CleanupReverse is the order of the cleanup commands that are run from the last block to the first one
+const CleanupReverse = "reverse"
+
+const (
+	// SectionRun marks the headings whose commands are run
+	SectionRun = "run"
+	// SectionCleanup marks the headings whose commands are run on cleanup
+	SectionCleanup = "cleanup"
+	// SectionAssert marks the headings whose commands verify the result of the run, their failures are failures of the tests
+	SectionAssert = "assert"
+	// SectionVerify marks the headings whose commands wait for the result of the run, they are assertions that are retried
+	SectionVerify = "verify"
+	// SectionIncludes marks the headings with links to the included examples
+	SectionIncludes = "includes"
+	// SectionRequires marks the headings with links to the required examples
+	SectionRequires = "requires"
+	// SectionIgnore marks the headings whose commands are not run
+	SectionIgnore = "ignore"
 )
 
+// defaultSections are the headings of the sections, used when the sections are not configured
+var defaultSections = map[string]string{
+	SectionRun:      "Run",
+	SectionCleanup:  "Cleanup",
+	SectionAssert:   "Assert",
+	SectionVerify:   "Verify",
+	SectionIncludes: "Includes",
+	SectionRequires: "Requires",
+}
+
+// IsSectionKind returns true if the kind is known to the parser
+func IsSectionKind(kind string) bool {
+	_, ok := defaultSections[kind]
+	return ok || kind == SectionIgnore
+}
+
 // Parser is markdown file reader
 type Parser struct {
-	linkRegex *regexp.Regexp
+	linkRegex    *regexp.Regexp
+	defaultShell string
+	scenarios    bool
+	strict       bool
+	// indentedBlocks makes the indented code blocks the blocks of the first language of the shell
+	indentedBlocks bool
+	// sourceLines adds the lines annotation to the code blocks with commands
+	sourceLines bool
+	// sections maps lower case titles of the headings to their kinds. Empty means only Run and Cleanup headings are used
+	sections map[string]string
+	// snippets are expanded in the code blocks that include them
+	snippets Snippets
+	cache    *Cache
+	log      *log.Logger
+}
+
+// Option is an option for the Parser
+type Option func(p *Parser)
+
+// WithDefaultShell sets the shell of the examples that don't declare it in the front matter
+func WithDefaultShell(shell string) Option {
+	return func(p *Parser) {
+		p.defaultShell = shell
+	}
+}
+
+// WithScenarios enables splitting of the files into scenarios. Each level 2 heading that has own Run or Cleanup section
+// is parsed as a Scenario
+func WithScenarios() Option {
+	return func(p *Parser) {
+		p.scenarios = true
+	}
+}
+
+// WithStrict makes Parse return an error if a code block with commands is outside of the sections that are run,
+// so the commands are not dropped silently, e.g. because of a typo in the heading
+func WithStrict() Option {
+	return func(p *Parser) {
+		p.strict = true
+	}
+}
+
+// WithIndentedBlocks makes Parse read the indented code blocks, that are separated by blank lines, as code blocks of the shell
+// of the example, e.g. bash. By default they are ignored like code blocks of other languages
+func WithIndentedBlocks() Option {
+	return func(p *Parser) {
+		p.indentedBlocks = true
+	}
+}
+
+// WithSourceLines makes Parse add # gotestmd:lines <first>-<last> line to the code blocks with commands, so the generated
+// commands can be traced back to the lines of the markdown file. By default the blocks don't depend on their position in the file
+func WithSourceLines() Option {
+	return func(p *Parser) {
+		p.sourceLines = true
+	}
+}
+
+// WithSections maps titles of the headings to SectionRun, SectionCleanup, SectionAssert, SectionVerify, SectionIncludes, SectionRequires
+// or SectionIgnore. Run, Cleanup, Assert, Verify, Includes and Requires headings keep their meaning unless they are mapped too. Contents of all the headings
+// of a kind are concatenated in the order of the file
+func WithSections(sections map[string]string) Option {
+	return func(p *Parser) {
+		p.sections = map[string]string{}
+		for kind := range defaultSections {
+			p.sections[kind] = kind
+		}
+		for title, kind := range sections {
+			p.sections[strings.ToLower(strings.TrimSpace(title))] = kind
+		}
+	}
+}
+
+// WithSnippets makes Parse replace # gotestmd:include-snippet <name> lines of the code blocks with the commands of the snippets.
+// Parse returns an error if an included snippet is not defined, also without this option
+func WithSnippets(snippets Snippets) Option {
+	return func(p *Parser) {
+		p.snippets = snippets
+	}
+}
+
+// WithLogger sets the logger of the diagnostics of the parser, they are discarded by default
+func WithLogger(logger *log.Logger) Option {
+	return func(p *Parser) {
+		p.log = logger
+	}
+}
+
+// WithCache makes ParseFile take the examples of the unchanged files from the cache and add the parsed ones to it
+func WithCache(cache *Cache) Option {
+	return func(p *Parser) {
+		p.cache = cache
+	}
 }
 
 // New creates new Parser instance
-func New() *Parser {
-	return &Parser{
-		linkRegex: regexp.MustCompile(`\[.*\]\(.*\)`),
+func New(options ...Option) *Parser {
+	p := &Parser{
+		linkRegex:    regexp.MustCompile(`\[.*\]\(.*\)`),
+		defaultShell: ShellBash,
+		log:          log.New(io.Discard, "", 0),
+	}
+	for _, o := range options {
+		o(p)
 	}
+	return p
 }
 
 // ParseFile reads file
 func (p *Parser) ParseFile(filePath string) (*Example, error) {
-	f, err := os.Open(filepath.Clean(filePath))
+	source, err := os.ReadFile(filepath.Clean(filePath))
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = f.Close()
-	}()
-	v, err := p.Parse(f)
+	var key string
+	if p.cache != nil {
+		key = p.cacheKey(source)
+		if v, ok := p.cache.get(key); ok {
+			p.log.Printf("%v is unchanged, the example is taken from the cache", filePath)
+			v.Dir = filepath.Dir(filePath)
+			return v, nil
+		}
+	}
+	v, err := p.Parse(bytes.NewReader(source))
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.File = filePath
+		return nil, parseErr
+	}
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, filePath)
+	}
+	if p.cache != nil {
+		p.cache.put(key, v)
 	}
 	v.Dir = filepath.Dir(filePath)
 	return v, nil
@@ -62,17 +316,97 @@ func (p *Parser) Parse(r io.Reader) (*Example, error) {
 	if err != nil {
 		return nil, err
 	}
-	source := string(bytes)
+	// the files written on Windows end lines with CRLF, \r would be a part of each command
+	source := strings.ReplaceAll(string(bytes), "\r\n", "\n")
+
+	var header frontMatter
+	var firstLine = 1
+	if v, rest, ok := cutFrontMatter(source); ok {
+		if err = yaml.Unmarshal([]byte(v), &header); err != nil {
+			return nil, errors.Wrap(err, "cannot parse front matter")
+		}
+		firstLine += strings.Count(source[:len(source)-len(rest)], "\n")
+		source = rest
+	}
+
+	if header.Shell == "" {
+		header.Shell = p.defaultShell
+	}
+	languages, ok := scriptLanguages[header.Shell]
+	if !ok {
+		return nil, errors.Errorf("unknown shell: %v", header.Shell)
+	}
+	if header.Global && header.Suites {
+		return nil, errors.New("global example can't be split into suites")
+	}
+	if header.Cleanup != "" && header.Cleanup != CleanupReverse {
+		return nil, errors.Errorf("unknown cleanup order: %v", header.Cleanup)
+	}
+	if err := checkMatrix(header.Matrix); err != nil {
+		return nil, err
+	}
+	if header.Output == "" {
+		header.Output = OutputExact
+	}
+	if _, ok := outputAnnotations[header.Output]; !ok {
+		return nil, errors.Errorf("unknown output mode: %v", header.Output)
+	}
+	if err := checkFences(source, firstLine); err != nil {
+		return nil, err
+	}
+	var indentedLang string
+	if p.indentedBlocks {
+		indentedLang = languages[0]
+	}
+	source = normalizeFences(source, indentedLang)
+	if err := p.snippets.checkIncludes(source, firstLine); err != nil {
+		return nil, err
+	}
+	source, retryTimeout, err := cutRetryTimeout(source, firstLine)
+	if err != nil {
+		return nil, err
+	}
+	source, serial, err := cutSerial(source, firstLine)
+	if err != nil {
+		return nil, err
+	}
+	if p.strict {
+		if err := p.checkBlocks(source, firstLine, languages); err != nil {
+			return nil, err
+		}
+	}
+	source, err = markBlocks(source, firstLine, languages, p.sourceLines)
+	if err != nil {
+		return nil, err
+	}
+	if header.Shell != ShellBash && strings.Contains(source, "\n"+captureAnnotation) {
+		return nil, errors.Errorf("capture of the output is supported only by %v examples", ShellBash)
+	}
 
 	parseScript := func(s string) []string {
 		const (
-			scriptBegin = "```bash"
+			scriptBegin = "```"
 			scriptEnd   = "```"
 		)
 
+		// indexBegin returns the position of the first code block of the shell languages or the first code block
+		// with an interpreter annotation, and the length of its beginning
+		indexBegin := func(s string) (index, length int) {
+			index = -1
+			for _, lang := range languages {
+				if i := strings.Index(s, scriptBegin+lang); i >= 0 && (index < 0 || i < index) {
+					index, length = i, len(scriptBegin+lang)
+				}
+			}
+			if loc := interpreterBlockRegex.FindStringIndex(s); loc != nil && (index < 0 || loc[0] < index) {
+				index, length = loc[0], strings.IndexByte(s[loc[0]:], '\n')
+			}
+			return index, length
+		}
+
 		var r []string
-		for start := strings.Index(s, scriptBegin); start >= 0; start = strings.Index(s, scriptBegin) {
-			start += len(scriptBegin)
+		for start, length := indexBegin(s); start >= 0; start, length = indexBegin(s) {
+			start += length
 
 			end := strings.Index(s[start:], scriptEnd)
 			if end < 0 {
@@ -80,66 +414,567 @@ func (p *Parser) Parse(r io.Reader) (*Example, error) {
 			}
 			end += start
 
-			r = append(r, strings.TrimSpace(s[start:end]))
+			block := p.snippets.expand(strings.TrimSpace(s[start:end]))
 			s = s[end+len(scriptEnd):]
+			if rest, ok := cutStdinLine(block); ok {
+				if annotation, next, ok := cutStdinPayload(s); ok {
+					block = annotation + "\n" + rest
+					s = next
+				}
+			}
+			for {
+				annotation, rest, ok := cutOutputBlock(s, header.Output)
+				if !ok {
+					annotation, rest, ok = cutStdinBlock(s)
+				}
+				if !ok {
+					break
+				}
+				block = annotation + "\n" + block
+				s = rest
+			}
+			r = append(r, block)
 		}
 		return r
 	}
 
-	return &Example{
-		Cleanup:  parseScript(parseSection("# Cleanup", source)),
-		Run:      parseScript(parseSection("# Run", source)),
-		Includes: p.parseLinks(parseSection("# Includes", source)),
-		Requires: p.parseLinks(parseSection("# Requires", source)),
-	}, nil
+	parseCleanup := func(s string) []string {
+		blocks := parseScript(p.section(SectionCleanup, s))
+		if header.Cleanup == CleanupReverse {
+			return reverse(blocks)
+		}
+		return blocks
+	}
+
+	// cutScenarios cuts level 2 sections that have own Run or Cleanup sections from the source and parses them
+	cutScenarios := func() []*Scenario {
+		var result []*Scenario
+		var scenarioSources []string
+		source, scenarioSources = p.cutScenarios(source)
+		for _, scenarioSource := range scenarioSources {
+			title, body, _ := strings.Cut(scenarioSource, "\n")
+			result = append(result, &Scenario{
+				Name:    strings.TrimSpace(strings.TrimPrefix(title, "##")),
+				Cleanup: parseCleanup(body),
+				Run:     parseScript(p.section(SectionRun, body)),
+			})
+		}
+		return result
+	}
+
+	var suites, scenarios []*Scenario
+	if header.Suites {
+		suites = cutScenarios()
+	}
+	if p.scenarios {
+		scenarios = cutScenarios()
+	}
+
+	requires, optional := p.parseRequires(p.section(SectionRequires, source))
+	result := &Example{
+		Suites:    suites,
+		Scenarios: scenarios,
+		Cleanup:   parseCleanup(source),
+		Run:       parseScript(p.section(SectionRun, source)),
+		Assert:    append(parseScript(p.section(SectionAssert, source)), withRetry(parseScript(p.section(SectionVerify, source)))...),
+		Includes:  p.parseLinks(p.section(SectionIncludes, source)),
+		Requires:  requires,
+		Optional:  optional,
+		Matrix:    header.Matrix,
+		Shell:     header.Shell,
+		Env:       header.Env,
+		NoChdir:   header.Chdir != nil && !*header.Chdir,
+		EnvFile:   header.EnvFile,
+		Order:     header.Order,
+		Global:    header.Global,
+
+		RetryTimeout: retryTimeout,
+		Serial:       serial,
+	}
+	if err := checkAnnotations(result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func (p *Parser) parseLinks(s string) []string {
-	var result []string
-	links := p.linkRegex.FindAllString(s, -1)
-	for _, link := range links {
-		start := strings.IndexRune(link, '(') + len("(")
-		end := strings.IndexRune(link, ')')
-		result = append(result, link[start:end])
+// checkAnnotations returns an error for the first block with invalid annotations
+func checkAnnotations(ex *Example) error {
+	blocks := append(append(append([]string{}, ex.Run...), ex.Cleanup...), ex.Assert...)
+	for _, s := range append(append([]*Scenario{}, ex.Suites...), ex.Scenarios...) {
+		blocks = append(append(blocks, s.Run...), s.Cleanup...)
 	}
-	return result
+	for _, block := range blocks {
+		if err := checkBlockAnnotations(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBlockAnnotations returns an error if the exit code of the expect-fail annotation is not a positive number, if the condition
+// or the captured variable is invalid or if a block run with an interpreter has stdin. The interpreter reads the block from stdin,
+// so the stdin would be dropped
+func checkBlockAnnotations(block string) error {
+	var interpreter string
+	var stdin bool
+	for _, line := range strings.Split(block, "\n") {
+		if !strings.HasPrefix(line, AnnotationPrefix) {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, interpreterAnnotation); ok {
+			interpreter = value
+		}
+		stdin = stdin || strings.HasPrefix(line, stdinAnnotation)
+		if value, ok := strings.CutPrefix(line, expectFailAnnotation); ok && strings.TrimSpace(value) != "" {
+			if exitCode, err := strconv.Atoi(strings.TrimSpace(value)); err != nil || exitCode <= 0 {
+				return errors.Errorf("exit code of expect-fail annotation %q is not a positive number", strings.TrimSpace(value))
+			}
+		}
+		if value, ok := strings.CutPrefix(line, ifAnnotation); ok {
+			if err := checkCondition(value); err != nil {
+				return err
+			}
+		}
+		if value, ok := strings.CutPrefix(line, captureAnnotation); ok {
+			if err := checkCapture(value); err != nil {
+				return err
+			}
+		}
+	}
+	if interpreter != "" && stdin {
+		return errors.Errorf("stdin can't be passed to a block run with %v interpreter, the interpreter reads the block from stdin", interpreter)
+	}
+	return nil
+}
+
+// checkCondition returns an error if the condition of a code block is not NAME=VALUE, the block would be run unconditionally
+func checkCondition(cond string) error {
+	if name, _, ok := strings.Cut(cond, "="); !ok || !envNameRegex.MatchString(name) {
+		return errors.Errorf("invalid condition %q, expected NAME=VALUE", cond)
+	}
+	return nil
 }
 
-func parseSection(section, s string) string {
-	const sectionEnd = "#"
+// checkCapture returns an error if the output of a code block is captured to an invalid name of a variable
+func checkCapture(name string) error {
+	if !envNameRegex.MatchString(name) {
+		return errors.Errorf("invalid variable %q to capture the output to", name)
+	}
+	return nil
+}
 
-	start := strings.Index(s, section)
-	if start == -1 {
-		return ""
+// checkMatrix returns an error if a variable of the matrix has no values, its placeholders would be left in the commands
+func checkMatrix(matrix map[string][]string) error {
+	var names []string
+	for name, values := range matrix {
+		if len(values) == 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
 	}
+	sort.Strings(names)
+	return errors.Errorf("matrix variables have no values: %v", strings.Join(names, ", "))
+}
 
-	s = s[start+len(section):]
+// reverse returns the blocks in reverse order
+func reverse(blocks []string) []string {
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks
+}
 
-	var end, offset int
-	for blockEnd := 0; ; offset += blockEnd {
-		if end = strings.Index(s[offset:], sectionEnd); end < 0 {
-			return s
+// cutDirective cuts the line of the directive from the source and returns its arg and the line in the file, zero if the source
+// doesn't declare it. Directives are the lines outside of the code blocks, they can be wrapped in html comments, so they are
+// not rendered. The line is left blank, so the lines of the file keep their numbers. Returns ParseError if the directive
+// is repeated. firstLine is the number of the first line of the source in the file
+func cutDirective(source string, firstLine int, directive string) (rest, arg string, line int, err error) {
+	lines := strings.Split(source, "\n")
+	inBlock := false
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, "```") {
+			inBlock = !inBlock
+			continue
+		}
+		if inBlock {
+			continue
 		}
+		if strings.HasPrefix(trimmed, "<!--") && strings.HasSuffix(trimmed, "-->") {
+			trimmed = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(trimmed, "<!--"), "-->"))
+		}
+		value, ok := strings.CutPrefix(trimmed, directive)
+		if !ok || value != "" && value[0] != ' ' && value[0] != '\t' {
+			continue
+		}
+		if line > 0 {
+			return "", "", 0, &ParseError{Line: firstLine + i, Msg: fmt.Sprintf("%v is already declared at line %v", directive, line)}
+		}
+		arg, line = strings.TrimSpace(value), firstLine+i
+		lines[i] = ""
+	}
+	return strings.Join(lines, "\n"), arg, line, nil
+}
+
+// cutRetryTimeout cuts the retry timeout directive from the source and returns its number of seconds, zero if the source
+// doesn't declare it. Returns ParseError if the timeout is not a positive number of seconds
+func cutRetryTimeout(source string, firstLine int) (rest string, seconds int, err error) {
+	rest, arg, line, err := cutDirective(source, firstLine, retryTimeoutDirective)
+	if err != nil || line == 0 {
+		return rest, 0, err
+	}
+	if seconds, err = strconv.Atoi(arg); err != nil || seconds <= 0 {
+		return "", 0, &ParseError{Line: line, Msg: fmt.Sprintf("retry timeout %q is not a positive number of seconds", arg)}
+	}
+	return rest, seconds, nil
+}
+
+// cutSerial cuts the serial directive from the source and returns true if the source declares it
+func cutSerial(source string, firstLine int) (rest string, serial bool, err error) {
+	rest, arg, line, err := cutDirective(source, firstLine, serialDirective)
+	if err != nil || line == 0 {
+		return rest, false, err
+	}
+	if arg != "" {
+		return "", false, &ParseError{Line: line, Msg: fmt.Sprintf("%v doesn't take args, got %q", serialDirective, arg)}
+	}
+	return rest, true, nil
+}
+
+// cutFrontMatter cuts the front matter from the beginning of the source
+func cutFrontMatter(s string) (frontMatter, rest string, ok bool) {
+	if !strings.HasPrefix(s, frontMatterDelim+"\n") {
+		return "", s, false
+	}
+	body := s[len(frontMatterDelim)+1:]
+	end := strings.Index(body, "\n"+frontMatterDelim)
+	if end < 0 {
+		return "", s, false
+	}
+	return body[:end], body[end+len(frontMatterDelim)+1:], true
+}
+
+// cutOutputBlock cuts an output block that follows the command. Returns the annotation with the expected output
+// for the command. The mode of the check is declared after the language of the block, defaultMode is used if it's
+// not declared. An output block can only be separated from the command with spaces and newlines
+func cutOutputBlock(s, defaultMode string) (annotation, rest string, ok bool) {
+	body := strings.TrimLeft(s, " \t\n")
+	if !strings.HasPrefix(body, outputBlock) {
+		return "", s, false
+	}
+	info, body, _ := strings.Cut(body[len(outputBlock):], "\n")
+	mode := strings.TrimSpace(info)
+	if mode == "" {
+		mode = defaultMode
+	}
+	prefix, ok := outputAnnotations[mode]
+	if !ok {
+		return "", s, false
+	}
+	end := strings.Index(body, "```")
+	if end < 0 {
+		return "", s, false
+	}
+	return prefix + strconv.Quote(strings.Trim(body[:end], "\n")), body[end+len("```"):], true
+}
+
+// cutStdinBlock cuts a stdin block that follows the command. Returns the annotation with the stdin of the command.
+// A stdin block can only be separated from the command with spaces, newlines and an output block
+func cutStdinBlock(s string) (annotation, rest string, ok bool) {
+	if !strings.HasPrefix(strings.TrimLeft(s, " \t\n"), stdinBlock+"\n") {
+		return "", s, false
+	}
+	return cutStdinPayload(s)
+}
 
-		if blockEnd = skipBlocks(s[offset:], end); blockEnd < end {
+// cutStdinLine cuts the stdin annotation without args from the annotations of the block. Such annotation means
+// that the following code block is the stdin of the command
+func cutStdinLine(block string) (rest string, ok bool) {
+	lines := strings.Split(block, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, AnnotationPrefix) {
 			break
 		}
+		if strings.TrimSpace(line) == strings.TrimSpace(stdinAnnotation) {
+			return strings.Join(append(lines[:i:i], lines[i+1:]...), "\n"), true
+		}
+	}
+	return block, false
+}
+
+// cutStdinPayload cuts a code block of any language that follows the command. Returns the annotation with the stdin
+// of the command. The code block can only be separated from the command with spaces and newlines
+func cutStdinPayload(s string) (annotation, rest string, ok bool) {
+	body := strings.TrimLeft(s, " \t\n")
+	if !strings.HasPrefix(body, "```") {
+		return "", s, false
+	}
+	_, body, ok = strings.Cut(body[len("```"):], "\n")
+	if !ok {
+		return "", s, false
+	}
+	end := strings.Index(body, "```")
+	if end < 0 {
+		return "", s, false
 	}
-	return s[:end+offset]
+	payload := body[:end]
+	if strings.HasPrefix(payload, linesAnnotation) {
+		_, payload, _ = strings.Cut(payload, "\n")
+	}
+	return stdinAnnotation + strconv.Quote(strings.Trim(payload, "\n")), body[end+len("```"):], true
 }
 
-func skipBlocks(s string, sectionEnd int) (end int) {
-	const blockDelim = "```"
+// cutScenarios cuts level 2 sections that have own Run or Cleanup sections from the source
+func (p *Parser) cutScenarios(s string) (rest string, scenarios []string) {
+	var restLines, current []string
+	inBlock := false
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		section := strings.Join(current, "\n")
+		if p.section(SectionRun, section) != "" || p.section(SectionCleanup, section) != "" {
+			scenarios = append(scenarios, section)
+		} else {
+			restLines = append(restLines, current...)
+		}
+		current = nil
+	}
 
-	for start := strings.Index(s[end:], blockDelim); start > 0; start = strings.Index(s[end:], blockDelim) {
-		if start += end + len(blockDelim); start > sectionEnd {
-			return end
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inBlock = !inBlock
+		}
+		if !inBlock && isHeading(line, 1, 2) {
+			flush()
+			if isHeading(line, 2, 2) && !p.isSection(strings.TrimSpace(strings.TrimPrefix(line, "##"))) {
+				current = []string{}
+			}
+		}
+		if current != nil {
+			current = append(current, line)
+			continue
 		}
+		restLines = append(restLines, line)
+	}
+	flush()
+
+	return strings.Join(restLines, "\n"), scenarios
+}
+
+// isHeading returns true if the line is a heading of a level from minLevel to maxLevel
+func isHeading(line string, minLevel, maxLevel int) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	return level >= minLevel && level <= maxLevel && strings.HasPrefix(line[level:], " ")
+}
+
+// checkBlocks returns an error if a code block with commands is not under a heading of the sections that are run or ignored.
+// firstLine is the number of the first line of the source in the file
+func (p *Parser) checkBlocks(source string, firstLine int, languages []string) error {
+	lines := strings.Split(source, "\n")
+	inBlock, heading := false, ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inBlock = !inBlock
+			if !inBlock {
+				continue
+			}
+			lang, _, _ := cutCondition(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))
+			runnable := i+1 < len(lines) && strings.HasPrefix(lines[i+1], interpreterAnnotation)
+			for _, l := range languages {
+				runnable = runnable || lang == l
+			}
+			if runnable && !p.isRunSection(heading) {
+				if heading == "" {
+					return errors.Errorf("line %v: %v block is not under any heading, its commands are not run", firstLine+i, lang)
+				}
+				return errors.Errorf("line %v: %v block is under %q heading that is not a Run, Cleanup, Assert or Verify section, its commands are not run",
+					firstLine+i, lang, heading)
+			}
+			continue
+		}
+		if !inBlock && isHeading(line, 1, 6) {
+			heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+	}
+	return nil
+}
+
+// markBlocks moves the condition declared after the language of the code blocks with commands to the if annotation.
+// If withLines is set, the lines annotation is added before it, so the generated commands can be traced back to the markdown.
+// The annotations follow the interpreter annotation, that must be the first line of the block.
+// Returns ParseError if the condition or the captured variable is invalid. firstLine is the number of the first line of the source in the file
+func markBlocks(source string, firstLine int, languages []string, withLines bool) (string, error) {
+	lines := strings.Split(source, "\n")
+	result := make([]string, 0, len(lines))
+	inBlock, runnable := false, false
+	var begin, insert int
+	var annotations []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "```") {
+			result = append(result, line)
+			continue
+		}
+		inBlock = !inBlock
+		if !inBlock {
+			if runnable && withLines {
+				annotations = append([]string{fmt.Sprintf("%v%v-%v", linesAnnotation, firstLine+begin, firstLine+i)}, annotations...)
+			}
+			if runnable {
+				result = append(result[:insert], append(annotations, result[insert:]...)...)
+			}
+			result = append(result, line)
+			continue
+		}
+		lang, cond, capture := cutCondition(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))
+		begin, insert = i, len(result)+1
+		runnable, annotations = false, nil
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], interpreterAnnotation) {
+			runnable, insert = true, insert+1
+		}
+		for _, l := range languages {
+			runnable = runnable || lang == l
+		}
+		if runnable && (cond != "" || capture != "") {
+			line = line[:strings.Index(line, "```")] + "```" + lang
+		}
+		if runnable && cond != "" {
+			if err := checkCondition(cond); err != nil {
+				return "", &ParseError{Line: firstLine + i, Msg: err.Error()}
+			}
+			annotations = append(annotations, ifAnnotation+cond)
+		}
+		if runnable && capture != "" {
+			if err := checkCapture(capture); err != nil {
+				return "", &ParseError{Line: firstLine + i, Msg: err.Error()}
+			}
+			annotations = append(annotations, captureAnnotation+capture)
+		}
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+// withRetry adds the retry annotation to the blocks that don't have it
+func withRetry(blocks []string) []string {
+	for i, block := range blocks {
+		if !hasAnnotationLine(block, retryAnnotation) {
+			blocks[i] = retryAnnotation + "\n" + block
+		}
+	}
+	return blocks
+}
+
+// hasAnnotationLine returns true if the annotation lines at the beginning of the block contain the line
+func hasAnnotationLine(block, line string) bool {
+	for strings.HasPrefix(block, AnnotationPrefix) {
+		var current string
+		current, block, _ = strings.Cut(block, "\n")
+		if strings.TrimSpace(current) == line {
+			return true
+		}
+	}
+	return false
+}
+
+// cutCondition cuts the condition of the block, e.g. `if:CLUSTER_TYPE=kind`, and the variable its stdout is captured to,
+// e.g. `capture:POD_NAME`, from the info string of the code block. Returns the info string without them and the args
+// of the if and capture annotations
+func cutCondition(info string) (rest, cond, capture string) {
+	rest, cond = cutInfoField(info, ifPrefix)
+	rest, capture = cutInfoField(rest, capturePrefix)
+	return rest, cond, capture
+}
+
+// cutInfoField cuts the field with the prefix that follows the language from the info string of the code block
+func cutInfoField(info, prefix string) (rest, value string) {
+	fields := strings.Fields(info)
+	for i, field := range fields {
+		if i > 0 && strings.HasPrefix(field, prefix) {
+			return strings.Join(append(fields[:i:i], fields[i+1:]...), " "), strings.TrimPrefix(field, prefix)
+		}
+	}
+	return info, ""
+}
+
+// sectionKind returns the kind of the section of the heading title or an empty string if the heading is not a section.
+// By default a title that begins with the section name is the section, e.g. Run the demo, like the headings have always been read.
+// With strict parsing titles are matched as a whole ignoring the case, so the blocks under a typo like Runn fail the check
+// instead of being run
+func (p *Parser) sectionKind(title string) string {
+	if len(p.sections) != 0 {
+		return p.sections[strings.ToLower(title)]
+	}
+	for kind, heading := range defaultSections {
+		if strings.EqualFold(title, heading) || !p.strict && strings.HasPrefix(title, heading) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// isRunSection returns true if the commands of the section are run or deliberately ignored
+func (p *Parser) isRunSection(title string) bool {
+	switch p.sectionKind(title) {
+	case SectionRun, SectionCleanup, SectionAssert, SectionVerify, SectionIgnore:
+		return true
+	}
+	return false
+}
+
+func (p *Parser) isSection(title string) bool {
+	return p.sectionKind(title) != ""
+}
+
+// section returns the source of the sections of the kind. Without configured sections, it's the first section of the kind.
+// Otherwise, bodies of all the headings mapped to the kind are concatenated in the order of the file
+func (p *Parser) section(kind, s string) string {
+	var result []string
+	inBlock, inSection, found := false, false, false
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inBlock = !inBlock
+		}
+		if !inBlock && isHeading(line, 1, 6) {
+			if len(p.sections) == 0 && found {
+				break
+			}
+			title := strings.TrimSpace(strings.TrimLeft(line, "#"))
+			inSection = p.sectionKind(title) == kind
+			found = found || inSection
+			continue
+		}
+		if inSection {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+func (p *Parser) parseLinks(s string) []string {
+	var result []string
+	links := p.linkRegex.FindAllString(s, -1)
+	for _, link := range links {
+		start := strings.IndexRune(link, '(') + len("(")
+		end := strings.IndexRune(link, ')')
+		result = append(result, link[start:end])
+	}
+	return result
+}
 
-		if end = strings.Index(s[start:], blockDelim); end < 0 {
-			return len(s)
+// parseRequires returns the links of the requires section and the links marked as optional, e.g. - [Foo](../foo) (optional)
+func (p *Parser) parseRequires(s string) (requires, optional []string) {
+	for _, line := range strings.Split(s, "\n") {
+		links := p.parseLinks(line)
+		requires = append(requires, links...)
+		if strings.HasSuffix(strings.TrimSpace(line), optionalMark) {
+			optional = append(optional, links...)
 		}
-		end += start + len(blockDelim)
 	}
-	return end
+	return requires, optional
 }
@@ -0,0 +1,158 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// snippetAnnotation is the first line of the code blocks that define snippets, its arg is the name of the snippet
+	snippetAnnotation = "# gotestmd:snippet "
+	// includeSnippetAnnotation is a line of a code block that is replaced with the commands of the snippet
+	includeSnippetAnnotation = "# gotestmd:include-snippet "
+)
+
+// Snippets are the commands shared by the examples by the names of the snippets
+type Snippets map[string]string
+
+// LoadSnippets reads the snippets defined in the markdown files. A snippet is a code block that begins with
+// # gotestmd:snippet <name> line, the rest of the block are its commands. Snippets can include other snippets.
+// Returns an error if a name is defined twice, an included snippet is not defined or a snippet includes itself
+func LoadSnippets(files ...string) (Snippets, error) {
+	result := Snippets{}
+	defined := map[string]string{}
+	for _, file := range files {
+		bytes, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read snippets")
+		}
+		source := strings.ReplaceAll(string(bytes), "\r\n", "\n")
+		var parseErr *ParseError
+		if err := checkFences(source, 1); errors.As(err, &parseErr) {
+			parseErr.File = file
+			return nil, parseErr
+		}
+		lines := strings.Split(normalizeFences(source, ""), "\n")
+		for i := 0; i < len(lines); i++ {
+			if !strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+				continue
+			}
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+				end++
+			}
+			if end > i+1 && strings.HasPrefix(lines[i+1], snippetAnnotation) {
+				name := strings.TrimSpace(strings.TrimPrefix(lines[i+1], snippetAnnotation))
+				if previous, ok := defined[name]; ok {
+					return nil, &ParseError{File: file, Line: i + 2, Msg: fmt.Sprintf("snippet %v is already defined in %v", name, previous)}
+				}
+				defined[name] = fmt.Sprintf("%v:%v", file, i+2)
+				result[name] = strings.TrimSpace(strings.Join(lines[i+2:end], "\n"))
+			}
+			i = end
+		}
+	}
+	var names []string
+	for name := range result {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := result.check(name, nil); err != nil {
+			return nil, errors.Wrapf(err, "snippet %v defined at %v", name, defined[name])
+		}
+	}
+	return result, nil
+}
+
+// check returns an error if the snippet includes an undefined snippet or itself. path are the snippets that include it
+func (s Snippets) check(name string, path []string) error {
+	for _, prev := range path {
+		if prev == name {
+			return errors.Errorf("snippet includes itself: %v", strings.Join(append(path, name), " -> "))
+		}
+	}
+	commands, ok := s[name]
+	if !ok {
+		return errors.Errorf("snippet %v is not defined", name)
+	}
+	for _, line := range strings.Split(commands, "\n") {
+		if included, ok := cutIncludeSnippet(line); ok {
+			if err := s.check(included, append(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkIncludes returns ParseError if a code block of the source includes a snippet that is not defined. firstLine is
+// the number of the first line of the source in the file
+func (s Snippets) checkIncludes(source string, firstLine int) error {
+	inBlock := false
+	for i, line := range strings.Split(source, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inBlock = !inBlock
+			continue
+		}
+		if name, ok := cutIncludeSnippet(line); ok && inBlock {
+			if _, ok := s[name]; !ok {
+				return &ParseError{Line: firstLine + i, Msg: fmt.Sprintf("snippet %v is not defined", name)}
+			}
+		}
+	}
+	return nil
+}
+
+// expand replaces the lines of the block that include snippets with the commands of the snippets, indented as the lines.
+// The snippets must be checked, so they are defined and don't include themselves
+func (s Snippets) expand(block string) string {
+	if !strings.Contains(block, includeSnippetAnnotation) {
+		return block
+	}
+	lines := strings.Split(block, "\n")
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		name, ok := cutIncludeSnippet(line)
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		for _, command := range strings.Split(s.expand(s[name]), "\n") {
+			result = append(result, indent+command)
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+// cutIncludeSnippet returns the name of the snippet if the line includes it
+func cutIncludeSnippet(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, includeSnippetAnnotation) {
+		return "", false
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(trimmed, includeSnippetAnnotation))
+	return name, name != ""
+}
@@ -19,39 +19,94 @@
 package main_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/networkservicemesh/gotestmd/cmd/gotestmd"
 	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
 )
 
+// installOnce installs gotestmd from the sources once for all the tests, installErr is the error of the installation
+var (
+	installOnce sync.Once
+	installErr  error
+)
+
+// newRunner returns a runner of the tests with gotestmd installed from the sources. The runner is closed when the test finishes
+func newRunner(t *testing.T) *bash.Bash {
+	t.Helper()
+	runner, err := bash.New()
+	require.NoError(t, err)
+	t.Cleanup(runner.Close)
+	installOnce.Do(func() {
+		_, stderr, exitCode, err := runner.Run("go install ./...")
+		if err == nil && exitCode != 0 {
+			err = fmt.Errorf("go install failed with exit code %v: %v", exitCode, stderr)
+		}
+		installErr = err
+	})
+	require.NoError(t, installErr)
+	return runner
+}
+
+// run runs the command with the runner and fails the test if the command fails. Returns stdout of the command
+func run(t *testing.T, runner *bash.Bash, cmd string) string {
+	t.Helper()
+	stdout, stderr, exitCode, err := runner.Run(cmd)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, "%v\n%v", cmd, stdout+stderr)
+	return stdout
+}
+
 func TestExamples(t *testing.T) {
 	t.Cleanup(func() {
 		_ = os.RemoveAll("test-examples")
 	})
-	runner, err := bash.New()
-	require.NoError(t, err)
-	defer runner.Close()
-	_, _, exitCode, err := runner.Run("go install ./...")
-	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	runner := newRunner(t)
 
-	_, _, exitCode, err = runner.Run("gotestmd examples/ test-examples/")
-	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	run(t, runner, "gotestmd examples/ test-examples/")
 
-	_, _, exitCode, err = runner.Run(`cat > test-examples/entry_point_test.go <<EOF
+	_, _, exitCode, err := runner.Run(`cat > test-examples/entry_point_test.go <<EOF
 package suites
 
 import (
 	"testing"
 
+	"github.com/networkservicemesh/gotestmd/test-examples/allfeatures"
+	"github.com/networkservicemesh/gotestmd/test-examples/allowfail"
+	"github.com/networkservicemesh/gotestmd/test-examples/assert"
+	"github.com/networkservicemesh/gotestmd/test-examples/capture"
+	"github.com/networkservicemesh/gotestmd/test-examples/conditional"
+	"github.com/networkservicemesh/gotestmd/test-examples/env"
+	"github.com/networkservicemesh/gotestmd/test-examples/envfile"
+	"github.com/networkservicemesh/gotestmd/test-examples/expectfail"
+	"github.com/networkservicemesh/gotestmd/test-examples/fences"
 	"github.com/networkservicemesh/gotestmd/test-examples/helloworld"
+	"github.com/networkservicemesh/gotestmd/test-examples/interpreter"
+	"github.com/networkservicemesh/gotestmd/test-examples/matrix"
+	"github.com/networkservicemesh/gotestmd/test-examples/nochdir"
+	"github.com/networkservicemesh/gotestmd/test-examples/ordered"
+	"github.com/networkservicemesh/gotestmd/test-examples/output"
 	"github.com/networkservicemesh/gotestmd/test-examples/producer/consumer2"
 	"github.com/networkservicemesh/gotestmd/test-examples/producer/consumer3"
+	"github.com/networkservicemesh/gotestmd/test-examples/reversecleanup"
+	"github.com/networkservicemesh/gotestmd/test-examples/scenarios"
+	"github.com/networkservicemesh/gotestmd/test-examples/sections"
+	"github.com/networkservicemesh/gotestmd/test-examples/stdin"
+	"github.com/networkservicemesh/gotestmd/test-examples/teardown"
 	"github.com/networkservicemesh/gotestmd/test-examples/tree"
+	"github.com/networkservicemesh/gotestmd/test-examples/verify"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -60,121 +115,2437 @@ func TestEntryPoint(t *testing.T) {
 	suite.Run(t, new(tree.Suite))
 	suite.Run(t, new(consumer2.Suite))
 	suite.Run(t, new(consumer3.Suite))
+	suite.Run(t, new(matrix.Suite))
+	suite.Run(t, new(scenarios.Suite))
+	suite.Run(t, new(interpreter.Suite))
+	suite.Run(t, new(env.Suite))
+	suite.Run(t, new(nochdir.Suite))
+	suite.Run(t, new(envfile.Suite))
+	suite.Run(t, new(allfeatures.Suite))
+	suite.Run(t, new(output.Suite))
+	suite.Run(t, new(capture.Suite))
+	suite.Run(t, new(ordered.Suite))
+	suite.Run(t, new(stdin.Suite))
+	suite.Run(t, new(reversecleanup.Suite))
+	suite.Run(t, new(allowfail.Suite))
+	suite.Run(t, new(expectfail.Suite))
+	suite.Run(t, new(conditional.Suite))
+	suite.Run(t, new(assert.Suite))
+	suite.Run(t, new(sections.FirstSuite))
+	suite.Run(t, new(sections.SecondPartSuite))
+	suite.Run(t, new(teardown.Suite))
+	suite.Run(t, new(verify.Suite))
+	suite.Run(t, new(fences.Suite))
 }
 EOF
 `)
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
 
-	_, _, exitCode, err = runner.Run("go test ./test-examples/... ")
+	run(t, runner, "go test ./test-examples/... ")
+}
+
+func TestCommandTimeout(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-command-timeout")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "timeout"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "timeout", "README.md"),
+		[]byte("# Run\n```bash\necho fast\n```\n```bash\nsleep 10\n```\n"), os.ModePerm))
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-command-timeout/ --makefile --command-timeout=1s")
+	source, err := os.ReadFile("test-command-timeout/timeout/suite.gen.go")
 	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	require.Contains(t, string(source), "r.SetCommandTimeout(1 * time.Second)")
+
+	// the fast command passes, the slow one fails the test without waiting for it
+	start := time.Now()
+	stdout, _, exitCode, err := runner.Run("go test ./test-command-timeout/... -v")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, `command "sleep 10" didn't finish in 1s`)
+	require.True(t, time.Since(start) < 10*time.Second, time.Since(start))
+}
+
+func TestStandaloneTests(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-standalone-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-standalone-examples/ --standalone-tests")
+
+	stdout, _, exitCode, err := runner.Run("go test ./test-standalone-examples/tree/ -run '^TestLeafC$' -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+	require.Contains(t, stdout, "--- PASS: TestLeafC")
+	require.NotContains(t, stdout, "TestLeafA")
+}
+
+func TestSuiteType(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-suite-type-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-suite-type-examples/ --suite-type='*Suite' --standalone-tests")
+
+	source, err := os.ReadFile("test-suite-type-examples/tree/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(source), "type TreeSuite struct")
+	require.Contains(t, string(source), "subtreeSuite subtree.SubtreeSuite")
+
+	stdout, _, exitCode, err := runner.Run("go test ./test-suite-type-examples/tree/... -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+	require.Contains(t, stdout, "--- PASS: TestLeafA")
+
+	_, _, exitCode, err = runner.Run("gotestmd examples/ test-suite-type-examples/ --suite-type='Foo Suite'")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func TestMakefile(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-makefile-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-makefile-examples/ --makefile")
+	// the targets of golang suites run the test functions written next to the suites
+	testFile, err := os.ReadFile("test-makefile-examples/producer/consumer2/suite.gen_test.go")
+	require.NoError(t, err)
+	require.Contains(t, string(testFile), "func TestGeneratedSuite(t *testing.T) {")
+
+	// required suites are run first
+	stdout, _, exitCode, err := runner.Run("make -C test-makefile-examples producer/consumer2")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+	require.Regexp(t, `(?s)ok .*/producer\s.*ok .*/producer/consumer2\s`, stdout)
+
+	run(t, runner, "gotestmd examples/ test-makefile-examples/ --bash --match=LeafA --makefile")
+
+	stdout, _, exitCode, err = runner.Run("make -C test-makefile-examples tree")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+	require.Contains(t, stdout, "I'm leaf A")
+}
+
+func TestSources(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-sources-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-sources-examples/ --sources")
+
+	source, err := os.ReadFile(filepath.Join("test-sources-examples", "sources.gen.json"))
+	require.NoError(t, err)
+	var sources struct {
+		Suites []struct {
+			Type    string
+			Dir     string
+			Cleanup []struct {
+				Command   string
+				File      string
+				FirstLine int
+				LastLine  int
+			}
+			Tests []struct {
+				Name string
+				Run  []struct {
+					File      string
+					FirstLine int
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(source, &sources))
+	var found bool
+	for _, s := range sources.Suites {
+		if s.Dir != "examples/Tree" {
+			continue
+		}
+		found = true
+		require.Equal(t, "Suite", s.Type)
+		require.Len(t, s.Cleanup, 1)
+		require.Equal(t, "rm -rf ${MY_TEST_DIR}", s.Cleanup[0].Command)
+		require.Equal(t, "examples/Tree/README.md", s.Cleanup[0].File)
+		require.Equal(t, 41, s.Cleanup[0].FirstLine)
+		require.Equal(t, 43, s.Cleanup[0].LastLine)
+		require.Equal(t, "TestLeafA", s.Tests[0].Name)
+		require.Equal(t, "examples/Tree/LeafA/README.md", s.Tests[0].Run[0].File)
+		require.Equal(t, 7, s.Tests[0].Run[0].FirstLine)
+	}
+	require.True(t, found, string(source))
+
+	// generated code links the commands to the same lines
+	suite, err := os.ReadFile(filepath.Join("test-sources-examples", "tree", "suite.gen.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "// from: examples/Tree/README.md:41\nr.Run(`rm -rf ${MY_TEST_DIR}`)")
+	require.Contains(t, string(suite), "// from: examples/Tree/LeafA/README.md:7\nr.Run(`echo \"I'm leaf A\"`)")
+
+	// bash scripts don't add own commands to the source map
+	run(t, runner, "gotestmd examples/ test-sources-examples/ --sources --bash --match=LeafA")
+	source, err = os.ReadFile(filepath.Join("test-sources-examples", "sources.gen.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(source, &sources))
+	found = false
+	for _, s := range sources.Suites {
+		if s.Dir != "examples/Tree" {
+			continue
+		}
+		found = true
+		require.Len(t, s.Cleanup, 1)
+		require.Equal(t, 41, s.Cleanup[0].FirstLine)
+	}
+	require.True(t, found, string(source))
+}
+
+func TestTransform(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-transform-examples")
+	})
+	var placeholders bool
+	transform := gotestmd.WithTransform(func(cmd string) string {
+		// the transforms see the placeholders of the matrix before they are substituted
+		placeholders = placeholders || strings.Contains(cmd, "{{matrix:driver}}")
+		return strings.ReplaceAll(cmd, "I'm leaf", "transformed leaf")
+	})
+
+	cmd := gotestmd.New(transform)
+	cmd.SetArgs([]string{"examples/", "test-transform-examples/", "-q"})
+	require.NoError(t, cmd.Execute())
+	source, err := os.ReadFile("test-transform-examples/tree/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(source), `echo "transformed leaf A"`)
+	require.True(t, placeholders)
+
+	cmd = gotestmd.New(transform)
+	cmd.SetArgs([]string{"examples/", "test-transform-examples/", "-q", "--bash", "--match=LeafA"})
+	require.NoError(t, cmd.Execute())
+	source, err = os.ReadFile("test-transform-examples/tree/suite.gen.sh")
+	require.NoError(t, err)
+	require.Contains(t, string(source), `echo "transformed leaf A"`)
 }
 
 func TestBashSuite(t *testing.T) {
 	t.Cleanup(func() {
 		_ = os.RemoveAll("test-bash-examples")
 	})
-	runner, err := bash.New()
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=tree")
+
+	run(t, runner, "./test-bash-examples/tree/suite.gen.sh setup")
+
+	run(t, runner, "./test-bash-examples/tree/suite.gen.sh cleanup")
+}
+
+func TestBashTest(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=LeafA")
+
+	run(t, runner, "./test-bash-examples/tree/suite.gen.sh setup")
+
+	run(t, runner, "./test-bash-examples/tree/suite.gen.sh testLeafA")
+
+	run(t, runner, "./test-bash-examples/tree/suite.gen.sh cleanup")
+}
+
+func TestBashRetry(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	// check that retry package fails without retry
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=retry")
+
+	_, _, exitCode, err := runner.Run("./test-bash-examples/retry/suite.gen.sh setup")
 	require.NoError(t, err)
-	defer runner.Close()
-	_, _, exitCode, err := runner.Run("go install ./...")
+	require.NotZero(t, exitCode)
+
+	run(t, runner, "./test-bash-examples/retry/suite.gen.sh cleanup")
+
+	// retry package should succeed when retry is enabled
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=retry --retry")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/retry/suite.gen.sh setup")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "attempt 2")
+
+	run(t, runner, "./test-bash-examples/retry/suite.gen.sh cleanup")
 
-	_, _, exitCode, err = runner.Run("gotestmd examples/ test-bash-examples/ --bash --match=tree")
+	// retry stops after the max number of attempts
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=retry --retry --retry-max-attempts=1")
+
+	stdout, _, exitCode, err = runner.Run("./test-bash-examples/retry/suite.gen.sh setup")
 	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, "attempts exhausted")
+
+	run(t, runner, "./test-bash-examples/retry/suite.gen.sh cleanup")
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/tree/suite.gen.sh setup")
+	// the env overrides the default of the script
+	stdout, _, exitCode, err = runner.Run("RETRY_MAX_ATTEMPTS=2 ./test-bash-examples/retry/suite.gen.sh setup")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "attempt 2")
+
+	run(t, runner, "./test-bash-examples/retry/suite.gen.sh cleanup")
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/tree/suite.gen.sh cleanup")
+	// the seed makes the random delays of the retries reproducible
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=retry --retry --retry-jitter=500ms")
+	delay := regexp.MustCompile(`retry in (\d+) ms`)
+	var delays []string
+	for i := 0; i < 2; i++ {
+		stdout, _, exitCode, err = runner.Run("RETRY_JITTER_SEED=7 ./test-bash-examples/retry/suite.gen.sh setup")
+		require.NoError(t, err)
+		require.Zero(t, exitCode)
+		match := delay.FindStringSubmatch(stdout)
+		require.NotNil(t, match, stdout)
+		delays = append(delays, match[1])
+
+		run(t, runner, "./test-bash-examples/retry/suite.gen.sh cleanup")
+	}
+	require.Equal(t, delays[0], delays[1])
+	ms, err := strconv.Atoi(delays[0])
 	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	require.True(t, ms >= 1000 && ms <= 1500, ms)
 }
 
-func TestBashTest(t *testing.T) {
+func TestBashRetryTimeout(t *testing.T) {
 	t.Cleanup(func() {
 		_ = os.RemoveAll("test-bash-examples")
 	})
-	runner, err := bash.New()
+	input := t.TempDir()
+	command := "# Run\n```bash\necho retried\n```\n"
+	sources := map[string]string{
+		"Default":  command,
+		"Override": "<!-- # gotestmd:retry-timeout 600 -->\n" + command,
+		"Visible":  "# gotestmd:retry-timeout 30\n\n" + command,
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --retry --retry-timeout=2m")
 	require.NoError(t, err)
-	defer runner.Close()
-	_, _, exitCode, err := runner.Run("go install ./...")
+	require.Zero(t, exitCode, stderr)
+
+	// the directive overrides the flag only for its suite
+	for dir, timeout := range map[string]string{"default": "120", "override": "600", "visible": "30"} {
+		source, err := os.ReadFile(filepath.Join("test-bash-examples", dir, "suite.gen.sh"))
+		require.NoError(t, err)
+		require.Contains(t, string(source), `timeout="${RETRY_TIMEOUT_SECONDS:-`+timeout+`}"`)
+		require.NotContains(t, string(source), "gotestmd:retry-timeout")
+	}
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/override/suite.gen.sh setup")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "retried")
 
-	_, _, exitCode, err = runner.Run("gotestmd examples/ test-bash-examples/ --bash --match=LeafA")
+	// the timeout must be a number of seconds
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Override", "README.md"),
+		[]byte("<!-- # gotestmd:retry-timeout 10m -->\n"+command), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --retry")
 	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "Override", "README.md")+`:1: retry timeout "10m" is not a positive number of seconds`)
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/tree/suite.gen.sh setup")
+	// the default timeout is written in seconds too
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --retry --retry-timeout=500ms")
 	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "flag --retry-timeout can't be less than 1s")
+}
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/tree/suite.gen.sh testLeafA")
+func TestBashRetryAnnotation(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=flaky")
+
+	// only the annotated command is retried
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/flaky/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "attempt 2")
+	require.Equal(t, 1, strings.Count(stdout, "===== next command ====="))
+}
+
+func TestBashNoMatchesFound(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd examples/ test-bash-examples/ --bash --match=UnmatchablePattern")
+	require.Contains(t, stderr, "No matches found for pattern: UnmatchablePattern")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func TestBashRunAll(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/tree/suite.gen.sh cleanup")
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=LeafA")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/tree/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "I'm leaf A")
+	require.Contains(t, stdout, "cleanup suite")
+
+	// cleanup should be called even if setup fails
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=retry")
+
+	stdout, _, exitCode, err = runner.Run("./test-bash-examples/retry/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, "cleanup suite")
 }
 
-func TestBashRetry(t *testing.T) {
+func TestBashEnvFile(t *testing.T) {
 	t.Cleanup(func() {
 		_ = os.RemoveAll("test-bash-examples")
 	})
-	runner, err := bash.New()
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=envfile")
+
+	run(t, runner, "./test-bash-examples/envfile/suite.gen.sh run_all")
+
+	// a missing env file fails setup by default
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=tree --env-file=missing.env")
+
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/tree/suite.gen.sh setup")
 	require.NoError(t, err)
-	defer runner.Close()
-	_, _, exitCode, err := runner.Run("go install ./...")
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "env file missing.env doesn't exist")
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=tree --env-file=missing.env --env-file-missing=warn")
+
+	_, stderr, exitCode, err = runner.Run("./test-bash-examples/tree/suite.gen.sh setup")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stderr, "warning: env file missing.env doesn't exist")
 
-	// check that retry package fails without retry
-	_, _, exitCode, err = runner.Run("gotestmd examples/ test-bash-examples/ --bash --match=retry")
+	run(t, runner, "./test-bash-examples/tree/suite.gen.sh cleanup")
+}
+
+func TestBashTiming(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=LeafA --timing")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/tree/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Regexp(t, `\+ echo "I'm leaf A"\nI'm leaf A\ntook \d+s: echo "I'm leaf A"`, stdout)
+
+	// the echoes don't hide the status of the failed command
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "slow"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "slow", "README.md"), []byte("# Run\n```bash\nfalse\n```\n```bash\necho unreachable\n```\n"), os.ModePerm))
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=slow --timing")
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/retry/suite.gen.sh setup")
+	stdout, _, exitCode, err = runner.Run("./test-bash-examples/slow/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.NotZero(t, exitCode)
+	require.Regexp(t, `\+ false\ntook \d+s: false`, stdout)
+	require.NotContains(t, stdout, "unreachable")
+}
+
+func TestBashOutput(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=output")
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/retry/suite.gen.sh cleanup")
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/output/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "hello\nworld")
 
-	// retry package should succeed when retry is enabled
-	_, _, exitCode, err = runner.Run("gotestmd examples/ test-bash-examples/ --bash --match=retry --retry")
+	// unexpected output fails the script
+	run(t, runner, "sed -i 's/\\^started/^finished/' test-bash-examples/output/suite.gen.sh")
+
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/output/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "unexpected output, expected: ^finished at [0-9]+$")
+}
+
+func TestBashOutputModes(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Default"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Override"), os.ModePerm))
+	command := "```bash\nprintf 'a   b \\n'\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Default", "README.md"),
+		[]byte("---\noutput: normalized\n---\n# Default\n## Run\n"+command+"```output\na b\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Override", "README.md"),
+		[]byte("---\noutput: normalized\n---\n# Override\n## Run\n"+command+"```output exact\na b\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=.")
+
+	// the front matter declares the default mode of the output blocks
+	run(t, runner, "./test-bash-examples/default/suite.gen.sh run_all")
+
+	// the mode of the block takes precedence
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/override/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "unexpected output, expected: a b")
+
+	// normalization doesn't hide the changes of the content
+	run(t, runner, `sed -i "s/gotestmd_expected='a b'/gotestmd_expected='a c'/" test-bash-examples/default/suite.gen.sh`)
+	_, _, exitCode, err = runner.Run("./test-bash-examples/default/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func TestBashStdin(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=stdin")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/stdin/suite.gen.sh run_all </dev/null")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "the answer is yes")
+	require.Contains(t, stdout, "2\n")
+	require.Contains(t, stdout, "done")
 
-	stdout, _, exitCode, err := runner.Run("./test-bash-examples/retry/suite.gen.sh setup")
+	// the interpreter reads the block from stdin, so the stdin can't be passed to it
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "interpreter"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "interpreter", "README.md"),
+		[]byte("# Run\n```python\n# gotestmd:interpreter python3\nprint(input())\n```\n```stdin\nyes\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=interpreter")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "stdin can't be passed to a block run with python3 interpreter")
+}
+
+func TestBashReverseCleanup(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=reversecleanup")
+
+	source, err := os.ReadFile("test-bash-examples/reversecleanup/suite.gen.sh")
+	require.NoError(t, err)
+	require.Regexp(t, `(?s)rmdir resources/nested.*rmdir resources\n`, string(source))
+
+	run(t, runner, "./test-bash-examples/reversecleanup/suite.gen.sh run_all")
+	require.NoDirExists(t, "examples/ReverseCleanup/resources")
+}
+
+func TestBashTeardown(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=Child")
+
+	source, err := os.ReadFile("test-bash-examples/teardown/suite.gen.sh")
+	require.NoError(t, err)
+	require.Regexp(t, `(?s)cleanup\(\) \{.*cleanup_testChild\n.*cleanup_main\n`, string(source))
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/teardown/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
-	require.Contains(t, stdout, "attempt 2")
+	require.Regexp(t, `(?s)cleanup test Child.*cleanup suite`, stdout)
+	require.NoDirExists(t, "examples/Teardown/resources")
+
+	// the failed test tears down before the suite too
+	stdout, _, exitCode, err = runner.Run("TEARDOWN_FAIL=1 ./test-bash-examples/teardown/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Regexp(t, `(?s)cleanup test Child.*cleanup suite`, stdout)
+	require.NoDirExists(t, "examples/Teardown/resources")
+}
+
+func TestBashAllowFail(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=allowfail")
 
-	_, _, exitCode, err = runner.Run("./test-bash-examples/retry/suite.gen.sh cleanup")
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/allowfail/suite.gen.sh run_all")
 	require.NoError(t, err)
 	require.Zero(t, exitCode)
+	require.Contains(t, stderr, "allowed to fail: rmdir missing-resources")
+	require.NoDirExists(t, "examples/AllowFail/resources")
 }
 
-func TestBashNoMatchesFound(t *testing.T) {
+func TestBashExpectFail(t *testing.T) {
 	t.Cleanup(func() {
 		_ = os.RemoveAll("test-bash-examples")
 	})
-	runner, err := bash.New()
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=expectfail")
+
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/expectfail/suite.gen.sh run_all")
 	require.NoError(t, err)
-	defer runner.Close()
-	_, _, exitCode, err := runner.Run("go install ./...")
+	require.Zero(t, exitCode, stderr)
+
+	// an exit code that is not a positive number fails the generation instead of expecting any failure
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "invalid"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "invalid", "README.md"),
+		[]byte("# Run\n```bash\n# gotestmd:expect-fail abc\nfalse\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=invalid")
 	require.NoError(t, err)
-	require.Zero(t, exitCode)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, `exit code of expect-fail annotation "abc" is not a positive number`)
+}
 
-	_, stderr, exitCode, err := runner.Run("gotestmd examples/ test-bash-examples/ --bash --match=UnmatchablePattern")
-	require.Contains(t, stderr, "No matches found for pattern: UnmatchablePattern")
+func TestBashConditional(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=conditional")
+
+	stdout, stderr, exitCode, err := runner.Run("./test-bash-examples/conditional/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stdout, "running on the default platform")
+	require.NotContains(t, stdout, "running on kind")
+
+	stdout, stderr, exitCode, err = runner.Run("CONDITIONAL_PLATFORM=kind ./test-bash-examples/conditional/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stdout, "running on kind")
+	require.NotContains(t, stdout, "running on the default platform")
+
+	// a malformed condition fails the generation instead of running the block unconditionally
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "invalid"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "invalid", "README.md"),
+		[]byte("# Run\n```bash if:PLATFORM-kind\necho kind\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=invalid")
 	require.NoError(t, err)
 	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "invalid", "README.md")+`:2: invalid condition "PLATFORM-kind", expected NAME=VALUE`)
+}
+
+func TestBashCapture(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	for _, flags := range []string{"", " --retry"} {
+		run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=^Use$"+flags)
+
+		stdout, stderr, exitCode, err := runner.Run("./test-bash-examples/capture/suite.gen.sh run_all")
+		require.NoError(t, err)
+		require.Zero(t, exitCode, stdout+stderr)
+		require.Contains(t, stdout, "captured")
+	}
+
+	// an invalid variable fails the generation instead of dropping the capture
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "invalid"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "invalid", "README.md"),
+		[]byte("---\nshell: bash\n---\n# Run\n```bash capture:POD-NAME\necho pod\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=invalid")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "invalid", "README.md")+`:5: invalid variable "POD-NAME" to capture the output to`)
+}
+
+func TestBashSensitive(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	for _, flags := range []string{"", " --retry", " --retry --timing"} {
+		run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=sensitive"+flags)
+
+		// the secret is neither echoed nor traced, the commands after the sensitive ones are traced again
+		stdout, stderr, exitCode, err := runner.Run("bash -x ./test-bash-examples/sensitive/suite.gen.sh run_all")
+		require.NoError(t, err)
+		require.Zero(t, exitCode, stdout+stderr)
+		require.Contains(t, stdout, "token is set")
+		require.NotContains(t, stdout+stderr, "s3cr3t-t0k3n")
+		require.Contains(t, stderr, "+ unset SENSITIVE_TOKEN")
+	}
+}
+
+func TestBashAssert(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=Child")
+
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/assert/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+
+	_, stderr, exitCode, err = runner.Run("ASSERT_FAIL=1 ./test-bash-examples/assert/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, `assertion failed: [ -z "${ASSERT_FAIL:-}" ]`)
+	require.NoDirExists(t, "examples/Assert/resources")
+}
+
+func TestBashVerify(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	// only the commands of verify section are retried
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=verify")
+	script, err := os.ReadFile("test-bash-examples/verify/suite.gen.sh")
+	require.NoError(t, err)
+	require.Contains(t, string(script), `try_run 'echo check >> deployment-checks && [ "$(wc -l < deployment-checks)" -ge 3 ]'`)
+	require.NotContains(t, string(script), "try_run 'rm -f deployment-checks'")
+
+	stdout, stderr, exitCode, err := runner.Run("./test-bash-examples/verify/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+	require.NoFileExists(t, "examples/Verify/deployment-checks")
+}
+
+func TestBashIndentedBlocks(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	// indented blocks are not run by default
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=indentedblocks")
+	script, err := os.ReadFile("test-bash-examples/indentedblocks/suite.gen.sh")
+	require.NoError(t, err)
+	require.NotContains(t, string(script), "indented.txt")
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=indentedblocks --indented-blocks")
+	script, err = os.ReadFile("test-bash-examples/indentedblocks/suite.gen.sh")
+	require.NoError(t, err)
+	require.Contains(t, string(script), "echo \"indented\" > indented.txt")
+	require.NotContains(t, string(script), "not-a-command.txt")
+
+	_, stderr, exitCode, err := runner.Run("./test-bash-examples/indentedblocks/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NoFileExists(t, "examples/IndentedBlocks/indented.txt")
+}
+
+func TestBashPersistEnv(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-persist-examples")
+	})
+	input := t.TempDir()
+	sources := map[string]string{
+		"Persist":       "# Includes\n- [Child](./Child)\n\n# Run\n```bash\nexport GREETING=\"it's a 'quoted' value\" UNUSED=1\n```\n",
+		"Persist/Child": "# Run\n```bash\n[ \"$GREETING\" = \"it's a 'quoted' value\" ]\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+	run(t, runner, "export GOTESTMD_STATE_DIR="+t.TempDir())
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-persist-examples/ --bash --match=Child")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stderr, "GREETING is exported by the setup and used by test Child")
+	require.NotContains(t, stderr, "UNUSED")
+
+	script := "./test-persist-examples/persist/suite.gen.sh"
+	_, stderr, exitCode, err = runner.Run(script + " setup && " + script + " testChild")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode, stderr)
+	run(t, runner, script+" cleanup")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-persist-examples/ --bash --match=Child --persist-env")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NotContains(t, stderr, "GREETING")
+
+	_, stderr, exitCode, err = runner.Run(script + " setup && " + script + " testChild")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	run(t, runner, script+" cleanup")
+
+	// the saved variables are removed by the cleanup
+	_, stderr, exitCode, err = runner.Run(script + " testChild")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode, stderr)
+
+	_, stderr, exitCode, err = runner.Run(script + " run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+}
+
+func TestContinuation(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-continuation-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "continuation"), os.ModePerm))
+	command := "docker run \\\n  --rm \\\n  -e GREETING=hello \\\n  alpine:3 echo hello |\n  tr a-z A-Z &&\n  echo done"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "continuation", "README.md"),
+		[]byte("# Run\n```bash\n"+command+"\n```\n"), os.ModePerm))
+	// docker is replaced with a script that prints its args
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\necho \"$@\"\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	// the lines continued with backslashes, pipes and && are one command of the block
+	run(t, runner, "gotestmd "+input+" test-continuation-examples/")
+	suite, err := os.ReadFile("test-continuation-examples/continuation/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "r.Run(`docker run \\`+\"\\n\"+`  --rm \\`+\"\\n\"+`  -e GREETING=hello \\`+\"\\n\"+"+
+		"`  alpine:3 echo hello |`+\"\\n\"+`  tr a-z A-Z &&`+\"\\n\"+`  echo done`)\n")
+	require.Equal(t, 1, strings.Count(string(suite), "docker run"))
+
+	run(t, runner, "gotestmd "+input+" test-continuation-examples/ --bash --match=continuation")
+	stdout, stderr, exitCode, err := runner.Run("PATH=" + bin + ":$PATH ./test-continuation-examples/continuation/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stdout, "RUN --RM -E GREETING=HELLO ALPINE:3 ECHO HELLO\ndone")
+}
+
+func TestBashNoCleanup(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=^env$")
+
+	script, err := os.ReadFile("test-bash-examples/env/suite.gen.sh")
+	require.NoError(t, err)
+	require.NotContains(t, string(script), "cleanup_main")
+
+	run(t, runner, "./test-bash-examples/env/suite.gen.sh cleanup")
+}
+
+func TestBashMatrix(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=Drivers")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/matrix/suite.gen.sh testDrivers")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	for _, driver := range []string{"kernel", "vfio"} {
+		for _, ipam := range []string{"static", "dynamic"} {
+			require.Contains(t, stdout, "run with "+driver+" driver and "+ipam+" ipam")
+			require.Contains(t, stdout, "cleanup "+driver+" driver and "+ipam+" ipam")
+		}
+	}
+
+	// a variable without values would leave its placeholders in the commands
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Empty"), os.ModePerm))
+	source := "---\nmatrix:\n  driver: []\n  ipam: [static]\n---\n# Run\n```bash\necho {{matrix:driver}}\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Empty", "README.md"), []byte(source), os.ModePerm))
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=.")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "matrix variables have no values: driver")
+}
+
+func TestBashScenarios(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --scenarios --match='Create_file|Check_dir'")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/scenarios/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "setup scenarios")
+	require.Contains(t, stdout, "data")
+	require.Contains(t, stdout, "scenario runs in Scenarios")
+	require.Contains(t, stdout, "cleanup scenarios")
+}
+
+func TestScenarios(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-scenarios-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-scenarios-examples/ --scenarios --makefile")
+
+	source, err := os.ReadFile("test-scenarios-examples/scenarios/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(source), "func (s *Suite) TestCreate_file() {")
+	require.Contains(t, string(source), "func (s *Suite) TestCheck_dir() {")
+
+	stdout := run(t, runner, "go test -count=1 -v ./test-scenarios-examples/scenarios/")
+	require.Contains(t, stdout, "--- PASS: TestGeneratedSuite/TestCreate_file")
+	require.Contains(t, stdout, "--- PASS: TestGeneratedSuite/TestCheck_dir")
+}
+
+func TestRequireNoError(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-require-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-require-examples/ --require-no-error")
+
+	stdout, _, exitCode, err := runner.Run("grep -c 'require.NoError(s.T(), r.RunE(' test-require-examples/helloworld/suite.gen.go")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "2", stdout)
+
+	run(t, runner, "go vet ./test-require-examples/...")
+}
+
+func TestLogCommands(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-log-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-log-examples/ --log-commands --standalone-tests")
+
+	source, err := os.ReadFile("test-log-examples/tree/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(source), "s.T().Log(`echo \"I'm leaf A\"`)\nr.Run(`echo \"I'm leaf A\"`)")
+
+	stdout, _, exitCode, err := runner.Run("go test ./test-log-examples/tree/ -count=1 -v -run '^TestLeafA$'")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+	require.Regexp(t, `suite\.gen\.go:\d+: echo "I'm leaf A"`, stdout)
+}
+
+func TestBashOnce(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=once")
+
+	run(t, runner, "export GOTESTMD_STATE_DIR="+t.TempDir())
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/once/suite.gen.sh setup")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "provisioning")
+	require.Contains(t, stdout, "ready")
+
+	// the command is skipped until cleanup
+	stdout, _, exitCode, err = runner.Run("./test-bash-examples/once/suite.gen.sh setup")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.NotContains(t, stdout, "provisioning")
+	require.Contains(t, stdout, "ready")
+
+	run(t, runner, "./test-bash-examples/once/suite.gen.sh cleanup")
+
+	stdout, _, exitCode, err = runner.Run("./test-bash-examples/once/suite.gen.sh setup")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "provisioning")
+}
+
+func TestBashSuiteTimeout(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=timeout")
+
+	stdout, stderr, exitCode, err := runner.Run("SUITE_TIMEOUT_SECONDS=1 ./test-bash-examples/timeout/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Equal(t, 124, exitCode)
+	require.Contains(t, stderr, "suite timed out after 1 seconds")
+	require.Contains(t, stdout, "cleanup after timeout")
+}
+
+func TestRequiresGlob(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	for _, dir := range []string{"prereqs/B", "prereqs/A", "prereqs/docs", "main"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(input, "prereqs", "A", "README.md"), []byte("# Run\n```bash\necho a\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "prereqs", "B", "README.md"), []byte("# Run\n```bash\necho b\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "main", "README.md"), []byte("# Requires\n- [prereqs](../prereqs/*)\n# Run\n```bash\necho main\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	// dirs without examples are skipped, matching examples are set up in alphabetical order
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=main")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/main/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Regexp(t, `(?s)\ba\n.*\bb\n.*\bmain\n`, stdout)
+
+	// a glob that doesn't match any example is an error
+	require.NoError(t, os.WriteFile(filepath.Join(input, "main", "README.md"), []byte("# Requires\n- [prereqs](../missing/*)\n"), os.ModePerm))
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=main")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "doesn't match any example")
+}
+
+func TestVars(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "pinned"), os.ModePerm))
+	source := "# Run\n```bash\nIMAGE_TAG=latest\necho \"{{gotestmd:image}}:{{gotestmd:tag}} ${IMAGE_TAG}\"\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "pinned", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	// the placeholders are substituted at generation time, shell variables are kept for the runtime
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=pinned --var image=nginx --var tag=1.25=stable")
+
+	stdout, _, exitCode, err := runner.Run("./test-bash-examples/pinned/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "nginx:1.25=stable latest")
+
+	// a placeholder without value is kept and reported
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=pinned --var image=nginx")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stderr, "{{gotestmd:tag}} has no value")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=pinned --var =nginx")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "invalid --var value")
+}
+
+func TestRelativeDirs(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-relative-examples")
+	})
+	runner := newRunner(t)
+
+	// golang tests resolve the dirs against the root of the module, bash scripts against the base
+	_, stderr, exitCode, err := runner.Run("gotestmd examples/ test-relative-examples/ --dirs=relative --dirs-base=examples -q")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	suite, err := os.ReadFile(filepath.Join("test-relative-examples", "helloworld", "suite.gen.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(suite), `s.Runner("examples/HelloWorld")`)
+	_, stderr, exitCode, err = runner.Run("go test -count=1 ./test-relative-examples/helloworld/...")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+
+	_, stderr, exitCode, err = runner.Run("gotestmd examples/ test-relative-examples/ --bash --match=helloworld --dirs=relative --dirs-base=examples")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	script, err := os.ReadFile(filepath.Join("test-relative-examples", "helloworld", "suite.gen.sh"))
+	require.NoError(t, err)
+	require.Contains(t, string(script), `"$GOTESTMD_ROOT"/HelloWorld`)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	_, stderr, exitCode, err = runner.Run("(cd / && " + filepath.Join(wd, "test-relative-examples", "helloworld", "suite.gen.sh") + " run_all)")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+}
+
+func TestSplitCommands(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-split-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "split"), os.ModePerm))
+	source := "# Run\n```bash\n$(exit 1)\ncat <<EOF |\nfirst\nEOF\n  grep first\necho last\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "split", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	// the status of a block is the status of its last command, so the failure is missed
+	run(t, runner, "gotestmd "+input+" test-split-examples/ --bash --match=split")
+	run(t, runner, "./test-split-examples/split/suite.gen.sh run_all")
+
+	run(t, runner, "gotestmd "+input+" test-split-examples/ --bash --match=split --split-commands")
+	stdout, _, exitCode, err := runner.Run("./test-split-examples/split/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.NotContains(t, stdout, "last")
+
+	run(t, runner, "gotestmd "+input+" test-split-examples/ --split-commands")
+	suite, err := os.ReadFile("test-split-examples/split/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "r.Run(`$(exit 1)`)\n")
+	require.Contains(t, string(suite), "r.Run(`cat <<EOF |`+\"\\n\"+`first`+\"\\n\"+`EOF`+\"\\n\"+`  grep first`)\n")
+	require.Contains(t, string(suite), "r.Run(`echo last`)\n")
+}
+
+func TestSplitCommandsCases(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-split-examples")
+	})
+	cases := []struct {
+		name     string
+		block    string
+		commands []string
+	}{
+		{name: "arithmetic", block: "echo $(( 1 << 2 ))\n(( x = 1 << 2 ))\necho $x",
+			commands: []string{"echo $(( 1 << 2 ))", "(( x = 1 << 2 ))", "echo $x"}},
+		{name: "subshell", block: "(cd /tmp &&\n  ls)\necho $(\n  pwd)",
+			commands: []string{"(cd /tmp &&\n  ls)", "echo $(\n  pwd)"}},
+		{name: "backticks", block: "echo `date\n`\necho done",
+			commands: []string{"echo `date\n`", "echo done"}},
+		{name: "function", block: "f()\n{\n  echo f\n}\nfunction g\n{\n  echo g\n}\nh() { echo h; }\narr=()\nf",
+			commands: []string{"f()\n{\n  echo f\n}", "function g\n{\n  echo g\n}", "h() { echo h; }", "arr=()", "f"}},
+		{name: "case", block: "case $1 in\n  a|b) echo ab ;;\n  (c) echo c ;;\nesac\necho done",
+			commands: []string{"case $1 in\n  a|b) echo ab ;;\n  (c) echo c ;;\nesac", "echo done"}},
+		{name: "ansic", block: "echo $'it\\'s\n'\necho 'a\\'\necho done",
+			commands: []string{"echo $'it\\'s\n'", "echo 'a\\'", "echo done"}},
+		{name: "heredoc", block: "cat <<-'EOF' | grep x\n\tx\n\tEOF\ncat <<A <<B\na\nA\nb\nB\necho done",
+			commands: []string{"cat <<-'EOF' | grep x\n\tx\n\tEOF", "cat <<A <<B\na\nA\nb\nB", "echo done"}},
+	}
+	input := t.TempDir()
+	for _, c := range cases {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, c.name), os.ModePerm))
+		source := "# Run\n```bash\n" + c.block + "\n```\n"
+		require.NoError(t, os.WriteFile(filepath.Join(input, c.name, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-split-examples/ --split-commands --sources")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+
+	source, err := os.ReadFile(filepath.Join("test-split-examples", "sources.gen.json"))
+	require.NoError(t, err)
+	var sources struct {
+		Suites []struct {
+			Dir string
+			Run []struct {
+				Command string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(source, &sources))
+	commands := map[string][]string{}
+	for _, s := range sources.Suites {
+		for _, r := range s.Run {
+			commands[filepath.Base(s.Dir)] = append(commands[filepath.Base(s.Dir)], r.Command)
+		}
+	}
+	for _, c := range cases {
+		require.Equal(t, c.commands, commands[c.name], c.name)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-strip-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "strip"), os.ModePerm))
+	source := "# Run\n```bash\n# step 1\necho one\n\ncat <<EOF | grep -c kept\n# kept in heredoc\nEOF\n```\n\n```bash\n# only comments\n\n```\n" +
+		"```bash\necho $(( 1 << 2 ))\n# not a heredoc\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "strip", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-strip-examples/")
+	suite, err := os.ReadFile("test-strip-examples/strip/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "r.Run(`# only comments`)\n")
+
+	run(t, runner, "gotestmd "+input+" test-strip-examples/ --strip-comments")
+	suite, err = os.ReadFile("test-strip-examples/strip/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "r.Run(`echo one`+\"\\n\"+`cat <<EOF | grep -c kept`+\"\\n\"+`# kept in heredoc`+\"\\n\"+`EOF`)\n")
+	require.NotContains(t, string(suite), "step 1")
+	require.NotContains(t, string(suite), "only comments")
+	require.Contains(t, string(suite), "r.Run(`echo $(( 1 << 2 ))`)\n")
+	require.NotContains(t, string(suite), "not a heredoc")
+
+	run(t, runner, "gotestmd "+input+" test-strip-examples/ --bash --match=strip --strip-comments")
+	stdout, stderr, exitCode, err := runner.Run("./test-strip-examples/strip/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stdout, "one\n1")
+}
+
+func TestCRLF(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-crlf-examples")
+	})
+	input := t.TempDir()
+	sources := map[string]string{
+		"crlf": "---\ncleanup: reverse\n---\n# CRLF\n## Includes\n- [Leaf](./leaf)\n## Run\n```bash\necho hello\n```\n```output\nhello\n```\n" +
+			"## Cleanup\n```bash\n[ -d . ]\n```\n",
+		"crlf/leaf": "# Leaf\n## Run\n```bash\nX=1\n[ \"$X\" = 1 ]\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		source = strings.ReplaceAll(source, "\n", "\r\n")
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-crlf-examples/ --makefile")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	source, err := os.ReadFile("test-crlf-examples/crlf/suite.gen.go")
+	require.NoError(t, err)
+	require.NotContains(t, string(source), "\r")
+	require.Contains(t, string(source), "TestLeaf")
+	stdout, _, exitCode, err := runner.Run("go test ./test-crlf-examples/... -count=1 -args -gotestmd.t=1s")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-crlf-examples/ --bash --match=crlf")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	script, err := os.ReadFile("test-crlf-examples/crlf/suite.gen.sh")
+	require.NoError(t, err)
+	require.NotContains(t, string(script), "\r")
+	_, stderr, exitCode, err = runner.Run("./test-crlf-examples/crlf/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+}
+
+func TestSnippets(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-snippets-examples")
+	})
+	input := t.TempDir()
+	snippets := filepath.Join(t.TempDir(), "snippets.md")
+	require.NoError(t, os.WriteFile(snippets, []byte("# Snippets\n```bash\n# gotestmd:snippet greet\nNAME=world\n"+
+		"# gotestmd:include-snippet print\n```\n```bash\n# gotestmd:snippet print\necho \"hello $NAME\"\n```\n"), os.ModePerm))
+	sources := map[string]string{
+		"a": "# A\n## Run\n```bash\n# gotestmd:include-snippet greet\n```\n```output\nhello world\n```\n",
+		"b": "# B\n## Run\n```bash\nif true; then\n  # gotestmd:include-snippet print\nfi\n```\n```output\nhello \n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-snippets-examples/ --snippets " + snippets)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	source, err := os.ReadFile("test-snippets-examples/b/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(source), "`  echo \"hello $NAME\"`")
+	stdout, _, exitCode, err := runner.Run("go test ./test-snippets-examples/... -count=1 -args -gotestmd.t=1s")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+
+	require.NoError(t, os.WriteFile(filepath.Join(input, "b", "README.md"), []byte("# B\n## Run\n```bash\necho\n# gotestmd:include-snippet missing\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-snippets-examples/ --snippets " + snippets)
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "b", "README.md")+":5: snippet missing is not defined")
+
+	cyclic := filepath.Join(t.TempDir(), "snippets.md")
+	require.NoError(t, os.WriteFile(cyclic, []byte("```bash\n# gotestmd:snippet a\n# gotestmd:include-snippet b\n```\n"+
+		"```bash\n# gotestmd:snippet b\n# gotestmd:include-snippet a\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-snippets-examples/ --snippets " + cyclic)
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "snippet includes itself: a -> b -> a")
+}
+
+func TestFlatten(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-flatten-examples")
+	})
+	input := t.TempDir()
+	state := t.TempDir()
+	sources := map[string]string{
+		"flat":            "# Requires\n- [Base](./base)\n\n# Includes\n- [Child](./child)\n\n# Run\n```bash\n[ -f " + state + "/base ] && touch " + state + "/root\n```\n",
+		"flat/base":       "# Run\n```bash\ntouch " + state + "/base\n```\n\n# Cleanup\n```bash\nrm " + state + "/base\n```\n",
+		"flat/child":      "# Requires\n- [Base](../base)\n\n# Includes\n- [Leaf](./leaf)\n\n# Run\n```bash\n[ -f " + state + "/root ] && touch " + state + "/child\n```\n",
+		"flat/child/leaf": "# Run\n```bash\n[ -f " + state + "/child ]\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-flatten-examples/ --flatten --standalone-tests")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	suite, err := os.ReadFile("test-flatten-examples/flat/suite.gen.go")
+	require.NoError(t, err)
+	require.NotContains(t, string(suite), "RunIncludedSuites")
+	require.Equal(t, 1, strings.Count(string(suite), "touch "+state+"/base"))
+	require.Contains(t, string(suite), "func (s *Suite) TestChild_Leaf()")
+
+	stdout, stderr, exitCode, err := runner.Run("go test -count=1 ./test-flatten-examples/flat/ -run '^TestChild_Leaf$' -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+	require.Contains(t, stdout, "--- PASS: TestChild_Leaf")
+	// the cleanups of the inlined suites are run after the tests
+	require.NoFileExists(t, filepath.Join(state, "base"))
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-flatten-examples/ --flatten --bash --match=flat")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "flag --flatten can't be used with flags --bash, --main and --format=ginkgo")
+}
+
+func TestSingleFile(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-single-examples")
+	})
+	input := t.TempDir()
+	sources := map[string]string{
+		"one/basic":       "# Run\n```bash\necho one\n```\n",
+		"two/basic":       "# Run\n```bash\necho two\n```\n",
+		"root":            "# Requires\n- [One](../one/basic)\n- [Two](../two/basic)\n\n# Includes\n- [Child](./child)\n\n# Run\n```bash\necho root\n```\n",
+		"root/child":      "# Includes\n- [Leaf](./leaf)\n\n# Run\n```bash\necho child\n```\n",
+		"root/child/leaf": "# Run\n```bash\necho leaf\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-single-examples/ --single-file")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	entries, err := os.ReadDir("test-single-examples")
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, entry.IsDir(), entry.Name())
+	}
+	source, err := os.ReadFile("test-single-examples/suites.gen_test.go")
+	require.NoError(t, err)
+	require.Contains(t, string(source), "package test_single_examples\n")
+	require.Contains(t, string(source), "type OneBasicSuite struct")
+	require.Contains(t, string(source), "type TwoBasicSuite struct")
+	require.Contains(t, string(source), "one_basicSuite OneBasicSuite\n")
+	require.Contains(t, string(source), "suite.Run(s.T(), &s.childSuite)")
+	require.Equal(t, 1, strings.Count(string(source), "\"github.com/stretchr/testify/suite\""))
+
+	entryPoint := "package test_single_examples\n\nimport (\n\t\"testing\"\n\n\t\"github.com/stretchr/testify/suite\"\n)\n\n" +
+		"func TestEntryPoint(t *testing.T) {\n\tsuite.Run(t, new(RootSuite))\n}\n"
+	require.NoError(t, os.WriteFile("test-single-examples/entry_point_test.go", []byte(entryPoint), os.ModePerm))
+	stdout, stderr, exitCode, err := runner.Run("go test -count=1 ./test-single-examples/ -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+	require.Contains(t, stdout, "--- PASS: TestEntryPoint/Child/TestLeaf")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-single-examples/ --single-file --standalone-tests")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "flag --single-file can't be used with flags")
+}
+
+func TestQualifiedNames(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-qualified-examples")
+	})
+	input := t.TempDir()
+	sources := map[string]string{
+		"one/basic": "# Run\n```bash\necho one\n```\n",
+		"two/basic": "# Run\n```bash\necho two\n```\n",
+		"root":      "# Requires\n- [One](../one/basic)\n- [Two](../two/basic)\n\n# Run\n```bash\necho root\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-qualified-examples/")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "are both imported as basic, use --qualified-names")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-qualified-examples/ --qualified-names")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	suite, err := os.ReadFile("test-qualified-examples/root/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "one_basic \"github.com/networkservicemesh/gotestmd/test-qualified-examples/one/basic\"")
+	require.Contains(t, string(suite), "two_basicSuite two_basic.Suite")
+	_, stderr, exitCode, err = runner.Run("go vet ./test-qualified-examples/...")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+}
+
+func TestLocationCollision(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-collision-examples")
+	})
+	input := t.TempDir()
+	for _, dir := range []string{"Basic", "basic"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte("# Run\n```bash\necho "+dir+"\n```\n"), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-collision-examples/")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "are both generated into test-collision-examples/basic/suite.gen.go")
+}
+
+func TestUnsafeCommands(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-unsafe-examples")
+	})
+	input := t.TempDir()
+	sources := map[string]string{
+		"Unsafe":       "# Includes\n- [Child](./Child)\n",
+		"Unsafe/Child": "# Child\n\n# Run\n```bash\n[ \"$(echo `echo inner`)\" = inner ]\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-unsafe-examples/ --standalone-tests")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	suite, err := os.ReadFile("test-unsafe-examples/unsafe/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "r.Run(\"[ \\\"$(echo `echo inner`)\\\" = inner ]\")")
+	stdout, stderr, exitCode, err := runner.Run("go test -count=1 ./test-unsafe-examples/unsafe/ -run '^TestChild$' -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+	require.Contains(t, stdout, "--- PASS: TestChild")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-unsafe-examples/ --unsafe-commands=reject")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "Unsafe", "Child", "README.md")+":4-6: command contains a backtick")
+
+	// bash scripts have no raw strings
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-unsafe-examples/ --unsafe-commands=reject --bash --match=Child")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	_, stderr, exitCode, err = runner.Run("./test-unsafe-examples/unsafe/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+}
+
+func TestOptionalRequires(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-optional-examples")
+	})
+	input := t.TempDir()
+	writeExample := func(dir, source string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+	writeExample("Present", "# Run\n```bash\necho present\n```\n")
+	writeExample("Main", "# Requires\n- [Present](../Present) (optional)\n- [Missing](../Missing) (optional)\n"+
+		"- [Kinds](../Kind*) (optional)\n\n# Run\n```bash\necho main\n```\n")
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-optional-examples/")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stderr, "optional require /Missing for example /Main is not found, it's skipped")
+	require.Contains(t, stderr, "optional require /Kind* for example /Main doesn't match any example, it's skipped")
+	suite, err := os.ReadFile("test-optional-examples/main/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "test-optional-examples/present\"")
+	require.NotContains(t, string(suite), "missing")
+	_, stderr, exitCode, err = runner.Run("go vet ./test-optional-examples/...")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+
+	writeExample("Main", "# Requires\n- [Missing](../Missing)\n\n# Run\n```bash\necho main\n```\n")
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-optional-examples/")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "unknown require /Missing for example /Main")
+}
+
+func TestVerbose(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-verbose-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "suite", "child"), os.ModePerm))
+	source := "# Includes\n- [Child](./child)\n" +
+		"# Run\n```bash\necho setup\necho more\n```\n" +
+		"# Cleanup\n```bash\necho cleanup\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "suite", "README.md"), []byte(source), os.ModePerm))
+	source = "# Run\n```bash\necho test\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "suite", "child", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-verbose-examples/ -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	readme := filepath.Join(input, "suite", "README.md")
+	require.Contains(t, stderr, "[DEBUG] found "+readme)
+	require.Contains(t, stderr, "[DEBUG] "+readme+": run block 1: echo setup ...")
+	require.Contains(t, stderr, "[DEBUG] "+readme+": cleanup block 1: echo cleanup")
+	require.Contains(t, stderr, "[DEBUG] "+filepath.Join(input, "suite", "child", "README.md")+": run block 1: echo test")
+	require.Contains(t, stderr, "[DEBUG] example "+filepath.Join(input, "suite")+" is a suite, its run blocks are the setup")
+	require.Contains(t, stderr, "[DEBUG] example "+filepath.Join(input, "suite", "child")+" is a test of ["+filepath.Join(input, "suite")+"]")
+	require.Contains(t, stderr, "[DEBUG] generated test-verbose-examples/")
+
+	// the diagnostics don't change generated files
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-verbose-examples/ --check-generated")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NotContains(t, stderr, "[DEBUG]")
+}
+
+func TestParseCache(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-cache-examples")
+	})
+	input := t.TempDir()
+	for _, name := range []string{"first", "second"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, name), os.ModePerm))
+		source := "# Run\n```bash\necho " + name + "\n```\n"
+		require.NoError(t, os.WriteFile(filepath.Join(input, name, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	// --no-cache neither writes nor reads the cache
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-cache-examples/ -v --no-cache")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NoFileExists(t, "test-cache-examples/.gotestmd-cache.json")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-cache-examples/ -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NotContains(t, stderr, "taken from the cache")
+	require.FileExists(t, "test-cache-examples/.gotestmd-cache.json")
+
+	// only the changed file is parsed again
+	source := "# Run\n```bash\necho changed\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "second", "README.md"), []byte(source), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-cache-examples/ -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stderr, filepath.Join(input, "first", "README.md")+" is unchanged")
+	require.NotContains(t, stderr, filepath.Join(input, "second", "README.md")+" is unchanged")
+	suite, err := os.ReadFile("test-cache-examples/second/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "echo changed")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-cache-examples/ -v --no-cache")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NotContains(t, stderr, "taken from the cache")
+
+	// the entries of another build of gotestmd are dropped
+	cache, err := os.ReadFile("test-cache-examples/.gotestmd-cache.json")
+	require.NoError(t, err)
+	var entries map[string]interface{}
+	require.NoError(t, json.Unmarshal(cache, &entries))
+	entries["version"] = "1/previous"
+	cache, err = json.Marshal(entries)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile("test-cache-examples/.gotestmd-cache.json", cache, os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-cache-examples/ -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stderr, "the cache was written by another build of gotestmd: 1/previous")
+	require.NotContains(t, stderr, "taken from the cache")
+}
+
+func TestSections(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Steps"), os.ModePerm))
+	source := "# Steps\n" +
+		"## Start\n```bash\necho start\n```\n" +
+		"## Notes\n```bash\necho notes\n```\n" +
+		"## Teardown\n```bash\necho teardown\n```\n" +
+		"## Verify\n```bash\necho verify\n```\n" +
+		"## Run\n```bash\necho run\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Steps", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=. --sections=Start=run,Verify=run,Teardown=cleanup,Run=ignore")
+
+	stdout, _, exitCode, err := runner.Run("test-bash-examples/steps/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Regexp(t, `(?s)start.*verify.*teardown`, stdout)
+	require.NotContains(t, stdout, "notes")
+	require.NotContains(t, stdout, "run\n")
+
+	_, _, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --sections=Start=setup")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func TestConfigFile(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Base"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "App"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Base", "README.md"), []byte("# Base\n## Setup\n```bash\necho base\n```\n"), os.ModePerm))
+	source := "# App\n" +
+		"## Prerequisites\n- [Base](../Base)\n" +
+		"## Setup\n```bash\necho app\n```\n" +
+		"## Teardown\n```bash\necho teardown\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "App", "README.md"), []byte(source), os.ModePerm))
+	yamlConfig := filepath.Join(t.TempDir(), "gotestmd.yaml")
+	require.NoError(t, os.WriteFile(yamlConfig, []byte("sections:\n  Setup: run\n  Teardown: cleanup\n  Prerequisites: requires\n"), os.ModePerm))
+	jsonConfig := filepath.Join(t.TempDir(), "gotestmd.json")
+	require.NoError(t, os.WriteFile(jsonConfig, []byte(`{"sections": {"Setup": "run", "Teardown": "cleanup", "Prerequisites": "requires"}}`), os.ModePerm))
+
+	runner := newRunner(t)
+
+	for _, config := range []string{yamlConfig, jsonConfig} {
+		run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=app --config="+config)
+
+		stdout, _, exitCode, err := runner.Run("test-bash-examples/app/suite.gen.sh run_all")
+		require.NoError(t, err)
+		require.Zero(t, exitCode)
+		require.Regexp(t, `(?s)base.*app.*teardown`, stdout)
+	}
+
+	// the flag overrides the config file
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=app --config="+yamlConfig+" --sections=Teardown=ignore")
+	stdout, _, exitCode, err := runner.Run("test-bash-examples/app/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.NotContains(t, stdout, "teardown")
+}
+
+func TestIncludedSuitesOrder(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-order-examples")
+	})
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd examples/ test-order-examples/")
+
+	source, err := os.ReadFile("test-order-examples/ordered/suite.gen.go")
+	require.NoError(t, err)
+	require.Regexp(t, `(?s)s\.Run\("Gamma".*s\.Run\("Alpha".*s\.Run\("Beta"`, string(source))
+}
+
+func TestSummary(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-summary-examples")
+	})
+	runner := newRunner(t)
+
+	stdout, _, exitCode, err := runner.Run("gotestmd examples/ test-summary-examples/")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Regexp(t, `generated \d+ suites with \d+ commands`, stdout)
+	require.Regexp(t, `suites without tests \(\d+\):\n(\t.*\n)*\texamples/HelloWorld\n`, stdout)
+	require.Contains(t, stdout, "examples/Producer/Consumer4: the suite has no commands, tests or included suites")
+
+	stdout, _, exitCode, err = runner.Run("gotestmd examples/ test-summary-examples/ --quiet")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Empty(t, stdout)
+}
+
+func TestKeepGoing(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "A"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "B"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "A", "README.md"), []byte("---\nshell: powershell\n---\n# Run\n```pwsh\nWrite-Output a\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "B", "README.md"), []byte("# Run\n```bash\necho b\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=.")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "A"))
+	require.NoFileExists(t, "test-bash-examples/b/suite.gen.sh")
+
+	_, _, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --keep-going=false")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.NoFileExists(t, "test-bash-examples/b/suite.gen.sh")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --keep-going")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "failed to generate 1 suites")
+	require.FileExists(t, "test-bash-examples/b/suite.gen.sh")
+
+	// the examples that can't be parsed are skipped and reported too
+	for _, name := range []string{"C", "D"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, name), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, name, "README.md"), []byte("# Run\n```bash\necho broken\n"), os.ModePerm))
+	}
+	require.NoError(t, os.RemoveAll("test-bash-examples"))
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --keep-going")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "C", "README.md")+":2: code block opened with ``` is not closed")
+	require.Contains(t, stderr, filepath.Join(input, "D", "README.md")+":2: code block opened with ``` is not closed")
+	require.Contains(t, stderr, "failed to parse 2 examples: failed to generate 1 suites")
+	require.FileExists(t, "test-bash-examples/b/suite.gen.sh")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=.")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "C", "README.md"))
+	require.NotContains(t, stderr, filepath.Join(input, "D", "README.md"))
+}
+
+func TestWorkers(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-workers-1")
+		_ = os.RemoveAll("test-workers-8")
+	})
+	runner := newRunner(t)
+
+	// --jobs is an alias of --workers
+	for _, flag := range []string{"--workers=1", "--jobs=8"} {
+		_, workers, _ := strings.Cut(flag, "=")
+		_, stderr, exitCode, err := runner.Run("gotestmd examples/ test-workers-" + workers + "/ --main --standalone-tests --keep-going -q " + flag)
+		require.NoError(t, err)
+		require.NotZero(t, exitCode)
+		require.Contains(t, stderr, "failed to generate 1 suites")
+	}
+
+	var count int
+	require.NoError(t, filepath.Walk("test-workers-1", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		count++
+		expected, err := os.ReadFile(filepath.Clean(path))
+		require.NoError(t, err)
+		actual, err := os.ReadFile(filepath.Join("test-workers-8", strings.TrimPrefix(path, "test-workers-1")))
+		require.NoError(t, err)
+		require.Equal(t, strings.ReplaceAll(string(expected), "test-workers-1", "test-workers-8"), string(actual), path)
+		return nil
+	}))
+	require.NotZero(t, count)
+
+	_, _, exitCode, err := runner.Run("gotestmd examples/ test-workers-1/ --workers=0")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func BenchmarkWorkers(b *testing.B) {
+	// a tree of 300 examples: 30 suites with 9 tests each
+	input := b.TempDir()
+	for i := 0; i < 30; i++ {
+		var includes strings.Builder
+		for j := 0; j < 9; j++ {
+			leaf := fmt.Sprintf("Suite%v/Leaf%v", i, j)
+			_, _ = fmt.Fprintf(&includes, "- [Leaf%v](./Leaf%v)\n", j, j)
+			require.NoError(b, os.MkdirAll(filepath.Join(input, leaf), os.ModePerm))
+			require.NoError(b, os.WriteFile(filepath.Join(input, leaf, "README.md"),
+				[]byte(fmt.Sprintf("# Leaf\n\n## Run\n\n```bash\necho %q\n```\n\n## Cleanup\n\n```bash\necho done\n```\n", leaf)), os.ModePerm))
+		}
+		require.NoError(b, os.WriteFile(filepath.Join(input, fmt.Sprintf("Suite%v", i), "README.md"),
+			[]byte("# Suite\n\n## Includes\n\n"+includes.String()+"\n## Run\n\n```bash\necho setup\n```\n"), os.ModePerm))
+	}
+
+	for _, workers := range []string{"1", "8"} {
+		b.Run("workers="+workers, func(b *testing.B) {
+			output := b.TempDir()
+			for i := 0; i < b.N; i++ {
+				cmd := gotestmd.New()
+				cmd.SetArgs([]string{input, output, "-q", "--standalone-tests", "--workers=" + workers})
+				require.NoError(b, cmd.Execute())
+			}
+		})
+	}
+}
+
+func TestGlobalSuite(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-global-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Global"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "App", "Check"), os.ModePerm))
+	global := "---\nglobal: true\n---\n# Global\n## Run\n```bash\ntouch ../global.marker\n```\n## Cleanup\n```bash\nrm ../global.marker\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Global", "README.md"), []byte(global), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "App", "README.md"), []byte("# App\n## Includes\n- [Check](./Check)\n## Run\n```bash\nls ../global.marker\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "App", "Check", "README.md"), []byte("# Check\n## Run\n```bash\nls ../../global.marker\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-global-examples/ --makefile -q")
+
+	run(t, runner, "go test ./test-global-examples/app/")
+	require.NoFileExists(t, filepath.Join(input, "global.marker"))
+
+	run(t, runner, "gotestmd "+input+" test-global-examples/ --bash --match=app")
+
+	stdout, _, exitCode, err := runner.Run("./test-global-examples/app/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "setup suite test-global-examples/global")
+	require.NoFileExists(t, filepath.Join(input, "global.marker"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(input, "App", "README.md"), []byte("# App\n## Requires\n- [Global](../Global)\n## Run\n```bash\nls ../global.marker\n```\n"), os.ModePerm))
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-global-examples/")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "can't be included or required")
+}
+
+func TestStrict(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Typo"), os.ModePerm))
+	source := "---\nshell: bash\n---\n# Typo\n## Run\n```bash\necho run\n```\n## Runn\n```bash\necho typo\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Typo", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=.")
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --strict")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(input, "Typo", "README.md"))
+	require.Contains(t, stderr, `line 10: bash block is under "Runn" heading`)
+
+	// the headings that begin with the section name are the sections by default, --strict rejects them instead of running them
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Typo", "README.md"),
+		[]byte("---\nshell: bash\n---\n# Typo\n## Run the demo\n```bash\necho running\n```\n# Cleanup steps\n```bash\necho cleaning\n```\n"), os.ModePerm))
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=.")
+	script, err := os.ReadFile(filepath.Join("test-bash-examples", "typo", "suite.gen.sh"))
+	require.NoError(t, err)
+	require.Contains(t, string(script), "echo running")
+	require.Contains(t, string(script), "echo cleaning")
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-bash-examples/ --bash --match=. --strict")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, `line 6: bash block is under "Run the demo" heading`)
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Typo", "README.md"), []byte(source), os.ModePerm))
+
+	run(t, runner, "gotestmd "+input+" test-bash-examples/ --bash --match=. --strict --sections=Runn=ignore")
+
+	run(t, runner, "gotestmd examples/ test-bash-examples/ --bash --match=. --strict")
+}
+
+func TestMalformedFences(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-fences-examples")
+	})
+	sources := map[string]string{
+		"Unclosed": "---\nshell: bash\n---\n# Run\n```bash\necho run\n```\n\n# Cleanup\n```bash\necho cleanup\n",
+		"Mixed":    "# Run\n```bash\necho run\n~~~\n\n# Cleanup\n\nNothing to clean up.\n",
+	}
+	expected := map[string]string{
+		"Unclosed": ":10: code block opened with ``` is not closed",
+		"Mixed":    ":2: code block opened with ``` is not closed, ~~~ at line 4 doesn't close it",
+	}
+
+	runner := newRunner(t)
+
+	for name, source := range sources {
+		input := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(input, name), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, name, "README.md"), []byte(source), os.ModePerm))
+
+		_, stderr, exitCode, err := runner.Run("gotestmd " + input + " test-fences-examples/ --bash --match=.")
+		require.NoError(t, err)
+		require.NotZero(t, exitCode, name)
+		require.Contains(t, stderr, filepath.Join(input, name, "README.md")+expected[name])
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-incremental-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "A"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "B"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "A", "README.md"), []byte("# A\n## Run\n```bash\necho a\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "B", "README.md"), []byte("# B\n## Requires\n- [A](../A)\n## Run\n```bash\necho b\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	generate := func() string {
+		stdout, _, exitCode, err := runner.Run("gotestmd " + input + " test-incremental-examples/ --incremental")
+		require.NoError(t, err)
+		require.Zero(t, exitCode)
+		return stdout
+	}
+
+	require.Contains(t, generate(), "generated 2 suites")
+	require.FileExists(t, filepath.Join("test-incremental-examples", ".gotestmd-manifest.json"))
+	stdout := generate()
+	require.Contains(t, stdout, "generated 0 suites")
+	require.Contains(t, stdout, "skipped 2 unchanged suites")
+
+	require.NoError(t, os.WriteFile(filepath.Join(input, "B", "README.md"), []byte("# B\n## Requires\n- [A](../A)\n## Run\n```bash\necho c\n```\n"), os.ModePerm))
+	require.Contains(t, generate(), "generated 1 suites")
+	source, err := os.ReadFile(filepath.Join("test-incremental-examples", "b", "suite.gen.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(source), "echo c")
+
+	// the changes of the required suites are the changes of the suite
+	require.NoError(t, os.WriteFile(filepath.Join(input, "A", "README.md"), []byte("# A\n## Run\n```bash\necho d\n```\n"), os.ModePerm))
+	require.Contains(t, generate(), "generated 2 suites")
+
+	require.NoError(t, os.Remove(filepath.Join("test-incremental-examples", "a", "suite.gen.go")))
+	require.Contains(t, generate(), "generated 1 suites")
+	require.FileExists(t, filepath.Join("test-incremental-examples", "a", "suite.gen.go"))
+
+	stdout, _, exitCode, err := runner.Run("gotestmd " + input + " test-incremental-examples/ --incremental --command-timeout=1m")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Contains(t, stdout, "generated 2 suites")
+}
+
+func TestCheckGenerated(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-check-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "A"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "A", "README.md"), []byte("# A\n## Run\n```bash\necho a\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	check := func() (string, int) {
+		stdout, _, exitCode, err := runner.Run("gotestmd " + input + " test-check-examples/ --makefile --check-generated")
+		require.NoError(t, err)
+		return stdout, exitCode
+	}
+
+	// nothing is written in check mode
+	stdout, exitCode := check()
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, "test-check-examples/a/suite.gen.go is missing")
+	require.NoDirExists(t, "test-check-examples")
+
+	run(t, runner, "gotestmd "+input+" test-check-examples/ --makefile")
+	stdout, exitCode = check()
+	require.Zero(t, exitCode)
+	require.Empty(t, stdout)
+
+	require.NoError(t, os.WriteFile(filepath.Join(input, "A", "README.md"), []byte("# A\n## Run\n```bash\necho b\n```\n"), os.ModePerm))
+	stdout, exitCode = check()
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, "+++ test-check-examples/a/suite.gen.go (generated)")
+	require.Contains(t, stdout, "+r.Run(`echo b`)")
+	require.Contains(t, stdout, "-r.Run(`echo a`)")
+}
+
+func TestList(t *testing.T) {
+	input := t.TempDir()
+	sources := map[string]string{
+		"a":     "# Requires\n- [C](../c)\n\n# Includes\n- [B](./b)\n\n# Run\n```bash\necho a\n```\n",
+		"a/b":   "# Includes\n- [D](./d)\n\n# Run\n```bash\necho b\n```\n",
+		"a/b/d": "# Run\n```bash\necho d\n```\n",
+		"c":     "# Run\n```bash\necho c\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	stdout, stderr, exitCode, err := runner.Run("gotestmd --list " + input)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	a, b, c := filepath.Join(input, "a"), filepath.Join(input, "a", "b"), filepath.Join(input, "c")
+	require.Equal(t, "suite\t"+a+"\ta.Suite\n"+
+		"requires\t"+a+"\t"+c+"\n"+
+		"includes\t"+a+"\t"+b+"\n"+
+		"suite\t"+b+"\tb.Suite\n"+
+		"test\t"+b+"\tTestD\t"+filepath.Join(b, "d")+"\n"+
+		"suite\t"+c+"\tc.Suite", stdout)
+
+	// nothing is written, even the parse cache
+	_, stderr, exitCode, err = runner.Run("gotestmd --list " + input + " test-list-examples/")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NoDirExists(t, "test-list-examples")
+	require.NoFileExists(t, filepath.Join(input, ".gotestmd-cache.json"))
+}
+
+func TestDot(t *testing.T) {
+	input := t.TempDir()
+	sources := map[string]string{
+		"a":   "# Requires\n- [C](../c)\n\n# Includes\n- [B](./b)\n\n# Run\n```bash\necho a\n```\n",
+		"a/b": "# Run\n```bash\necho b\n```\n",
+		"c":   "# Run\n```bash\necho c\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	stdout, stderr, exitCode, err := runner.Run("gotestmd --dot " + input)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	a, b, c := filepath.Join(input, "a"), filepath.Join(input, "a", "b"), filepath.Join(input, "c")
+	require.Equal(t, "digraph gotestmd {\n"+
+		"\t\""+a+"\";\n"+
+		"\t\""+b+"\";\n"+
+		"\t\""+c+"\";\n"+
+		"\t\""+a+"\" -> \""+c+"\";\n"+
+		"\t\""+a+"\" -> \""+b+"\" [style=dashed];\n"+
+		"}", stdout)
+
+	_, _, exitCode, err = runner.Run("gotestmd --dot --list " + input)
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func TestOrphans(t *testing.T) {
+	input := t.TempDir()
+	sources := map[string]string{
+		"a":     "# Includes\n- [B](./b)\n\n# Run\n```bash\necho a\n```\n",
+		"a/b":   "# Run\n```bash\necho b\n```\n",
+		"a/c":   "# Run\n```bash\necho c\n```\n",
+		"d/e/f": "# Run\n```bash\necho f\n```\n",
+		"g/h":   "# Requires\n- [A](../../a)\n\n# Run\n```bash\necho h\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd --list " + input)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.NotContains(t, stderr, "is not included or required")
+
+	_, stderr, exitCode, err = runner.Run("gotestmd --list --report-orphans " + input)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stderr, "example "+filepath.Join(input, "a", "c")+" is not included or required by any example")
+	require.Contains(t, stderr, "example "+filepath.Join(input, "d", "e", "f")+" is not included or required by any example")
+	require.Equal(t, 2, strings.Count(stderr, "is not included or required"))
+
+	_, stderr, exitCode, err = runner.Run("gotestmd --list --fail-on-orphans " + input)
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "2 examples are not included or required by any example")
+}
+
+func TestSerial(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-serial-examples")
+	})
+	input := t.TempDir()
+	sources := map[string]string{
+		"a":     "# Includes\n- [B](./b)\n- [C](./c)\n\n# Run\n```bash\necho a\n```\n",
+		"a/b":   "<!-- # gotestmd:serial -->\n# Includes\n- [D](./d)\n\n# Run\n```bash\necho b\n```\n",
+		"a/b/d": "# Run\n```bash\necho d\n```\n",
+		"a/c":   "# Includes\n- [E](./e)\n\n# Run\n```bash\necho c\n```\n",
+		"a/c/e": "# Run\n```bash\necho e\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	// only the suite that declares the directive is serial
+	stdout, stderr, exitCode, err := runner.Run("gotestmd --list " + input)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	b := filepath.Join(input, "a", "b")
+	require.Contains(t, stdout, "suite\t"+b+"\tb.Suite\nserial\t"+b+"\n")
+	require.Equal(t, 1, strings.Count(stdout, "serial\t"))
+
+	// the serial suite waits for the other serial suites in its setup, also when the packages are tested in parallel
+	run(t, runner, "gotestmd "+input+" test-serial-examples/ --makefile")
+	suite, err := os.ReadFile("test-serial-examples/a/b/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "func (s *Suite) SetupSuite() {\ns.Serial()\n")
+	suite, err = os.ReadFile("test-serial-examples/a/suite.gen.go")
+	require.NoError(t, err)
+	require.NotContains(t, string(suite), "s.Serial()")
+	stdout, _, exitCode, err = runner.Run("go test -count=1 ./test-serial-examples/...")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+
+	// the directive doesn't take args
+	require.NoError(t, os.WriteFile(filepath.Join(b, "README.md"), []byte("# gotestmd:serial yes\n"), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd --list " + input)
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, filepath.Join(b, "README.md")+`:1: # gotestmd:serial doesn't take args, got "yes"`)
+}
+
+func TestOut(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-out-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "docs", "Check"), os.ModePerm))
+	source := "# Run\n```bash\ntest -f README.md\n```\n"
+	require.NoError(t, os.WriteFile(filepath.Join(input, "docs", "Check", "README.md"), []byte(source), os.ModePerm))
+
+	runner := newRunner(t)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd " + input + " --out=test-out-examples --makefile")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+
+	// the input dir is mirrored and nothing is written next to the markdown
+	suite, err := os.ReadFile("test-out-examples/docs/check/suite.gen.go")
+	require.NoError(t, err)
+	require.Contains(t, string(suite), "package check\n")
+	entries, err := os.ReadDir(filepath.Join(input, "docs", "Check"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// the runner changes the dir to the source dir of the example
+	stdout, stderr, exitCode, err := runner.Run("go test ./test-out-examples/... -count=1")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+
+	_, stderr, exitCode, err = runner.Run("gotestmd " + input + " test-out-examples/ base/pkg --out=test-out-examples")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "flag --out can be used only with args: (string)input-dir (string)base-pkg[optional]")
+}
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-bash-examples")
+	})
+	dir := filepath.Join(t.TempDir(), "My-Example")
+
+	runner := newRunner(t)
+
+	stdout, stderr, exitCode, err := runner.Run("gotestmd init " + dir)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	for _, name := range []string{"README.md", "go.mod", "gen.go"} {
+		require.Contains(t, stdout, "created "+filepath.Join(dir, name))
+	}
+	goMod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	require.NoError(t, err)
+	require.Equal(t, "module my_example\n\ngo 1.20\n", string(goMod))
+
+	// the starter example is generated and its sample command passes
+	_, stderr, exitCode, err = runner.Run("gotestmd " + dir + " test-bash-examples/ --bash --match=.")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	stdout, stderr, exitCode, err = runner.Run("./test-bash-examples/suite.gen.sh run_all")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+	require.Contains(t, stdout, "hello from My-Example")
+
+	// existing files are not changed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Mine\n"), os.ModePerm))
+	_, stderr, exitCode, err = runner.Run("gotestmd init " + dir)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stderr, filepath.Join(dir, "README.md")+" already exists")
+	readme, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "# Mine\n", string(readme))
+
+	// the template is overridable, go.mod and the harness are created only outside of go modules
+	template := filepath.Join(t.TempDir(), "template.md")
+	require.NoError(t, os.WriteFile(template, []byte("# {{ .Title }} of {{ .Package }}\n"), os.ModePerm))
+	nested := filepath.Join(dir, "Nested")
+	stdout, stderr, exitCode, err = runner.Run("gotestmd init --template=" + template + " " + nested)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Equal(t, "created "+filepath.Join(nested, "README.md"), stdout)
+	readme, err = os.ReadFile(filepath.Join(nested, "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "# Nested of nested\n", string(readme))
+
+	// the harness created outside of go modules generates and runs the golang tests, the module of gotestmd is replaced
+	// with the module under test
+	harness := filepath.Join(t.TempDir(), "harness")
+	root, err := os.Getwd()
+	require.NoError(t, err)
+	_, stderr, exitCode, err = runner.Run("gotestmd init " + harness)
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	_, stderr, exitCode, err = runner.Run("(cd " + harness + " && go mod edit -replace=github.com/networkservicemesh/gotestmd=" + root +
+		" && go generate ./...)")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	_, stderr, exitCode, err = runner.Run("(cd " + harness + " && go mod tidy)")
+	require.NoError(t, err)
+	if exitCode != 0 {
+		t.Skipf("can't download the dependencies of the harness: %v", stderr)
+	}
+	stdout, stderr, exitCode, err = runner.Run("(cd " + harness + " && go test ./tests/... -count=1 -v)")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout+stderr)
+	require.Contains(t, stdout+stderr, "hello from harness")
+	require.Contains(t, stdout, "--- PASS: TestGeneratedSuite")
+}
+
+func TestSharedSession(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-session-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "A"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "B"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "A", "README.md"), []byte("# A\n## Includes\n- [B](../B)\n## Run\n```bash\nexport GREETING=hello\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "B", "README.md"),
+		[]byte("# B\n## Run\n```bash\n[ \"$GREETING\" = hello ]\n```\n```bash\ncd .. && export DIR=$(pwd)\n```\n"+
+			"## Cleanup\n```bash\n[ \"$(pwd)\" = \"$DIR\" ]\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-session-examples/ --makefile --shared-session")
+	source, err := os.ReadFile(filepath.Join("test-session-examples", "a", "suite.gen.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(source), "r := s.Session(")
+
+	stdout, _, exitCode, err := runner.Run("go test ./test-session-examples/... -count=1")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+
+	// without the shared session each test has own shell, so the variables of the suite are lost
+	run(t, runner, "gotestmd "+input+" test-session-examples/ --makefile")
+	_, _, exitCode, err = runner.Run("go test ./test-session-examples/... -count=1 -args -gotestmd.t=1s")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+}
+
+func TestGroups(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-group-examples")
+	})
+	input := t.TempDir()
+	marker := filepath.Join(input, "marker")
+	sources := map[string]string{
+		"A": "# A\n## Includes\n- [Pass](./Pass)\n- [Fail](./Fail)\n",
+		"A/Pass": "# Pass\n## Run\n```bash\n# gotestmd:group provision\nexport X=1\n```\n```bash\n# gotestmd:group provision\n[ \"$X\" = 1 ]\n```\n" +
+			"```bash\n# gotestmd:group verify\n[ \"$X\" = 1 ]\n```\n```bash\necho ungrouped\n```\n",
+		"A/Fail": "# Fail\n## Run\n```bash\n# gotestmd:group verify\nfalse\n```\n```bash\ntouch " + marker + "\n```\n",
+	}
+	for dir, source := range sources {
+		require.NoError(t, os.MkdirAll(filepath.Join(input, dir), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(input, dir, "README.md"), []byte(source), os.ModePerm))
+	}
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-group-examples/ --makefile")
+	source, err := os.ReadFile(filepath.Join("test-group-examples", "a", "suite.gen.go"))
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(source), "if !s.Run(\"provision\", func() {"))
+
+	// the groups share the shell of the test, the test stops when a group fails
+	stdout, _, exitCode, err := runner.Run("go test ./test-group-examples/... -count=1 -v -args -gotestmd.t=1s")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, "--- PASS: TestGeneratedSuite/TestPass/provision")
+	require.Contains(t, stdout, "--- PASS: TestGeneratedSuite/TestPass/verify")
+	require.Contains(t, stdout, "--- FAIL: TestGeneratedSuite/TestFail/verify")
+	require.NoFileExists(t, marker)
+}
+
+func TestStandaloneMain(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-main-examples")
+	})
+	input := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Pass"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Fail"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Pass", "README.md"), []byte("# Pass\n## Run\n```bash\necho passed\n```\n## Cleanup\n```bash\necho cleaned\n```\n"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Fail", "README.md"), []byte("# Fail\n## Run\n```bash\nexit 3\n```\n## Cleanup\n```bash\necho cleaned\n```\n"), os.ModePerm))
+
+	runner := newRunner(t)
+
+	run(t, runner, "gotestmd "+input+" test-main-examples/ --main -q")
+
+	stdout, _, exitCode, err := runner.Run("go run ./test-main-examples/pass/main")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Regexp(t, `(?s)passed.*cleaned`, stdout)
+
+	stdout, stderr, exitCode, err := runner.Run("go run ./test-main-examples/fail/main -timeout=1s")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stdout, "cleaned")
+	require.Contains(t, stderr, "exit 3")
+
+	_, _, exitCode, err = runner.Run("gotestmd " + input + " test-main-examples/ --main --bash --match=pass")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+
+	// the captured output is quoted, so it can contain quotes and heredoc delimiters
+	require.NoError(t, os.MkdirAll(filepath.Join(input, "Capture"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(input, "Capture", "README.md"),
+		[]byte("# Capture\n## Run\n```bash capture:VALUE\nprintf \"it's\\nGOTESTMD_EOF\\n\"\n```\n```bash\necho \"[$VALUE]\"\n```\n"), os.ModePerm))
+	run(t, runner, "gotestmd "+input+" test-main-examples/ --main -q")
+	stdout, stderr, exitCode, err = runner.Run("go run ./test-main-examples/capture/main")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Contains(t, stdout, "[it's\nGOTESTMD_EOF]")
+}
+
+func TestRender(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-render-examples")
+	})
+	base := generator.Dependencies{"github.com/networkservicemesh/gotestmd/pkg/suites/shell"}
+	suite := &generator.Suite{
+		Dir:         "examples/HelloWorld",
+		Location:    filepath.Join("test-render-examples", "hello", "suite.gen.go"),
+		Dependency:  "github.com/networkservicemesh/gotestmd/test-render-examples/hello",
+		Deps:        base,
+		DepsToSetup: base,
+		Shell:       "bash",
+		Run:         generator.Body{"echo hello"},
+		Tests: []*generator.Test{
+			{Dir: "examples/HelloWorld", Name: "World", Run: generator.Body{"echo world"}, Shell: "bash"},
+		},
+	}
+
+	// nothing is written
+	files, err := generator.Render([]*generator.Suite{suite}, generator.WithMain())
+	require.NoError(t, err)
+	require.NoDirExists(t, "test-render-examples")
+	require.Len(t, files, 2)
+	require.Contains(t, string(files[suite.Location]), "func (s *Suite) TestWorld() {")
+
+	for location, source := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(location), os.ModePerm))
+		require.NoError(t, os.WriteFile(location, source, os.ModePerm))
+	}
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+	stdout, stderr, exitCode, err := runner.Run("go run ./" + filepath.Dir(suite.MainLocation()))
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+	require.Regexp(t, `(?s)hello.*world`, stdout)
+}
+
+func TestGinkgo(t *testing.T) {
+	t.Cleanup(func() {
+		_ = os.RemoveAll("test-ginkgo-examples")
+	})
+	root, err := os.Getwd()
+	require.NoError(t, err)
+	// generated specs depend on ginkgo, so they are put into a separate module
+	require.NoError(t, os.MkdirAll("test-ginkgo-examples", os.ModePerm))
+	gomod := "module example.com/ginkgo\n\ngo 1.20\n\nrequire github.com/networkservicemesh/gotestmd v0.0.0\n\n" +
+		"replace github.com/networkservicemesh/gotestmd => " + root + "\n"
+	require.NoError(t, os.WriteFile("test-ginkgo-examples/go.mod", []byte(gomod), os.ModePerm))
+
+	runner, err := bash.New(bash.WithDir(filepath.Join(root, "test-ginkgo-examples")))
+	require.NoError(t, err)
+	defer runner.Close()
+	run(t, runner, "go install ..")
+
+	_, _, exitCode, err := runner.Run("gotestmd ../examples/ . --format=ginkgo --bash --match=.")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+
+	_, stderr, exitCode, err := runner.Run("gotestmd ../examples/ . --format=ginkgo --scenarios --dirs=absolute --keep-going")
+	require.NoError(t, err)
+	require.NotZero(t, exitCode)
+	require.Contains(t, stderr, "env files are not supported by ginkgo specs")
+	require.FileExists(t, "test-ginkgo-examples/producer/consumer2/suite.gen_test.go")
+
+	_, stderr, exitCode, err = runner.Run("go get github.com/onsi/ginkgo/v2@v2.13.0 github.com/onsi/gomega@v1.29.0")
+	require.NoError(t, err)
+	if exitCode != 0 {
+		t.Skipf("can't download ginkgo: %v", stderr)
+	}
+	_, stderr, exitCode, err = runner.Run("go mod tidy")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stderr)
+
+	stdout, _, exitCode, err := runner.Run("go test ./producer/... ./tree/... ./scenarios/ ./output/ ./allowfail/ ./expectfail/ -v")
+	require.NoError(t, err)
+	require.Zero(t, exitCode, stdout)
+	require.Contains(t, stdout, "ok  \texample.com/ginkgo/producer/consumer2")
+	require.Contains(t, stdout, "Ran 2 of 2 Specs")
 }
@@ -19,40 +19,140 @@
 package bash
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
 )
 
 const (
-	initialBufferSize    = 1 << 10
-	finishMessage        = "gotestmd/pkg/suites/shell/Bash.const.finish"
-	cmdPrintStatusCode   = `echo -e \\n$?`
-	cmdPrintStdoutFinish = `echo ` + finishMessage
-	cmdPrintStderrFinish = cmdPrintStdoutFinish + ` >&2`
+	defaultReadBufferSize = 1 << 16
+	defaultCloseTimeout   = 10 * time.Second
+	finishMessage         = "gotestmd/pkg/suites/shell/Bash.const.finish"
 )
 
+// message is an output of the command with the given id
+type message struct {
+	id   uint64
+	text string
+}
+
+var _ runner.Runner = (*Bash)(nil)
+
+// ErrProcessExited is returned if the shell process has exited unexpectedly, e.g. it was killed.
+// The runner can't be used after that. Use errors.As with *ProcessExitedError to get the exit code.
+var ErrProcessExited = errors.New("shell process has exited")
+
+// ErrClosed is returned by the commands run after Close
+var ErrClosed = errors.New("runner is closed")
+
+// errTimeout is returned by acquire if the command in progress doesn't finish in time
+var errTimeout = errors.New("timeout")
+
+// ProcessExitedError is returned if the shell process has exited unexpectedly
+type ProcessExitedError struct {
+	// ExitCode is the exit code of the process, -1 if the process was killed by a signal or the code is unknown
+	ExitCode int
+	// Err is the result of Process.Wait
+	Err error
+}
+
+func (e *ProcessExitedError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", ErrProcessExited, e.Err)
+	}
+	return fmt.Sprintf("%v with exit code %v", ErrProcessExited, e.ExitCode)
+}
+
+// Is returns true for ErrProcessExited
+func (e *ProcessExitedError) Is(target error) bool {
+	return target == ErrProcessExited
+}
+
+// Unwrap returns the result of Process.Wait
+func (e *ProcessExitedError) Unwrap() error {
+	return e.Err
+}
+
+// newProcessExitedError creates ProcessExitedError from the result of Process.Wait
+func newProcessExitedError(err error) *ProcessExitedError {
+	result := &ProcessExitedError{Err: err}
+	var exitErr interface{ ExitCode() int }
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+	}
+	return result
+}
+
 // Bash is api for bash process
 type Bash struct {
-	dir       string
-	env       []string
-	resources []io.Closer
-	ctx       context.Context
-	cancel    context.CancelFunc
+	// ReadBufferSize is the initial size of the buffers used to read stdout and stderr of the bash process.
+	// Zero means 64KiB.
+	ReadBufferSize int
+	// OnCommand is called before each command is run
+	OnCommand func(cmd string)
+	// OnResult is called after each command with its result and duration. stdout, stderr and the exit code are passed
+	// separately rather than as a single output: a command that exits with non-zero code is not an error of the runner,
+	// so err is set only if the command couldn't be run, and the hook can tell the failed commands apart by the exit code
+	OnResult func(cmd, stdout, stderr string, exitCode int, err error, d time.Duration)
+	// AutoRestart starts a new shell process before the next command if the process has exited, e.g. crashed.
+	// The state of the shell (variables, the current dir) is lost, the new process starts in the dir with the env of the runner.
+	AutoRestart bool
+	// RestartScript is run in the new shell process after the restart, e.g. to restore the state of the shell
+	RestartScript string
+	// CloseTimeout limits how long Close waits for the command in progress to finish before the process is killed.
+	// Zero means 10 seconds.
+	CloseTimeout time.Duration
 
-	cmd *exec.Cmd
+	dir    string
+	env    []string
+	shell  Shell
+	start  Starter
+	ctx    context.Context
+	cancel context.CancelFunc
 
-	stdin    io.Writer
-	stdoutCh chan string
-	stderrCh chan string
+	process Process
+	// exited is closed when the process exits
+	exited chan struct{}
+
+	stdoutCh chan message
+	stderrCh chan message
+	// processErr is the reason why the output of the process can't be read anymore
+	processErr   error
+	processErrMu sync.Mutex
+	// lastID is the id of the last command sent to the bash process.
+	// Each command prints its id in the finish message, so output of the previous commands can be told apart.
+	lastID uint64
+	// lastExitCode is the exit code of the last command, -1 if it didn't finish
+	lastExitCode int
+
+	// busy is held while a command runs, so Close waits for it
+	busy chan struct{}
+	// closing is closed when Close is called, the next commands fail with ErrClosed
+	closing   chan struct{}
+	closeOnce sync.Once
 }
 
 // New creates a new bash runner and initializes it
 func New(options ...Option) (*Bash, error) {
-	b := &Bash{}
+	b := &Bash{
+		shell:        DefaultShell(),
+		start:        StartLocal,
+		lastExitCode: -1,
+	}
 	for _, o := range options {
 		o(b)
 	}
@@ -65,17 +165,83 @@ func New(options ...Option) (*Bash, error) {
 	return b, nil
 }
 
-// Close closes current bash process and all the resources used by it
+// Close closes current bash process and all the resources used by it. If a command is in progress, Close waits for it
+// to finish up to CloseTimeout and then kills the process. The commands run after Close fail with ErrClosed
 func (b *Bash) Close() {
+	idle := true
+	b.closeOnce.Do(func() {
+		close(b.closing)
+		timer := time.NewTimer(b.CloseTimeout)
+		defer timer.Stop()
+		select {
+		case b.busy <- struct{}{}:
+			// busy is kept, so no command starts after the one in progress
+		case <-timer.C:
+			idle = false
+		}
+	})
 	b.cancel()
-	_, err := b.stdin.Write([]byte("exit 0\n"))
+	if !idle {
+		// the shell doesn't read exit until the command in progress finishes
+		_ = b.process.Kill()
+	} else if _, err := b.process.Stdin().Write([]byte(b.shell.Exit + "\n")); err != nil {
+		// the process is already dead or stuck, e.g. killed by RunContext
+		_ = b.process.Kill()
+	}
+	<-b.exited
+}
+
+// LastExitCode returns the exit code of the last command, so the callers can check a specific status.
+// Returns -1 if no command was run or the last command didn't finish, e.g. because of the timeout
+func (b *Bash) LastExitCode() int {
+	return b.lastExitCode
+}
+
+// Ping returns nil if the shell process is alive and responds within the timeout. Returns ErrProcessExited if the process
+// has exited, so a harness can restart the runner instead of hanging on a dead process, and ErrClosed after Close.
+// The probe waits for the command in progress like Run, the wait counts toward the timeout. The probe doesn't run a command:
+// the hooks are not called, LastExitCode is kept, the process is neither killed on timeout nor restarted with AutoRestart,
+// and a late response is dropped by the next command
+func (b *Bash) Ping(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	if err := b.acquire(timer.C); err != nil {
+		if errors.Is(err, errTimeout) {
+			return errors.Errorf("shell process didn't respond in %v, a command is in progress", timeout)
+		}
+		return err
+	}
+	defer b.release()
+	if err := b.err(); err != nil {
+		return err
+	}
+
+	b.lastID++
+	id := b.lastID
+	finish := fmt.Sprintf("%v:%v", finishMessage, id)
+	_, err := b.process.Stdin().Write([]byte(fmt.Sprintf(b.shell.PrintStdout, finish) + "\n" + fmt.Sprintf(b.shell.PrintStderr, finish) + "\n"))
 	if err != nil {
-		panic(err)
+		// the pipe is broken if the process has exited, the watcher reports the exit code
+		select {
+		case <-b.ctx.Done():
+			return b.err()
+		case <-timer.C:
+			return errors.Wrap(err, "can't write to the shell process")
+		}
 	}
-	_ = b.cmd.Wait()
-	for _, r := range b.resources {
-		_ = r.Close()
+	for _, ch := range []chan message{b.stdoutCh, b.stderrCh} {
+		for received := false; !received; {
+			select {
+			case msg := <-ch:
+				received = msg.id == id
+			case <-b.ctx.Done():
+				return b.err()
+			case <-timer.C:
+				return errors.Errorf("shell process didn't respond in %v", timeout)
+			}
+		}
 	}
+	return nil
 }
 
 // Dir returns the directory where the runner instance is located
@@ -89,73 +255,128 @@ func (b *Bash) Dir() string {
 //
 // You are advised to use bash.New instead, which calls this function automatically.
 func (b *Bash) Init() error {
-	b.ctx, b.cancel = context.WithCancel(context.Background())
-	b.stdoutCh = make(chan string)
-	b.stderrCh = make(chan string)
-	p, err := exec.LookPath("bash")
-	if err != nil {
-		return err
+	if b.ReadBufferSize < 0 {
+		return errors.Errorf("read buffer size should be positive: %v", b.ReadBufferSize)
 	}
-	if len(b.env) == 0 {
-		b.env = os.Environ()
+	if b.ReadBufferSize == 0 {
+		b.ReadBufferSize = defaultReadBufferSize
 	}
-	b.cmd = &exec.Cmd{
-		Dir:  b.dir,
-		Env:  b.env,
-		Path: p,
+	if b.CloseTimeout < 0 {
+		return errors.Errorf("close timeout should be positive: %v", b.CloseTimeout)
 	}
-
-	stderr, err := b.cmd.StderrPipe()
-	if err != nil {
-		return err
+	if b.CloseTimeout == 0 {
+		b.CloseTimeout = defaultCloseTimeout
 	}
-	b.resources = append(b.resources, stderr)
-
-	stdin, err := b.cmd.StdinPipe()
-	if err != nil {
-		return err
+	b.busy, b.closing = make(chan struct{}, 1), make(chan struct{})
+	if b.start == nil {
+		b.start = StartLocal
 	}
-	b.resources = append(b.resources, stdin)
-	b.stdin = stdin
+	return b.startProcess()
+}
 
-	stdout, err := b.cmd.StdoutPipe()
+// startProcess starts the shell process and the goroutines that read its output
+func (b *Bash) startProcess() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	process, err := b.start(b.shell, b.dir, b.env)
 	if err != nil {
+		cancel()
 		return err
 	}
-	b.resources = append(b.resources, stdout)
+	exited := make(chan struct{})
+	stdoutCh, stderrCh := make(chan message), make(chan message)
 
-	err = b.cmd.Start()
+	b.processErrMu.Lock()
+	b.ctx, b.cancel, b.process, b.exited, b.processErr = ctx, cancel, process, exited, nil
+	b.stdoutCh, b.stderrCh = stdoutCh, stderrCh
+	b.processErrMu.Unlock()
+
+	// the watcher stops the runner if the process exits, even if a child process keeps the pipes open
+	go func() {
+		b.fail(ctx, newProcessExitedError(process.Wait()))
+		close(exited)
+	}()
+	go b.extractMessagesFromPipe(ctx, exited, process.Stdout(), stdoutCh)
+	go b.extractMessagesFromPipe(ctx, exited, process.Stderr(), stderrCh)
+
+	return nil
+}
+
+// restart starts a new shell process if the previous one has exited and AutoRestart is set.
+// Runs RestartScript in the new process
+func (b *Bash) restart() error {
+	if !b.AutoRestart || !errors.Is(b.err(), ErrProcessExited) {
+		return nil
+	}
+	<-b.exited
+	if err := b.startProcess(); err != nil {
+		return errors.Wrap(err, "can't restart the shell process")
+	}
+	if b.RestartScript == "" {
+		return nil
+	}
+	_, stderr, exitCode, err := b.run(context.Background(), b.RestartScript)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "can't run the restart script")
+	}
+	if exitCode != 0 {
+		return errors.Errorf("restart script failed with exit code %v: %v", exitCode, stderr)
 	}
+	return nil
+}
 
-	go b.extractMessagesFromPipe(stdout, b.stdoutCh)
-	go b.extractMessagesFromPipe(stderr, b.stderrCh)
+// fail saves the reason why the runner can't be used anymore and stops the runner.
+// Does nothing if ctx belongs to a process that has been replaced by restart
+func (b *Bash) fail(ctx context.Context, err error) {
+	b.processErrMu.Lock()
+	defer b.processErrMu.Unlock()
+	if ctx != b.ctx {
+		return
+	}
+	if b.processErr == nil {
+		b.processErr = err
+	}
+	b.cancel()
+}
 
-	return nil
+// err returns the reason why the runner is stopped
+func (b *Bash) err() error {
+	if b.ctx.Err() == nil {
+		return nil
+	}
+	b.processErrMu.Lock()
+	defer b.processErrMu.Unlock()
+	if b.processErr != nil {
+		return b.processErr
+	}
+	return b.ctx.Err()
 }
 
-func (b *Bash) extractMessagesFromPipe(pipe io.Reader, ch chan string) {
-	var buffer = make([]byte, initialBufferSize)
+func (b *Bash) extractMessagesFromPipe(ctx context.Context, exited <-chan struct{}, pipe io.Reader, ch chan message) {
+	var buffer = make([]byte, b.ReadBufferSize)
 	cur := 0
-	for b.ctx.Err() == nil {
+	for ctx.Err() == nil {
 		n, err := pipe.Read(buffer[cur:])
+		if errors.Is(err, io.EOF) || errors.Is(err, os.ErrClosed) {
+			// the pipe is closed when the process exits, the watcher reports the exit code
+			<-exited
+			return
+		}
 		if err != nil {
+			b.fail(ctx, errors.Wrap(err, "can't read output of the shell process"))
 			return
 		}
 		cur += n
-		r := strings.TrimSpace(string(buffer[:cur]))
-		if strings.HasSuffix(r, finishMessage) {
-			if len(r) >= len(finishMessage) {
-				r = strings.TrimSpace(r[:len(r)-len(finishMessage)])
+		for {
+			msg, rest, ok := cutMessage(buffer[:cur])
+			if !ok {
+				break
 			}
 			select {
-			case ch <- r:
-			case <-b.ctx.Done():
+			case ch <- msg:
+			case <-ctx.Done():
 				return
 			}
-			cur = 0
-			continue
+			cur = copy(buffer, rest)
 		}
 		if cur == len(buffer) {
 			oldBuffer := buffer
@@ -165,27 +386,172 @@ func (b *Bash) extractMessagesFromPipe(pipe io.Reader, ch chan string) {
 	}
 }
 
-// Run runs the command
-func (b *Bash) Run(cmd string) (stdout, stderr string, exitCode int, err error) {
-	if b.ctx.Err() != nil {
-		return "", "", 0, b.ctx.Err()
+// cutMessage cuts the first complete message from the buffer.
+// Returns the message and the rest of the buffer if the buffer contains the finish message.
+func cutMessage(buffer []byte) (msg message, rest []byte, ok bool) {
+	start := bytes.Index(buffer, []byte(finishMessage+":"))
+	if start < 0 {
+		return message{}, nil, false
+	}
+	end := bytes.IndexByte(buffer[start:], '\n')
+	if end < 0 {
+		return message{}, nil, false
+	}
+	end += start
+	id, err := strconv.ParseUint(string(buffer[start+len(finishMessage)+1:end]), 10, 64)
+	if err != nil {
+		// The finish message is broken, skip it
+		return message{}, buffer[end+1:], true
 	}
+	return message{
+		id:   id,
+		text: strings.TrimSpace(string(buffer[:start])),
+	}, buffer[end+1:], true
+}
+
+// receive returns the output of the command with the given id. Output of the previous commands is dropped.
+// If ctx is done first, the process is killed, the runner is stopped and the context error is returned
+func (b *Bash) receive(ctx context.Context, ch chan message, id uint64) (string, error) {
+	for {
+		select {
+		case msg := <-ch:
+			if msg.id == id {
+				return msg.text, nil
+			}
+		case <-b.ctx.Done():
+			return "", b.err()
+		case <-ctx.Done():
+			b.cancel()
+			_ = b.process.Kill()
+			return "", ctx.Err()
+		}
+	}
+}
 
-	_, err = b.stdin.Write([]byte(cmd + "\n" + cmdPrintStatusCode + "\n" + cmdPrintStdoutFinish + "\n" + cmdPrintStderrFinish + "\n"))
+// StdinCommand returns a command that runs cmd with stdin as its standard input instead of the commands sent to the shell.
+// The stdin is not sent with the commands, it's written to a file of the shell process, so it can contain any text.
+// The file is kept until the process exits, so the command can be run several times, e.g. retried. A line break is added
+// to the stdin if it doesn't end with one, so its last line can be read with read. Returns an error if the shell
+// or its process doesn't support it
+func (b *Bash) StdinCommand(cmd, stdin string) (string, error) {
+	if b.shell.RunWithStdin == "" {
+		return "", errors.Errorf("%v doesn't support stdin of the commands", b.shell.Path)
+	}
+	b.processErrMu.Lock()
+	process := b.process
+	b.processErrMu.Unlock()
+	stdinProcess, ok := process.(StdinProcess)
+	if !ok {
+		return "", errors.Errorf("shell process %T doesn't support stdin of the commands", process)
+	}
+	if !strings.HasSuffix(stdin, "\n") {
+		stdin += "\n"
+	}
+	file, err := stdinProcess.WriteStdin(stdin)
 	if err != nil {
+		return "", errors.Wrap(err, "can't write stdin of the command")
+	}
+	return b.shell.StdinCommand(cmd, file)
+}
+
+// RunContext runs the command like Run. If ctx is done before the command finishes, the bash process is killed
+// and the context error is returned. The runner can't be used after that. The context is not checked after the command
+// has finished, so a command that finished in time succeeds even if ctx is done right after it.
+func (b *Bash) RunContext(ctx context.Context, cmd string) (stdout, stderr string, exitCode int, err error) {
+	if err = b.acquire(nil); err != nil {
+		return "", "", 0, err
+	}
+	defer b.release()
+	b.onCommand(cmd)
+	defer func(start time.Time) {
+		b.onResult(cmd, stdout, stderr, exitCode, err, time.Since(start))
+	}(time.Now())
+	if err = b.restart(); err != nil {
+		return "", "", 0, err
+	}
+	return b.run(ctx, cmd)
+}
+
+// Run runs the command. If the shell process has exited, returns ErrProcessExited or, if AutoRestart is set,
+// restarts the process first
+func (b *Bash) Run(cmd string) (stdout, stderr string, exitCode int, err error) {
+	if err = b.acquire(nil); err != nil {
 		return "", "", 0, err
 	}
+	defer b.release()
+	b.onCommand(cmd)
+	defer func(start time.Time) {
+		b.onResult(cmd, stdout, stderr, exitCode, err, time.Since(start))
+	}(time.Now())
+	if err = b.restart(); err != nil {
+		return "", "", 0, err
+	}
+	return b.run(context.Background(), cmd)
+}
 
+// acquire waits for the command in progress, e.g. run by another goroutine, to finish. Returns ErrClosed after Close
+// and errTimeout if the timeout fires first, nil timeout means no timeout
+func (b *Bash) acquire(timeout <-chan time.Time) error {
 	select {
-	case stdout = <-b.stdoutCh:
-	case <-b.ctx.Done():
-		return "", "", 0, nil
+	case <-b.closing:
+		return ErrClosed
+	default:
 	}
-
 	select {
-	case stderr = <-b.stderrCh:
-	case <-b.ctx.Done():
-		return "", "", 0, nil
+	case b.busy <- struct{}{}:
+		return nil
+	case <-b.closing:
+		return ErrClosed
+	case <-timeout:
+		return errTimeout
+	}
+}
+
+// interrupted wraps the error of the command that was interrupted because ctx is done
+func (b *Bash) interrupted(ctx context.Context, cmd string, err error) error {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return errors.Wrapf(err, "command %q was interrupted", cmd)
+	}
+	return err
+}
+
+func (b *Bash) release() {
+	<-b.busy
+}
+
+func (b *Bash) onCommand(cmd string) {
+	if b.OnCommand != nil {
+		b.OnCommand(cmd)
+	}
+}
+
+func (b *Bash) onResult(cmd, stdout, stderr string, exitCode int, err error, d time.Duration) {
+	if b.OnResult != nil {
+		b.OnResult(cmd, stdout, stderr, exitCode, err, d)
+	}
+}
+
+// run runs the command in the shell process. ctx is checked only until the output of the command is received
+func (b *Bash) run(ctx context.Context, cmd string) (stdout, stderr string, exitCode int, err error) {
+	b.lastExitCode = -1
+	if err = b.err(); err != nil {
+		return "", "", 0, err
+	}
+
+	b.lastID++
+	id := b.lastID
+	finish := fmt.Sprintf("%v:%v", finishMessage, id)
+	_, err = b.process.Stdin().Write([]byte(cmd + "\n" + b.shell.PrintStatus + "\n" +
+		fmt.Sprintf(b.shell.PrintStdout, finish) + "\n" + fmt.Sprintf(b.shell.PrintStderr, finish) + "\n"))
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	if stdout, err = b.receive(ctx, b.stdoutCh, id); err != nil {
+		return "", "", 0, b.interrupted(ctx, cmd, err)
+	}
+	if stderr, err = b.receive(ctx, b.stderrCh, id); err != nil {
+		return "", "", 0, b.interrupted(ctx, cmd, err)
 	}
 
 	lastLineBreak := strings.LastIndex(stdout, "\n")
@@ -203,6 +569,7 @@ func (b *Bash) Run(cmd string) (stdout, stderr string, exitCode int, err error)
 		return "", "", 0, err
 	}
 	exitCode = int(exitCode64)
+	b.lastExitCode = exitCode
 
 	return stdout, stderr, exitCode, nil
 }
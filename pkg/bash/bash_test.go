@@ -19,10 +19,17 @@
 package bash_test
 
 import (
+	"context"
+	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 
@@ -141,6 +148,102 @@ echo err >&2`)
 	require.Equal(t, "err", stderr)
 }
 
+func TestBashStderrWithSuccess(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	// output to stderr doesn't mean the command failed
+	stdout, stderr, exitCode, err := runner.Run("echo warn >&2; true")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Empty(t, stdout)
+	require.Equal(t, "warn", stderr)
+}
+
+func TestBashOutputLooksLikeStatus(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	// the status is detected by the exit code, not by the output. exit is run in a subshell to keep the shell alive
+	stdout, _, exitCode, err := runner.Run("(echo FAILED; exit 0)")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "FAILED", stdout)
+
+	stdout, _, exitCode, err = runner.Run("(echo OK; exit 1)")
+	require.NoError(t, err)
+	require.Equal(t, 1, exitCode)
+	require.Equal(t, "OK", stdout)
+}
+
+func TestBashStderrDoesNotLeakToNextCommand(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	stdout, stderr, exitCode, err := runner.Run(`echo warn >&2; true`)
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Empty(t, stdout)
+	require.Equal(t, "warn", stderr)
+
+	stdout, stderr, exitCode, err = runner.Run(`echo hi`)
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "hi", stdout)
+	require.Empty(t, stderr)
+}
+
+func TestBashStdinCommand(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	// the stdin is not sent to the shell with the commands, so it can look like commands or heredocs
+	cmd, err := runner.StdinCommand(`read -r -p "continue? " answer; read -r next; echo "$answer $next"`, "yes\nEOF'; exit 1")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		stdout, _, exitCode, err := runner.Run(cmd)
+		require.NoError(t, err)
+		require.Zero(t, exitCode)
+		require.Equal(t, "yes EOF'; exit 1", stdout)
+	}
+
+	// the next commands are not read as the input
+	stdout, _, exitCode, err := runner.Run(`echo next`)
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "next", stdout)
+
+	_, err = (bash.Shell{Path: "sh"}).StdinCommand("cat", "stdin")
+	require.Error(t, err)
+}
+
+func TestBashStdinCommandUnsupportedProcess(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	// the process hides WriteStdin of the local process, like a process on a remote host
+	runner, err := bash.New(bash.WithStarter(func(shell bash.Shell, dir string, env []string) (bash.Process, error) {
+		process, err := bash.StartLocal(shell, dir, env)
+		return struct{ bash.Process }{process}, err
+	}))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, err = runner.StdinCommand("cat", "yes")
+	require.Error(t, err)
+}
+
 func TestBashExitCode(t *testing.T) {
 	t.Cleanup(func() { goleak.VerifyNone(t) })
 
@@ -155,6 +258,124 @@ func TestBashExitCode(t *testing.T) {
 	require.Empty(t, stderr)
 }
 
+func TestBashLastExitCode(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	require.Equal(t, -1, runner.LastExitCode())
+	_, _, _, err = runner.Run(`$(exit 3)`)
+	require.NoError(t, err)
+	require.Equal(t, 3, runner.LastExitCode())
+	_, _, _, err = runner.Run(`true`)
+	require.NoError(t, err)
+	require.Zero(t, runner.LastExitCode())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, _, err = runner.RunContext(ctx, `sleep 1`)
+	require.Error(t, err)
+	require.Equal(t, -1, runner.LastExitCode())
+}
+
+func TestBashRunContextTimeout(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	stdout, _, exitCode, err := runner.RunContext(context.Background(), "echo hi")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "hi", stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	_, _, _, err = runner.RunContext(ctx, "sleep 10")
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	_, _, _, err = runner.Run("echo hi")
+	require.Error(t, err)
+}
+
+func TestBashRunContextDoneAfterRun(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	stdout, _, exitCode, err := runner.RunContext(ctx, "echo hi")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "hi", stdout)
+
+	// the context is checked only while the command runs, so the finished command doesn't kill the shell
+	<-ctx.Done()
+	stdout, _, exitCode, err = runner.Run("echo again")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "again", stdout)
+}
+
+func TestBashCloseWaitsForRun(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	started := make(chan struct{})
+	runner, err := bash.New(bash.WithOnCommand(func(string) { close(started) }))
+	require.NoError(t, err)
+
+	type result struct {
+		stdout   string
+		exitCode int
+		err      error
+	}
+	done := make(chan result)
+	go func() {
+		stdout, _, exitCode, err := runner.Run("sleep 0.5; echo finished")
+		done <- result{stdout: stdout, exitCode: exitCode, err: err}
+	}()
+	<-started
+	runner.Close()
+
+	r := <-done
+	require.NoError(t, r.err)
+	require.Zero(t, r.exitCode)
+	require.Equal(t, "finished", r.stdout)
+
+	_, _, _, err = runner.Run("echo hi")
+	require.True(t, errors.Is(err, bash.ErrClosed), err)
+	runner.Close()
+}
+
+func TestBashCloseTimeout(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	_, err := bash.New(bash.WithCloseTimeout(-time.Second))
+	require.Error(t, err)
+
+	started := make(chan struct{})
+	runner, err := bash.New(bash.WithCloseTimeout(time.Millisecond*100), bash.WithOnCommand(func(string) { close(started) }))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, _, _, err := runner.Run("sleep 10")
+		done <- err
+	}()
+	<-started
+	start := time.Now()
+	runner.Close()
+	require.True(t, time.Since(start) < time.Second*5, time.Since(start))
+	require.Error(t, <-done)
+}
+
 func randomString(n int) string {
 	var letter = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
@@ -165,3 +386,188 @@ func randomString(n int) string {
 	}
 	return string(b)
 }
+
+func TestBashReadBufferSize(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	_, err := bash.New(bash.WithReadBufferSize(-1))
+	require.Error(t, err)
+
+	runner, err := bash.New(bash.WithReadBufferSize(16))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	text := randomString(1000)
+	stdout, stderr, exitCode, err := runner.Run("echo " + text)
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, text, stdout)
+	require.Empty(t, stderr)
+}
+
+func TestBashProcessExit(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, _, _, err = runner.Run("exit 3")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, bash.ErrProcessExited), err.Error())
+	var exitedErr *bash.ProcessExitedError
+	require.True(t, errors.As(err, &exitedErr))
+	require.Equal(t, 3, exitedErr.ExitCode)
+
+	_, _, _, err = runner.Run("echo hi")
+	require.True(t, errors.Is(err, bash.ErrProcessExited), err.Error())
+}
+
+func TestBashAutoRestart(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New(bash.WithEnv([]string{"A=from-env"}), bash.WithAutoRestart("export B=from-script"))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, _, _, err = runner.Run("export A=changed; exit 1")
+	require.True(t, errors.Is(err, bash.ErrProcessExited), err)
+
+	// the state of the shell is lost, the env of the runner and the restart script are applied
+	stdout, _, exitCode, err := runner.Run("echo $A $B")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "from-env from-script", stdout)
+}
+
+func TestBashProcessKilled(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New()
+	require.NoError(t, err)
+	child, _, _, err := runner.Run("sleep 10 & echo $!")
+	require.NoError(t, err)
+
+	// the child process keeps the pipes open after the shell is killed
+	_, _, _, err = runner.Run("kill -9 $$")
+	require.Error(t, err)
+	var exitedErr *bash.ProcessExitedError
+	require.True(t, errors.As(err, &exitedErr), err.Error())
+	require.Equal(t, -1, exitedErr.ExitCode)
+
+	// the child is killed with the process group of the shell
+	runner.Close()
+	require.Eventually(t, func() bool {
+		stat, err := os.ReadFile(filepath.Join("/proc", child, "stat"))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBashPing(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	var commands []string
+	runner, err := bash.New(bash.WithOnCommand(func(cmd string) {
+		commands = append(commands, cmd)
+	}))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, _, exitCode, err := runner.Run("$(exit 3)")
+	require.NoError(t, err)
+	require.Equal(t, 3, exitCode)
+
+	// the probe doesn't look like a command to the callers
+	require.NoError(t, runner.Ping(time.Second))
+	require.Equal(t, 3, runner.LastExitCode())
+	require.Equal(t, []string{"$(exit 3)"}, commands)
+
+	stdout, _, exitCode, err := runner.Run("echo $$")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	pid, err := strconv.Atoi(stdout)
+	require.NoError(t, err)
+	process, err := os.FindProcess(pid)
+	require.NoError(t, err)
+	require.NoError(t, process.Kill())
+
+	err = runner.Ping(time.Second)
+	require.True(t, errors.Is(err, bash.ErrProcessExited), err)
+}
+
+func TestBashPingWaitsForRun(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	started := make(chan struct{})
+	runner, err := bash.New(bash.WithOnCommand(func(string) { close(started) }))
+	require.NoError(t, err)
+
+	type result struct {
+		stdout   string
+		exitCode int
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stdout, _, exitCode, err := runner.Run("sleep 1; echo finished")
+		done <- result{stdout: stdout, exitCode: exitCode, err: err}
+	}()
+	<-started
+
+	// the probe doesn't interleave with the command in progress
+	require.Error(t, runner.Ping(100*time.Millisecond))
+	require.NoError(t, runner.Ping(5*time.Second))
+
+	r := <-done
+	require.NoError(t, r.err)
+	require.Zero(t, r.exitCode)
+	require.Equal(t, "finished", r.stdout)
+
+	runner.Close()
+	require.True(t, errors.Is(runner.Ping(time.Second), bash.ErrClosed))
+}
+
+func TestBashEmptyEnv(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := bash.New(bash.WithEnv([]string{}))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	stdout, _, exitCode, err := runner.Run("echo \"[$HOME]\"")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "[]", stdout)
+}
+
+func TestBashHooks(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	var commands, results []string
+	var durations []time.Duration
+	runner, err := bash.New(
+		bash.WithOnCommand(func(cmd string) {
+			commands = append(commands, cmd)
+		}),
+		bash.WithOnResult(func(cmd, stdout, stderr string, exitCode int, err error, d time.Duration) {
+			results = append(results, fmt.Sprintf("%v: %v %v %v %v", cmd, stdout, stderr, exitCode, err))
+			durations = append(durations, d)
+		}),
+	)
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, _, _, err = runner.Run("echo hi; echo err >&2; false")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_, _, _, err = runner.RunContext(ctx, "sleep 10")
+	require.Error(t, err)
+
+	require.Equal(t, []string{"echo hi; echo err >&2; false", "sleep 10"}, commands)
+	require.Len(t, results, 2)
+	require.Equal(t, "echo hi; echo err >&2; false: hi err 1 <nil>", results[0])
+	require.Contains(t, results[1], "was interrupted")
+	require.True(t, durations[1] >= time.Millisecond*100)
+}
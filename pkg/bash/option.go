@@ -16,6 +16,8 @@
 
 package bash
 
+import "time"
+
 // Option is an option for the Runner
 type Option func(bash *Bash)
 
@@ -26,9 +28,60 @@ func WithDir(dir string) Option {
 	}
 }
 
-// WithEnv sets env variables for the bash runner
+// WithEnv sets env variables for the bash runner. Nil env means the env of the current process, empty env means no variables
 func WithEnv(env []string) Option {
 	return func(bash *Bash) {
 		bash.env = env
 	}
 }
+
+// WithReadBufferSize sets the initial size of the buffers used to read the bash process output
+func WithReadBufferSize(size int) Option {
+	return func(bash *Bash) {
+		bash.ReadBufferSize = size
+	}
+}
+
+// WithShell sets the shell process that runs the commands
+func WithShell(shell Shell) Option {
+	return func(bash *Bash) {
+		bash.shell = shell
+	}
+}
+
+// WithStarter sets the function that starts the shell process. By default the process is started on the local machine
+func WithStarter(start Starter) Option {
+	return func(bash *Bash) {
+		bash.start = start
+	}
+}
+
+// WithOnCommand sets a function that is called before each command is run
+func WithOnCommand(onCommand func(cmd string)) Option {
+	return func(bash *Bash) {
+		bash.OnCommand = onCommand
+	}
+}
+
+// WithOnResult sets a function that is called after each command with its result and duration, see Bash.OnResult
+func WithOnResult(onResult func(cmd, stdout, stderr string, exitCode int, err error, d time.Duration)) Option {
+	return func(bash *Bash) {
+		bash.OnResult = onResult
+	}
+}
+
+// WithAutoRestart makes the runner start a new shell process if the process has exited between the commands.
+// The script is run in the new process to restore the state of the shell, it can be empty
+func WithAutoRestart(script string) Option {
+	return func(bash *Bash) {
+		bash.AutoRestart = true
+		bash.RestartScript = script
+	}
+}
+
+// WithCloseTimeout sets how long Close waits for the command in progress to finish before the process is killed
+func WithCloseTimeout(timeout time.Duration) Option {
+	return func(bash *Bash) {
+		bash.CloseTimeout = timeout
+	}
+}
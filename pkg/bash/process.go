@@ -0,0 +1,155 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bash
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// Process is a started shell process
+type Process interface {
+	// Stdin returns stdin of the process
+	Stdin() io.Writer
+	// Stdout returns stdout of the process
+	Stdout() io.Reader
+	// Stderr returns stderr of the process
+	Stderr() io.Reader
+	// Wait waits for the process to exit and releases all the resources used by it
+	Wait() error
+	// Kill kills the process
+	Kill() error
+}
+
+// StdinProcess is a Process that can pass the stdin to the commands separately from the commands sent to the shell
+type StdinProcess interface {
+	Process
+	// WriteStdin writes the stdin of a command to a new file that the shell can read and returns its path.
+	// The file is removed when the process exits
+	WriteStdin(stdin string) (path string, err error)
+}
+
+// Starter starts the shell process in the dir with the env variables. Nil env means the env of the current process.
+type Starter func(shell Shell, dir string, env []string) (Process, error)
+
+// localProcess is a shell process on the local machine
+type localProcess struct {
+	cmd       *exec.Cmd
+	stdin     io.Writer
+	stdout    io.Reader
+	stderr    io.Reader
+	resources []io.Closer
+
+	// stdinFiles are the files written by WriteStdin, they are removed by Wait
+	stdinFiles   []string
+	stdinFilesMu sync.Mutex
+}
+
+// StartLocal starts the shell process on the local machine. It's the default Starter of Bash.
+func StartLocal(shell Shell, dir string, env []string) (Process, error) {
+	p, err := exec.LookPath(shell.Path)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	result := &localProcess{
+		cmd: &exec.Cmd{
+			Dir:  dir,
+			Env:  env,
+			Path: p,
+			Args: append([]string{shell.Path}, shell.Args...),
+		},
+	}
+	setProcessGroup(result.cmd)
+
+	stderr, err := result.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	result.resources = append(result.resources, stderr)
+	result.stderr = stderr
+
+	stdin, err := result.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	result.resources = append(result.resources, stdin)
+	result.stdin = stdin
+
+	stdout, err := result.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	result.resources = append(result.resources, stdout)
+	result.stdout = stdout
+
+	if err := result.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (p *localProcess) Stdin() io.Writer {
+	return p.stdin
+}
+
+func (p *localProcess) Stdout() io.Reader {
+	return p.stdout
+}
+
+func (p *localProcess) Stderr() io.Reader {
+	return p.stderr
+}
+
+func (p *localProcess) Wait() error {
+	err := p.cmd.Wait()
+	for _, r := range p.resources {
+		_ = r.Close()
+	}
+	p.stdinFilesMu.Lock()
+	defer p.stdinFilesMu.Unlock()
+	for _, path := range p.stdinFiles {
+		_ = os.Remove(path)
+	}
+	p.stdinFiles = nil
+	return err
+}
+
+// WriteStdin writes the stdin to a temp file, the shell runs on the same machine
+func (p *localProcess) WriteStdin(stdin string) (path string, err error) {
+	f, err := os.CreateTemp("", "gotestmd-stdin-")
+	if err != nil {
+		return "", err
+	}
+	p.stdinFilesMu.Lock()
+	p.stdinFiles = append(p.stdinFiles, f.Name())
+	p.stdinFilesMu.Unlock()
+	if _, err = f.WriteString(stdin); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// Kill kills the process group of the shell, so the commands started in the background don't outlive it
+func (p *localProcess) Kill() error {
+	return killProcessGroup(p.cmd)
+}
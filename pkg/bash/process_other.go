@@ -0,0 +1,29 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package bash
+
+import "os/exec"
+
+// setProcessGroup does nothing, process groups are not supported
+func setProcessGroup(_ *exec.Cmd) {}
+
+// killProcessGroup kills only the shell, process groups are not supported
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
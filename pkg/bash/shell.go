@@ -0,0 +1,69 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bash
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Shell describes the shell process that runs the commands. Bash is used by default.
+type Shell struct {
+	// Path is a name or a path of the shell executable
+	Path string
+	// Args are arguments of the shell executable. The shell should read the commands from stdin
+	Args []string
+	// PrintStatus is a command that prints a line break and the exit code of the previous command to stdout
+	PrintStatus string
+	// PrintStdout is a format of a command that prints its argument to stdout
+	PrintStdout string
+	// PrintStderr is a format of a command that prints its argument to stderr
+	PrintStderr string
+	// Exit is a command that exits the shell
+	Exit string
+	// RunWithStdin is a format of a command that runs the first argument with the file of the second argument as its stdin.
+	// The path is single-quoted like in bash. Empty means stdin is not supported by the shell
+	RunWithStdin string
+}
+
+// StdinCommand returns a command that runs cmd with the file as its standard input, so the command doesn't read
+// the next commands sent to the shell
+func (s Shell) StdinCommand(cmd, file string) (string, error) {
+	if s.RunWithStdin == "" {
+		return "", errors.Errorf("%v doesn't support stdin of the commands", s.Path)
+	}
+	return fmt.Sprintf(s.RunWithStdin, cmd, Quote(file)), nil
+}
+
+// Quote returns the string in single quotes, so bash reads it as a single word as is
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// DefaultShell returns Shell for bash
+func DefaultShell() Shell {
+	return Shell{
+		Path:         "bash",
+		PrintStatus:  `echo -e \\n$?`,
+		PrintStdout:  `echo %v`,
+		PrintStderr:  `echo %v >&2`,
+		Exit:         "exit 0",
+		RunWithStdin: "{\n%[1]v\n} <%[2]v",
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package docker provides a runner that runs the commands inside a docker container
+package docker
+
+import (
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
+)
+
+// Option is an option for the docker runner
+type Option func(c *config)
+
+type config struct {
+	workDir string
+	env     []string
+}
+
+// WithWorkDir sets the working directory inside the container
+func WithWorkDir(dir string) Option {
+	return func(c *config) {
+		c.workDir = dir
+	}
+}
+
+// WithEnv sets env variables inside the container
+func WithEnv(env []string) Option {
+	return func(c *config) {
+		c.env = append(c.env, env...)
+	}
+}
+
+// Shell returns bash.Shell that runs bash inside the running container with docker exec.
+// Stdin of the commands is not supported, the temp files of bash.Bash are written on the host
+func Shell(container string, options ...Option) bash.Shell {
+	return shell(append([]string{"exec", "-i"}, args(options)...), container)
+}
+
+// ImageShell returns bash.Shell that runs bash inside a new container of the image with docker run.
+// The container is removed when the runner is closed. Stdin of the commands is not supported like with Shell.
+func ImageShell(image string, options ...Option) bash.Shell {
+	return shell(append([]string{"run", "--rm", "-i"}, args(options)...), image)
+}
+
+func shell(args []string, target string) bash.Shell {
+	result := bash.DefaultShell()
+	result.Path = "docker"
+	result.Args = append(args, target, "bash")
+	// The stdin files are written on the host, the redirect would read them inside the container
+	result.RunWithStdin = ""
+	return result
+}
+
+func args(options []Option) []string {
+	c := &config{}
+	for _, o := range options {
+		o(c)
+	}
+	var result []string
+	if c.workDir != "" {
+		result = append(result, "-w", c.workDir)
+	}
+	for _, e := range c.env {
+		result = append(result, "-e", e)
+	}
+	return result
+}
+
+// New creates a new runner that runs the commands inside the running container
+func New(container string, options ...Option) (*bash.Bash, error) {
+	return bash.New(bash.WithShell(Shell(container, options...)))
+}
+
+// Factory returns runner.Factory that creates runners for the container.
+// Env variables passed to the factory are set inside the container, docker is started in the passed dir.
+func Factory(container string, options ...Option) runner.Factory {
+	return func(dir string, env ...string) (runner.Runner, error) {
+		b, err := bash.New(bash.WithDir(dir), bash.WithShell(Shell(container, append(append([]Option{}, options...), WithEnv(env))...)))
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
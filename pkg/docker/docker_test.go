@@ -0,0 +1,77 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/networkservicemesh/gotestmd/pkg/docker"
+)
+
+// fakeDocker puts a docker executable to PATH that saves its args and runs bash on the host
+func fakeDocker(t *testing.T) (argsFile string) {
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	script := "#!/bin/bash\necho \"$@\" > " + argsFile + "\nexec bash\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+func TestDockerExec(t *testing.T) {
+	argsFile := fakeDocker(t)
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := docker.New("my-container", docker.WithWorkDir("/work"), docker.WithEnv([]string{"A=1"}))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	stdout, stderr, exitCode, err := runner.Run("echo hello; echo world >&2; false")
+	require.NoError(t, err)
+	require.Equal(t, 1, exitCode)
+	require.Equal(t, "hello", stdout)
+	require.Equal(t, "world", stderr)
+
+	args, err := os.ReadFile(filepath.Clean(argsFile))
+	require.NoError(t, err)
+	require.Equal(t, "exec -i -w /work -e A=1 my-container bash", strings.TrimSpace(string(args)))
+}
+
+func TestDockerImageShell(t *testing.T) {
+	shell := docker.ImageShell("alpine", docker.WithWorkDir("/work"))
+	require.Equal(t, "docker", shell.Path)
+	require.Equal(t, []string{"run", "--rm", "-i", "-w", "/work", "alpine", "bash"}, shell.Args)
+}
+
+func TestDockerStdin(t *testing.T) {
+	fakeDocker(t)
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := docker.New("my-container")
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, err = runner.StdinCommand("cat", "hello")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "doesn't support stdin")
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envfile_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkservicemesh/gotestmd/pkg/envfile"
+)
+
+func TestParse(t *testing.T) {
+	env, err := envfile.Parse(strings.NewReader(`
+# comment
+A=1
+export B = two words # comment
+C='single # quoted $HOME'
+D="double \"quoted\"\nline # not a comment"
+E=
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"A=1",
+		"B=two words",
+		"C=single # quoted $HOME",
+		"D=double \"quoted\"\nline # not a comment",
+		"E=",
+	}, env)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := envfile.Parse(strings.NewReader("A=1\nnot a variable\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 2")
+
+	_, err = envfile.Parse(strings.NewReader(`A="unterminated`))
+	require.Error(t, err)
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+)
+
+const (
+	heredocDelim = "GOTESTMD_EOF"
+	// stateDirEnv overrides the parent dir of the markers of the commands annotated with once
+	stateDirEnv = "GOTESTMD_STATE_DIR"
+	// stateDirVar is a variable of generated bash scripts with the dir of the markers
+	stateDirVar = "gotestmd_state_dir"
+)
+
+// cutAnnotations cuts `# gotestmd:<name> [args]` lines from the beginning of the block.
+// Returns args of the annotations by their names and the rest of the block.
+func cutAnnotations(block string) (annotations map[string]string, rest string) {
+	annotations = map[string]string{}
+	for strings.HasPrefix(block, parser.AnnotationPrefix) {
+		line, next, _ := strings.Cut(block, "\n")
+		name, args, _ := strings.Cut(strings.TrimPrefix(line, parser.AnnotationPrefix), " ")
+		annotations[strings.TrimSpace(name)] = strings.TrimSpace(args)
+		block = next
+	}
+	return annotations, block
+}
+
+// splitAnnotations splits the block into the lines of the annotations, including the trailing newline, and the rest of the block
+func splitAnnotations(block string) (annotations, rest string) {
+	rest = block
+	for strings.HasPrefix(rest, parser.AnnotationPrefix) {
+		_, next, _ := strings.Cut(rest, "\n")
+		rest = next
+	}
+	return block[:len(block)-len(rest)], rest
+}
+
+// command returns the command that runs the block according to its annotations
+func command(block string) string {
+	annotations, body := cutAnnotations(block)
+	if interpreter := annotations["interpreter"]; interpreter != "" {
+		return heredoc(interpreter, body)
+	}
+	return body
+}
+
+// heredoc returns a command that runs cmd with the body as a quoted heredoc. A number is added to the delimiter
+// if the body contains it
+func heredoc(cmd, body string) string {
+	delim := heredocDelim
+	for i := 1; strings.Contains(body, delim); i++ {
+		delim = fmt.Sprintf("%v_%v", heredocDelim, i)
+	}
+	return fmt.Sprintf("%v <<'%v'\n%v\n%v", cmd, delim, body, delim)
+}
+
+// allowFail returns true if a failure of the block is only logged and doesn't fail the suite
+func allowFail(block string) bool {
+	annotations, _ := cutAnnotations(block)
+	_, ok := annotations["allow-fail"]
+	return ok
+}
+
+// expectedFailure returns the exit code the block is expected to fail with, zero means any non-zero exit code
+func expectedFailure(block string) (exitCode int, ok bool) {
+	annotations, _ := cutAnnotations(block)
+	args, ok := annotations["expect-fail"]
+	if !ok || args == "" {
+		return 0, ok
+	}
+	// the parser rejects invalid exit codes
+	exitCode, _ = strconv.Atoi(args)
+	return exitCode, true
+}
+
+// isExpectedFailure returns true if the block is expected to fail
+func isExpectedFailure(block string) bool {
+	_, ok := expectedFailure(block)
+	return ok
+}
+
+// sensitivePlaceholder is echoed by generated bash scripts instead of the commands annotated with sensitive
+const sensitivePlaceholder = "<sensitive command>"
+
+// sensitive returns true if the block contains secrets, e.g. tokens or passwords, so generated bash scripts don't echo
+// its command and don't trace it with set -x
+func sensitive(block string) bool {
+	annotations, _ := cutAnnotations(block)
+	_, ok := annotations["sensitive"]
+	return ok
+}
+
+// group returns the name of the group of the block, golang tests run the consecutive blocks of a group in a subtest
+func group(block string) string {
+	annotations, _ := cutAnnotations(block)
+	return annotations["group"]
+}
+
+// hasGroups returns true if a block of the body belongs to a group
+func (b Body) hasGroups() bool {
+	for _, block := range b {
+		if group(block) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// assertions returns the blocks annotated as assertions, generated bash scripts report their failures as failed assertions
+func assertions(b Body) Body {
+	var result Body
+	for _, block := range b {
+		result = append(result, parser.AnnotationPrefix+"assert\n"+block)
+	}
+	return result
+}
+
+// trailingSpaceRegex and blankRegex are used to normalize the output, generated code uses the same expressions
+var (
+	trailingSpaceRegex = regexp.MustCompile(`(?m)[ \t]+$`)
+	blankRegex         = regexp.MustCompile(`[ \t]+`)
+)
+
+// expectedOutput returns the expected output of the block and the mode of the check. The output is normalized by the mode.
+// The output of the blocks that are allowed or expected to fail is not checked
+func expectedOutput(block string) (output, mode string, ok bool) {
+	annotations, _ := cutAnnotations(block)
+	if _, ok := annotations["allow-fail"]; ok {
+		return "", "", false
+	}
+	if _, ok := annotations["expect-fail"]; ok {
+		return "", "", false
+	}
+	for _, mode = range []string{parser.OutputExact, parser.OutputTrimmed, parser.OutputNormalized, parser.OutputRegex} {
+		name := "output-" + mode
+		if mode == parser.OutputExact {
+			name = "output"
+		}
+		quoted, ok := annotations[name]
+		if !ok {
+			continue
+		}
+		output, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", "", false
+		}
+		return normalizeOutput(mode, output), mode, true
+	}
+	return "", "", false
+}
+
+// normalizeOutput returns the output normalized for the check of the mode
+func normalizeOutput(mode, output string) string {
+	switch mode {
+	case parser.OutputTrimmed:
+		return strings.TrimRight(trailingSpaceRegex.ReplaceAllString(output, ""), "\n")
+	case parser.OutputNormalized:
+		return blankRegex.ReplaceAllString(normalizeOutput(parser.OutputTrimmed, output), " ")
+	}
+	return output
+}
+
+// goNormalizeOutput returns a go expression that normalizes the output of the expression for the check of the mode
+func goNormalizeOutput(mode, expr string) string {
+	switch mode {
+	case parser.OutputExact:
+		return fmt.Sprintf("strings.TrimRight(%v, \"\\n\")", expr)
+	case parser.OutputTrimmed:
+		return fmt.Sprintf("strings.TrimRight(regexp.MustCompile(%q).ReplaceAllString(%v, \"\"), \"\\n\")", trailingSpaceRegex.String(), expr)
+	case parser.OutputNormalized:
+		return fmt.Sprintf("regexp.MustCompile(%q).ReplaceAllString(%v, \" \")", blankRegex.String(), goNormalizeOutput(parser.OutputTrimmed, expr))
+	}
+	return expr
+}
+
+// stdinInput returns the stdin of the block
+func stdinInput(block string) (stdin string, ok bool) {
+	annotations, _ := cutAnnotations(block)
+	quoted, ok := annotations["stdin"]
+	if !ok {
+		return "", false
+	}
+	stdin, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", false
+	}
+	return stdin, true
+}
+
+// envNameRegex matches the names of the environment variables that can be used in conditions
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// condition returns the environment variable and its value the block is run with. The conditions are checked by the parser,
+// a block without a valid condition is always run
+func condition(block string) (name, value string, ok bool) {
+	annotations, _ := cutAnnotations(block)
+	args, ok := annotations["if"]
+	if !ok {
+		return "", "", false
+	}
+	name, value, _ = strings.Cut(args, "=")
+	if !envNameRegex.MatchString(name) {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+// hasConditions returns true if some blocks of the body are run only with their conditions
+func (b Body) hasConditions() bool {
+	for _, block := range b {
+		if _, _, ok := condition(block); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// goCondition wraps the go code of the block into the check of its condition
+func goCondition(block, code string) string {
+	name, value, ok := condition(block)
+	if !ok {
+		return code
+	}
+	return fmt.Sprintf("if os.Getenv(%q) == %q {\n%v}\n", name, value, code)
+}
+
+// bashCondition wraps the bash code of the block into the check of its condition
+func bashCondition(block, code string) string {
+	name, value, ok := condition(block)
+	if !ok {
+		return code
+	}
+	return fmt.Sprintf("\tif [ \"${%v:-}\" = %v ]; then\n%v\tfi\n", name, bashQuote(value), code)
+}
+
+// capture returns the name of the variable the stdout of the block is captured to. The output of the blocks that are
+// allowed or expected to fail is not captured. The names are checked by the parser, an invalid name is not captured
+func capture(block string) (name string, ok bool) {
+	annotations, _ := cutAnnotations(block)
+	name, ok = annotations["capture"]
+	if !ok || allowFail(block) || isExpectedFailure(block) || !envNameRegex.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// sourceLines returns the first and the last lines of the block in the markdown file
+func sourceLines(block string) (first, last int, ok bool) {
+	annotations, _ := cutAnnotations(block)
+	args, ok := annotations["lines"]
+	if !ok {
+		return 0, 0, false
+	}
+	from, to, _ := strings.Cut(args, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, false
+	}
+	if last, err = strconv.Atoi(to); err != nil {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// blockHash returns a short hash of the block, it's used to name the marker of the block
+func blockHash(block string) string {
+	sum := sha256.Sum256([]byte(block))
+	return hex.EncodeToString(sum[:8])
+}
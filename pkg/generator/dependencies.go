@@ -0,0 +1,207 @@
+// Copyright (c) 2020-2021 Doc.ai and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Dependency represents test dependency
+type Dependency string
+
+// Pkg returns a string that can be imported
+func (d Dependency) Pkg() string {
+	return string(d)
+}
+
+// Name returns pkg name
+func (d Dependency) Name() string {
+	_, name := filepath.Split(d.Pkg())
+	return normalizeName(name)
+}
+
+// Dependencies represent an array of Dependency
+type Dependencies []Dependency
+
+// qualifiedName returns the name of the package qualified by the depth-1 parent dirs, e.g. one_basic for one/basic and depth 2
+func (d Dependency) qualifiedName(depth int) string {
+	pieces := strings.Split(filepath.ToSlash(d.Pkg()), "/")
+	if depth < len(pieces) {
+		pieces = pieces[len(pieces)-depth:]
+	}
+	for i := range pieces {
+		pieces[i] = normalizeName(pieces[i])
+	}
+	return strings.Join(pieces, "_")
+}
+
+// importString returns the import of the dependency, with the name if it's named by names differently from its package
+func (d Dependency) importString(names map[Dependency]string) string {
+	if name := localName(names, d); name != d.Name() {
+		return name + " \"" + d.Pkg() + "\""
+	}
+	return "\"" + d.Pkg() + "\""
+}
+
+// localName returns the name the dependency is referenced by in the generated code, the name of its package by default
+func localName(names map[Dependency]string, d Dependency) string {
+	if name, ok := names[d]; ok {
+		return name
+	}
+	return d.Name()
+}
+
+// LocalNames returns the names the dependencies are imported as. Packages of the dependencies in different dirs can have
+// the same name, but can't be imported into one package by it. If qualified is set, such dependencies are named
+// by as many trailing elements of their paths as needed to tell them apart, e.g. one_basic and two_basic for one/basic
+// and two/basic. Otherwise an error is returned for the first colliding name
+func (d Dependencies) LocalNames(qualified bool) (map[Dependency]string, error) {
+	names := map[Dependency]string{}
+	depths := map[Dependency]int{}
+	for _, dep := range d {
+		names[dep], depths[dep] = dep.Name(), 1
+	}
+	for {
+		collisions := collidingNames(names)
+		if len(collisions) == 0 {
+			return names, nil
+		}
+		if !qualified {
+			deps := collisions[0]
+			return nil, errors.Errorf("%v and %v are both imported as %v, use --qualified-names to import them by their paths",
+				deps[0].Pkg(), deps[1].Pkg(), names[deps[0]])
+		}
+		qualifiedAny := false
+		for _, deps := range collisions {
+			for _, dep := range deps {
+				if name := dep.qualifiedName(depths[dep] + 1); name != names[dep] {
+					names[dep], depths[dep] = name, depths[dep]+1
+					qualifiedAny = true
+				}
+			}
+		}
+		if !qualifiedAny {
+			deps := collisions[0]
+			return nil, errors.Errorf("%v and %v can't be told apart by their paths", deps[0].Pkg(), deps[1].Pkg())
+		}
+	}
+}
+
+// collidingNames returns the groups of the dependencies with the same name, sorted by the name and the packages
+func collidingNames(names map[Dependency]string) [][]Dependency {
+	byName := map[string][]Dependency{}
+	for dep, name := range names {
+		byName[name] = append(byName[name], dep)
+	}
+	var result [][]Dependency
+	for _, deps := range byName {
+		if len(deps) < 2 {
+			continue
+		}
+		sort.Slice(deps, func(i, j int) bool { return deps[i] < deps[j] })
+		result = append(result, deps)
+	}
+	sort.Slice(result, func(i, j int) bool { return names[result[i][0]] < names[result[j][0]] })
+	return result
+}
+
+// FieldsString returns a string that contains a declaration of suite dependencies as fields.
+// Types of the generated dependencies are named by suiteType pattern, fields and packages are named by names
+func (d Dependencies) FieldsString(suiteType string, names map[Dependency]string) string {
+	var result strings.Builder
+	for i := 0; i < len(d); i++ {
+		if i != 0 {
+			_, _ = result.WriteString(localName(names, d[i]))
+			_, _ = result.WriteString("Suite ")
+		}
+		_, _ = result.WriteString(localName(names, d[i]))
+		_, _ = result.WriteString(".")
+		if i == 0 {
+			_, _ = result.WriteString("Suite")
+		} else {
+			_, _ = result.WriteString(suiteTypeName(suiteType, d[i].Name()))
+		}
+		if i+1 < len(d) {
+			_, _ = result.WriteString("\n")
+		}
+	}
+
+	return result.String()
+}
+
+// SetupString returns a string that contains a declaration of suite dependencies as part of setup function.
+// Fields of the dependencies are named by names
+func (d Dependencies) SetupString(names map[Dependency]string) string {
+	if len(d) == 0 {
+		return ""
+	}
+
+	var result strings.Builder
+
+	result.WriteString("parents := []interface{}{")
+	result.WriteString("&s.Suite")
+	for i := 1; i < len(d); i++ {
+		if i < len(d) {
+			result.WriteString(",")
+		}
+		result.WriteString("&s.")
+		result.WriteString(localName(names, d[i]))
+		result.WriteString("Suite")
+	}
+	result.WriteString("}\n")
+
+	result.WriteString(`for _, p := range parents {
+		if v, ok := p.(suite.TestingSuite); ok {
+			v.SetT(s.T())
+		}
+		if v, ok := p.(suite.SetupAllSuite); ok {
+			v.SetupSuite()
+		}
+	}
+`)
+
+	return result.String()
+}
+
+// String returns a string that contains a declaration of suite dependencies as part of import
+func (d Dependencies) String() string {
+	return d.ImportsString(nil)
+}
+
+// ImportsString returns a string that contains a declaration of suite dependencies as part of import.
+// Dependencies named by names differently from their packages are imported with the names
+func (d Dependencies) ImportsString(names map[Dependency]string) string {
+	var result strings.Builder
+
+	if len(d) > 0 {
+		_, _ = result.WriteString(`"github.com/stretchr/testify/suite"`)
+		_, _ = result.WriteString("\n")
+	}
+
+	for i := 0; i < len(d); i++ {
+		_, _ = result.WriteString(d[i].importString(names))
+		if i+1 < len(d) {
+			_, _ = result.WriteString("\n")
+		}
+	}
+
+	return result.String()
+}
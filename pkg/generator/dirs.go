@@ -0,0 +1,93 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	// DirsDefault keeps dirs of golang tests as they are passed to gotestmd and makes dirs of bash scripts absolute
+	DirsDefault = ""
+	// DirsAbsolute makes all dirs absolute at generation time
+	DirsAbsolute = "absolute"
+	// DirsRelative makes the dirs of bash scripts relative to the base dir and the dirs of golang tests relative to the root
+	// of the go module, that golang tests resolve them against. Both can be overridden at runtime with GOTESTMD_ROOT env
+	DirsRelative = "relative"
+)
+
+const rootEnv = "GOTESTMD_ROOT"
+
+// Dirs defines how dirs of the examples are referenced in the generated code
+type Dirs struct {
+	Mode string
+	// Base is an absolute dir that relative dirs of bash scripts are calculated from
+	Base string
+	// Root is the absolute root of the go module that relative dirs of golang tests are calculated from, because golang
+	// tests resolve them against it. Defaults to Base
+	Root string
+}
+
+// Runner returns the dir to pass to the runner of golang tests
+func (d Dirs) Runner(dir string) string {
+	switch d.Mode {
+	case DirsAbsolute:
+		absDir, _ := filepath.Abs(dir)
+		return absDir
+	case DirsRelative:
+		root := d.Root
+		if root == "" {
+			root = d.Base
+		}
+		return relative(root, dir)
+	default:
+		return dir
+	}
+}
+
+// Bash returns the dir to cd into in bash scripts
+func (d Dirs) Bash(dir string) string {
+	if d.Mode == DirsRelative {
+		return fmt.Sprintf(`"$%v"/%v`, rootEnv, relative(d.Base, dir))
+	}
+	absDir, _ := filepath.Abs(dir)
+	return absDir
+}
+
+// BashRoot returns bash code that defines the base dir for the script located at location
+func (d Dirs) BashRoot(location string) string {
+	if d.Mode != DirsRelative {
+		return ""
+	}
+	absDir, _ := filepath.Abs(filepath.Dir(location))
+	rel, err := filepath.Rel(absDir, d.Base)
+	if err != nil {
+		return fmt.Sprintf("%v=\"${%v:-%v}\"\n", rootEnv, rootEnv, d.Base)
+	}
+	return fmt.Sprintf("%v=\"${%v:-$(cd \"$(dirname \"${BASH_SOURCE[0]}\")\"/%v && pwd)}\"\n", rootEnv, rootEnv, rel)
+}
+
+// relative returns the dir relative to the base or the absolute dir if it can't be made relative
+func relative(base, dir string) string {
+	absDir, _ := filepath.Abs(dir)
+	rel, err := filepath.Rel(base, absDir)
+	if err != nil {
+		return absDir
+	}
+	return rel
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Env is the environment of the runners. Nil Env means the runners inherit the environment of the tests
+type Env struct {
+	// Inherit is a list of the variables inherited from the environment of the tests
+	Inherit []string
+	// Vars are variables with explicit values
+	Vars map[string]string
+}
+
+// RunnerArgs returns the env argument of the runner constructor
+func (e *Env) RunnerArgs() string {
+	if e == nil {
+		return ""
+	}
+	var vars []string
+	inherited := map[string]bool{}
+	for _, name := range e.Inherit {
+		if inherited[name] {
+			continue
+		}
+		inherited[name] = true
+		vars = append(vars, fmt.Sprintf("%q+os.Getenv(%q)", name+"=", name))
+	}
+	var names []string
+	for name := range e.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vars = append(vars, fmt.Sprintf("%q", name+"="+e.Vars[name]))
+	}
+	return fmt.Sprintf(", []string{%v}...", strings.Join(vars, ", "))
+}
+
+// Merge returns Env with the variables of both envs. Variables of the other env take precedence
+func (e *Env) Merge(other *Env) *Env {
+	if e == nil {
+		return other
+	}
+	if other == nil {
+		return e
+	}
+	result := &Env{
+		Inherit: append(append([]string{}, e.Inherit...), other.Inherit...),
+		Vars:    map[string]string{},
+	}
+	for k, v := range e.Vars {
+		result.Vars[k] = v
+	}
+	for k, v := range other.Vars {
+		result.Vars[k] = v
+	}
+	return result
+}
+
+// EnvFile is an env file loaded before the commands
+type EnvFile struct {
+	Path string
+	// MissingOK makes a missing file a warning instead of a failure
+	MissingOK bool
+}
+
+// GoString returns an expression that reads variables of the env file in generated golang code
+func (f *EnvFile) GoString(dirs Dirs) string {
+	return fmt.Sprintf("s.EnvFile(%q, %v)", dirs.Runner(f.Path), f.MissingOK)
+}
+
+// BashString returns commands that export variables of the env file in generated bash scripts
+func (f *EnvFile) BashString(dirs Dirs) string {
+	if f == nil {
+		return ""
+	}
+	path := dirs.Bash(f.Path)
+	missing := "\t\treturn 1\n"
+	message := "env file %v doesn't exist"
+	if f.MissingOK {
+		missing = ""
+		message = "warning: " + message
+	}
+	return fmt.Sprintf("\tif [ -f %[1]v ]; then\n\t\tset -a\n\t\t. %[1]v\n\t\tset +a\n\telse\n\t\techo \"%[2]v\" >&2\n%[3]v\tfi\n",
+		path, fmt.Sprintf(message, f.Path), missing)
+}
+
+// runnerEnvArgs returns the env argument of the runner constructor. Variables of the env file are added to the environment
+// of the tests, or to the env if it's declared
+func runnerEnvArgs(env *Env, file *EnvFile, dirs Dirs) string {
+	if file == nil {
+		return env.RunnerArgs()
+	}
+	base := "os.Environ()"
+	if env != nil {
+		base = strings.TrimSuffix(strings.TrimPrefix(env.RunnerArgs(), ", "), "...")
+	}
+	return fmt.Sprintf(", append(%v, %v...)...", base, file.GoString(dirs))
+}
+
+// envUsesOS returns true if the env argument of the runner uses os package
+func envUsesOS(env *Env, file *EnvFile) bool {
+	if env == nil {
+		return file != nil
+	}
+	return len(env.Inherit) > 0
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import "fmt"
+
+// Error is returned if a suite, a test or a test file can't be generated
+type Error struct {
+	// Kind is what can't be generated: "suite", "test" or "test file"
+	Kind string
+	// Dir is the dir of the example
+	Dir string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cannot generate %v for %v: %v", e.Kind, e.Dir, e.Err)
+}
+
+// Cause returns the underlying error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
+)
+
+func TestError(t *testing.T) {
+	suite := helloSuite()
+	suite.SharedSession = true
+	suite.Tests[0].Dir = "examples/PowerShell"
+	suite.Tests[0].Shell = "powershell"
+
+	_, err := generator.Render([]*generator.Suite{suite})
+	require.Error(t, err)
+	var generatorErr *generator.Error
+	require.True(t, errors.As(errors.Wrap(err, "cannot render"), &generatorErr), err)
+	require.Equal(t, "test", generatorErr.Kind)
+	require.Equal(t, "examples/PowerShell", generatorErr.Dir)
+	require.EqualError(t, errors.Cause(err), "shared sessions are not supported for powershell examples")
+	require.EqualError(t, err, "cannot generate test for examples/PowerShell: shared sessions are not supported for powershell examples")
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
+)
+
+// Execute runs the suite with the runner like the generated bash script does: setup of the dependencies, setup of the suite,
+// all the tests and then cleanup. Cleanup is run even if setup or tests fail, its errors are ignored.
+// Returns the first error.
+func (s *Suite) Execute(ctx context.Context, r runner.Runner) error {
+	defer func() {
+		cleanup := append(s.bashChdir(), s.Cleanup...)
+		for _, p := range s.Parents {
+			cleanup = append(cleanup, p.getDependenciesCleanup()...)
+		}
+		// cleanup shouldn't report errors, but should run even if ctx is done
+		_ = execute(context.Background(), r, cleanup)
+	}()
+
+	var setup Body
+	for _, p := range s.Parents {
+		setup = append(setup, p.getDependenciesSetup()...)
+	}
+	setup = append(setup, s.bashChdir()...)
+	setup = append(setup, s.Run...)
+	if err := execute(ctx, r, setup); err != nil {
+		return errors.Wrapf(err, "setup of suite %v failed", s.Dir)
+	}
+	if err := execute(ctx, r, s.Assert); err != nil {
+		return errors.Wrapf(err, "assertion of suite %v failed", s.Dir)
+	}
+
+	for _, t := range s.Tests {
+		if err := t.execute(ctx, r); err != nil {
+			return errors.Wrapf(err, "test %v of suite %v failed", t.Name, s.Dir)
+		}
+	}
+	return nil
+}
+
+func (t *Test) execute(ctx context.Context, r runner.Runner) error {
+	for _, c := range t.cases() {
+		run := c.runAndAssert()
+		if !t.NoChdir {
+			run = append(Body{"cd " + t.Dirs.Bash(t.Dir)}, run...)
+		}
+		err := execute(ctx, r, run)
+		_ = execute(context.Background(), r, c.Cleanup)
+		if err != nil && c.Name != "" {
+			return errors.Wrapf(err, "case %v failed", c.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute runs the blocks one by one. Returns an error if a block fails
+func execute(ctx context.Context, r runner.Runner, b Body) error {
+	for _, block := range b {
+		cmd := command(block)
+		_, stderr, exitCode, err := r.RunContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			if sensitive(block) {
+				cmd = sensitivePlaceholder
+			}
+			return errors.Errorf("command %q failed with exit code %v: %v", cmd, exitCode, stderr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
+)
+
+func TestSuiteExecute(t *testing.T) {
+	dir := t.TempDir()
+	testDir := filepath.Join(dir, "test")
+	require.NoError(t, os.Mkdir(testDir, os.ModePerm))
+	log := filepath.Join(t.TempDir(), "log")
+	suite := &generator.Suite{
+		Dir:     dir,
+		Run:     generator.Body{"echo setup $PWD >> " + log},
+		Cleanup: generator.Body{"echo cleanup $PWD >> " + log},
+		Tests: []*generator.Test{
+			{Dir: testDir, Name: "First", Run: generator.Body{"echo first $PWD >> " + log}},
+		},
+	}
+
+	r, err := bash.New()
+	require.NoError(t, err)
+	defer r.Close()
+	require.NoError(t, suite.Execute(context.Background(), r))
+
+	// each test is run in its dir, cleanup in the dir of the suite
+	output, err := os.ReadFile(log)
+	require.NoError(t, err)
+	require.Equal(t, "setup "+dir+"\nfirst "+testDir+"\ncleanup "+dir+"\n", string(output))
+}
+
+func TestSuiteExecuteFailure(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	suite := &generator.Suite{
+		Dir:     dir,
+		Cleanup: generator.Body{"echo cleanup >> " + log},
+		Tests: []*generator.Test{
+			{Dir: dir, Name: "Fail", Run: generator.Body{"echo oops >&2; false"}},
+			{Dir: dir, Name: "Next", Run: generator.Body{"echo next >> " + log}},
+		},
+	}
+
+	r, err := bash.New()
+	require.NoError(t, err)
+	defer r.Close()
+	err = suite.Execute(context.Background(), r)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "test Fail of suite "+dir+" failed")
+	require.Contains(t, err.Error(), `command "echo oops >&2; false" failed with exit code 1: oops`)
+
+	// the next tests are not run, but the cleanup is
+	output, err := os.ReadFile(log)
+	require.NoError(t, err)
+	require.Equal(t, "cleanup\n", string(output))
+}
+
+func TestSuiteExecuteSensitive(t *testing.T) {
+	suite := &generator.Suite{
+		Dir: t.TempDir(),
+		Run: generator.Body{"# gotestmd:sensitive\nTOKEN=secret; (exit 3)"},
+	}
+
+	r, err := bash.New()
+	require.NoError(t, err)
+	defer r.Close()
+	err = suite.Execute(context.Background(), r)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `setup of suite`)
+	require.Contains(t, err.Error(), `command "<sensitive command>" failed with exit code 3`)
+	require.NotContains(t, err.Error(), "secret")
+}
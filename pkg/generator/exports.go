@@ -0,0 +1,121 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// exportedEnvFile is the file in the state dir with the variables exported by the setup of a bash script
+const exportedEnvFile = "exported.env"
+
+var (
+	// exportRegex matches export commands and captures their arguments
+	exportRegex = regexp.MustCompile(`(?m)(?:^|[;&|({]\s*|\bthen\s+|\bdo\s+)export\s+([^;&|\n]*)`)
+	// exportNameRegex matches an argument of export command that names a variable, e.g. NAME or NAME=value
+	exportNameRegex = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(?:=|$)`)
+)
+
+// exportedNames returns the sorted names of the variables exported by the commands of the body
+func exportedNames(b Body) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, block := range b {
+		_, cmd := cutAnnotations(block)
+		for _, m := range exportRegex.FindAllStringSubmatch(cmd, -1) {
+			for _, arg := range strings.Fields(m[1]) {
+				name := exportNameRegex.FindStringSubmatch(arg)
+				if name == nil || seen[name[1]] {
+					continue
+				}
+				seen[name[1]] = true
+				result = append(result, name[1])
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// usesVariable returns true if the commands of the body reference the variable, e.g. $NAME or ${NAME:-default}
+func usesVariable(b Body, name string) bool {
+	r := regexp.MustCompile(`\$\{?` + name + `\b`)
+	for _, block := range b {
+		_, cmd := cutAnnotations(block)
+		if r.MatchString(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportWarnings returns the warnings about the variables exported by the setup of the bash script and used by the other targets.
+// Each target of the script runs in own process, so the variables are visible only if the targets run together with run_all
+func (s *Suite) exportWarnings(exported []string) []string {
+	type target struct {
+		name string
+		body Body
+	}
+	targets := []target{{"the assertions", s.Assert}, {"the cleanup", s.Cleanup}}
+	for _, test := range s.Tests {
+		targets = append(targets, target{"test " + test.Name, append(append(append(Body{}, test.Run...), test.Assert...), test.Cleanup...)})
+	}
+	var result []string
+	for _, name := range exported {
+		for _, t := range targets {
+			if usesVariable(t.body, name) && !contains(exportedNames(t.body), name) {
+				result = append(result, fmt.Sprintf("%v: %v is exported by the setup and used by %v, it isn't visible if the targets "+
+					"of the bash script are run separately, use --persist-env to keep it", s.Dir, name, t.name))
+			}
+		}
+	}
+	return result
+}
+
+// bashSaveEnv returns save_env function of the bash script that saves the exported variables to the state dir
+func bashSaveEnv(exported []string) string {
+	var sb strings.Builder
+	sb.WriteString("\n# the variables exported by the setup are saved for the targets run in separate processes\nsave_env() {\n")
+	fmt.Fprintf(&sb, "\tmkdir -p \"$%v\" && {\n", stateDirVar)
+	for _, name := range exported {
+		fmt.Fprintf(&sb, "\t\t[ -z \"${%[1]v+x}\" ] || printf 'export %%s=%%q\\n' %[1]v \"$%[1]v\"\n", name)
+	}
+	fmt.Fprintf(&sb, "\t} >\"$%v/%v\"\n}\n", stateDirVar, exportedEnvFile)
+	return sb.String()
+}
+
+// bashLoadEnv returns the commands of the bash script that restore the saved variables for the targets run separately
+// from the setup
+func bashLoadEnv() string {
+	return fmt.Sprintf(`# the variables exported by the setup are restored for the targets run in separate processes
+if [ "$1" != setup ] && [ "$1" != run_all ] && [ -f "$%[1]v/%[2]v" ]; then
+	source "$%[1]v/%[2]v"
+fi
+`, stateDirVar, exportedEnvFile)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
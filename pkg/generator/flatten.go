@@ -0,0 +1,85 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// flatten returns the suites which setup is inlined into the setup of the flattened suite in order of the setup: each
+// required suite after its own requires, the suite itself and then the included suites, each suite once. Returns the tests
+// of the suite followed by the tests and the assertions of the included suites, prefixed with the names of the included suites
+func (s *Suite) flatten() (flat []*Suite, tests []*Test) {
+	seen := map[*Suite]bool{}
+	var require func(x *Suite)
+	require = func(x *Suite) {
+		if x == nil || seen[x] {
+			return
+		}
+		seen[x] = true
+		for _, parent := range x.Parents {
+			require(parent)
+		}
+		flat = append(flat, x)
+	}
+	var include func(x *Suite, prefix string)
+	include = func(x *Suite, prefix string) {
+		for _, parent := range x.Parents {
+			require(parent)
+		}
+		if !seen[x] {
+			seen[x] = true
+			flat = append(flat, x)
+		}
+		if x == s {
+			tests = append(tests, x.Tests...)
+		} else {
+			for _, test := range append(x.assertTest(), x.Tests...) {
+				c := *test
+				c.Name = strings.TrimSuffix(prefix+test.Name, "_")
+				c.SuiteType = s.TypeName()
+				tests = append(tests, &c)
+			}
+		}
+		for _, child := range x.Children {
+			include(child, prefix+testName(filepath.Base(child.Dir))+"_")
+		}
+	}
+	include(s, "")
+	return flat, tests
+}
+
+// flatSetup returns the setup of the suite inlined into the setup of a flattened suite. The commands run in own runner
+// in the dir of the suite and the cleanup is registered before them, so the cleanups of the inlined suites run in reverse order
+func (s *Suite) flatSetup() string {
+	if len(s.Run)+len(s.Cleanup) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "{\nr := s.%v(%q%v)\n", runnerFunc(s.Shell, s.SharedSession), s.runnerDir(), runnerEnvArgs(s.Env, s.EnvFile, s.Dirs))
+	if s.CommandTimeout > 0 {
+		_, _ = fmt.Fprintf(&sb, "r.SetCommandTimeout(%v)\n", s.commandTimeout())
+	}
+	if cleanup := s.Cleanup.goString(s.sourceFile(), s.RequireNoError, s.LogCommands); cleanup != "" {
+		_, _ = fmt.Fprintf(&sb, "s.T().Cleanup(func() {\n%v\n})\n", cleanup)
+	}
+	sb.WriteString(s.Run.goString(s.sourceFile(), s.RequireNoError, s.LogCommands))
+	sb.WriteString("\n}\n")
+	return sb.String()
+}
@@ -0,0 +1,432 @@
+// Copyright (c) 2020-2023 Doc.ai and/or its affiliates.
+//
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+
+	"github.com/networkservicemesh/gotestmd/internal/config"
+	"github.com/networkservicemesh/gotestmd/internal/linker"
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+)
+
+// Generator can generate suites from the slice of linker.LinedExample
+type Generator struct {
+	conf       config.Config
+	transforms []Transform
+}
+
+// Transform rewrites a command before it's written to generated code
+type Transform func(cmd string) string
+
+// Option is an option for the Generator
+type Option func(g *Generator)
+
+// WithTransform adds the transform of the commands of the suites and tests. Transforms are applied in the order they are added,
+// after {{gotestmd:name}} variables and before {{matrix:name}} placeholders are substituted. The commands are not transformed by default
+func WithTransform(transform Transform) Option {
+	return func(g *Generator) {
+		g.transforms = append(g.transforms, transform)
+	}
+}
+
+// New creates new Generator instance
+func New(conf config.Config, options ...Option) *Generator {
+	g := &Generator{
+		conf: conf,
+	}
+	for _, o := range options {
+		o(g)
+	}
+	return g
+}
+
+func (g *Generator) dirs() Dirs {
+	root, _ := filepath.Abs(findRoot())
+	base := root
+	if g.conf.DirsBase != "" {
+		base, _ = filepath.Abs(g.conf.DirsBase)
+	}
+	return Dirs{
+		Mode: g.conf.Dirs,
+		Base: base,
+		Root: root,
+	}
+}
+
+// Generate generates suites based on passed examples
+func (g *Generator) Generate(examples ...*linker.LinkedExample) []*Suite {
+	var result []*Suite
+	var tests = map[string][]*Test{}
+	var index = map[string]*Suite{}
+	var children = map[string][]*Suite{}
+	var orders = map[string][]string{}
+	moduleName := moduleName(g.conf.OutputDir)
+	dirs := g.dirs()
+	for _, e := range examples {
+		if e.IsLeaf() {
+			_, name := path.Split(e.Name)
+			for _, parent := range e.Parents {
+				tests[parent.Name] = append(tests[parent.Name], &Test{
+					Dir:     e.Dir,
+					Name:    testName(name),
+					Cleanup: e.Cleanup,
+					Run:     e.Run,
+					Assert:  assertions(e.Assert),
+					Matrix:  e.Matrix,
+
+					CommandTimeout: g.conf.CommandTimeout,
+					Dirs:           dirs,
+					Shell:          e.Shell,
+					RequireNoError: g.conf.RequireNoError,
+					SharedSession:  g.conf.SharedSession,
+					Env:            g.env(e),
+					NoChdir:        e.NoChdir,
+					EnvFile:        g.envFile(e),
+					Timing:         g.conf.Timing,
+					LogCommands:    g.conf.LogCommands,
+				})
+				for _, scenario := range e.Scenarios {
+					tests[parent.Name] = append(tests[parent.Name], g.scenarioTest(e, testName(name)+"_", scenario))
+				}
+			}
+			continue
+		}
+
+		// Scenarios of the suite are its own tests
+		for _, scenario := range e.Scenarios {
+			tests[e.Name] = append(tests[e.Name], g.scenarioTest(e, "", scenario))
+		}
+
+		if len(e.Matrix) > 0 && len(e.Scenarios) == 0 {
+			logrus.Warnf("matrix is supported only for tests and scenarios, it is ignored for the suite %v", e.Name)
+		}
+
+		// Dependencies to import
+		var deps = Dependencies([]Dependency{Dependency(g.conf.BasePkg)})
+		deps = append(deps, normalizeDeps(moduleName, e.Dependencies())...)
+
+		// Parent suites to setup first
+		var depsToSetup = Dependencies([]Dependency{Dependency(g.conf.BasePkg)})
+		depsToSetup = append(depsToSetup, normalizeDeps(moduleName, e.ParentDependencies())...)
+
+		location := filepath.Join(g.conf.OutputDir, strings.ToLower(e.Name))
+		if g.conf.Bash {
+			location = filepath.Join(location, "suite.gen.sh")
+		} else {
+			location = filepath.Join(location, "suite.gen.go")
+		}
+		s := &Suite{
+			Dir:         e.Dir,
+			Location:    location,
+			Dependency:  Dependency(path.Join(g.conf.OutputDir, strings.ToLower(e.Name))),
+			Cleanup:     e.Cleanup,
+			Run:         e.Run,
+			Assert:      assertions(e.Assert),
+			Deps:        deps,
+			DepsToSetup: depsToSetup,
+
+			CommandTimeout: g.conf.CommandTimeout,
+			Dirs:           dirs,
+			Shell:          e.Shell,
+			RequireNoError: g.conf.RequireNoError,
+			SharedSession:  g.conf.SharedSession,
+			Env:            g.env(e),
+			NoChdir:        e.NoChdir,
+			EnvFile:        g.envFile(e),
+			Timing:         g.conf.Timing,
+			LogCommands:    g.conf.LogCommands,
+
+			RetryMaxAttempts: g.conf.RetryMaxAttempts,
+			RetryJitter:      g.conf.RetryJitter,
+			RetryTimeout:     g.retryTimeout(e),
+			Serial:           e.Serial,
+			SuiteType:        g.conf.SuiteType,
+			QualifiedNames:   g.conf.QualifiedNames,
+			PersistEnv:       g.conf.PersistEnv,
+			IsGlobal:         e.Global,
+		}
+
+		// Remember if suite is a subsuite
+		for _, parent := range e.Parents {
+			children[parent.Name] = append(children[parent.Name], s)
+		}
+		result = append(result, s)
+
+		index[e.Name] = s
+		orders[e.Name] = e.Order
+	}
+
+	// Apply tests to the suites
+	for k, v := range tests {
+		for _, test := range v {
+			test.SuiteType = index[k].TypeName()
+		}
+		index[k].Tests = append(index[k].Tests, v...)
+	}
+
+	// Apply subsuites to the suites
+	for k, v := range children {
+		index[k].Children = orderChildren(index[k].Dir, append(index[k].Children, v...), orders[k])
+	}
+
+	for _, e := range examples {
+		for _, require := range e.Requires {
+			index[e.Name].Parents = append(index[e.Name].Parents, index[require])
+		}
+	}
+
+	// The global suite is set up before all the other suites
+	for _, e := range examples {
+		if !e.Global {
+			continue
+		}
+		for _, s := range result {
+			if s != index[e.Name] {
+				s.Global = index[e.Name]
+				s.GlobalPkg = normalizeDeps(moduleName, []string{e.Name})[0]
+			}
+		}
+	}
+
+	// Sections of the examples split into suites are separate suites in the packages of the examples
+	for _, e := range examples {
+		if len(e.Suites) == 0 {
+			continue
+		}
+		if e.IsLeaf() {
+			logrus.Warnf("suites of the sections are supported only for suites, they are ignored for the test %v", e.Name)
+			continue
+		}
+		for _, section := range e.Suites {
+			result = append(result, index[e.Name].section(section.Name, section.Run, section.Cleanup))
+		}
+	}
+
+	// All the golang suites are generated into one file of the package of the output dir
+	if g.conf.SingleFile {
+		g.consolidate(result)
+	}
+
+	for _, s := range result {
+		s.Run, s.Cleanup, s.Assert = g.transform(s.Dir, s.Run), g.transform(s.Dir, s.Cleanup), g.transform(s.Dir, s.Assert)
+		s.Run, s.Cleanup, s.Assert = g.strip(s.Shell, s.Run), g.strip(s.Shell, s.Cleanup), g.strip(s.Shell, s.Assert)
+		s.Run, s.Cleanup, s.Assert = g.split(s.Shell, s.Run), g.split(s.Shell, s.Cleanup), g.split(s.Shell, s.Assert)
+		for _, test := range s.Tests {
+			test.Run, test.Cleanup, test.Assert = g.transform(test.Dir, test.Run), g.transform(test.Dir, test.Cleanup), g.transform(test.Dir, test.Assert)
+			test.Run, test.Cleanup, test.Assert = g.strip(test.Shell, test.Run), g.strip(test.Shell, test.Cleanup), g.strip(test.Shell, test.Assert)
+			test.Run, test.Cleanup, test.Assert = g.split(test.Shell, test.Run), g.split(test.Shell, test.Cleanup), g.split(test.Shell, test.Assert)
+		}
+	}
+
+	// Flattened suites inline the setup of the required and included suites instead of running them as nested suites.
+	// All the suites are flattened before any of them is changed, so the tests of the included suites are not repeated
+	if g.conf.Flatten {
+		flat := make([][]*Suite, len(result))
+		flatTests := make([][]*Test, len(result))
+		for i, s := range result {
+			if !s.IsGlobal {
+				flat[i], flatTests[i] = s.flatten()
+			}
+		}
+		for i, s := range result {
+			if !s.IsGlobal {
+				s.Flat, s.Tests = flat[i], flatTests[i]
+			}
+		}
+	}
+
+	return result
+}
+
+// CheckLocations returns an error if several suites are generated into the same file, e.g. suites of the dirs
+// with the names that differ only in case, or into the same type of the single file
+func CheckLocations(suites []*Suite) error {
+	dirs := map[string]string{}
+	for _, s := range suites {
+		// the suites generated into one file are told apart by their types
+		key := s.Location
+		if s.Siblings != nil {
+			key += " as " + s.TypeName()
+		}
+		if dir, ok := dirs[key]; ok {
+			return errors.Errorf("suites of %v and %v are both generated into %v", dir, s.Dir, key)
+		}
+		dirs[key] = s.Dir
+	}
+	return nil
+}
+
+// transform substitutes the variables and applies the transforms to the commands of the body of the example in the dir.
+// Annotations of the blocks are kept as is
+func (g *Generator) transform(dir string, b Body) Body {
+	if len(b) == 0 {
+		return b
+	}
+	result := make(Body, 0, len(b))
+	for _, block := range b {
+		annotations, cmd := splitAnnotations(block)
+		cmd = g.substituteVars(dir, cmd)
+		for _, t := range g.transforms {
+			cmd = t(cmd)
+		}
+		result = append(result, annotations+cmd)
+	}
+	return result
+}
+
+// split splits the blocks of the body run with the shell into single commands if it's enabled in the config.
+// Only bash commands are split
+func (g *Generator) split(shell string, b Body) Body {
+	if !g.conf.SplitCommands || shell == parser.ShellPowerShell {
+		return b
+	}
+	return splitCommands(b)
+}
+
+// strip removes blank and comment lines from the blocks of the body run with the shell if it's enabled in the config.
+// Only bash commands are stripped
+func (g *Generator) strip(shell string, b Body) Body {
+	if !g.conf.StripComments || shell == parser.ShellPowerShell {
+		return b
+	}
+	return stripComments(b)
+}
+
+// varRegex matches {{gotestmd:name}} placeholders of the variables substituted at generation time
+var varRegex = regexp.MustCompile(`\{\{gotestmd:([\w.-]+)\}\}`)
+
+// substituteVars replaces {{gotestmd:name}} placeholders of the command of the example in the dir with the values of the variables.
+// Placeholders without values are kept as is
+func (g *Generator) substituteVars(dir, cmd string) string {
+	return varRegex.ReplaceAllStringFunc(cmd, func(placeholder string) string {
+		name := varRegex.FindStringSubmatch(placeholder)[1]
+		value, ok := g.conf.Vars[name]
+		if !ok {
+			logrus.Warnf("%v: %v has no value, set it with --var %v=VALUE", dir, placeholder, name)
+			return placeholder
+		}
+		return value
+	})
+}
+
+// orderChildren sorts the included suites in the order declared in the front matter of the suite. Suites that are not
+// declared follow in alphabetical order of their dirs
+func orderChildren(dir string, suites []*Suite, order []string) []*Suite {
+	included := map[string]bool{}
+	for _, s := range suites {
+		included[filepath.Clean(s.Dir)] = true
+	}
+	positions := map[string]int{}
+	for i, o := range order {
+		if !included[filepath.Join(dir, o)] {
+			logrus.Warnf("%v is declared in the order of %v, but it's not an included suite. It is ignored", o, dir)
+		}
+		positions[filepath.Join(dir, o)] = i
+	}
+
+	sort.SliceStable(suites, func(i, j int) bool {
+		pi, iOrdered := positions[filepath.Clean(suites[i].Dir)]
+		pj, jOrdered := positions[filepath.Clean(suites[j].Dir)]
+		switch {
+		case iOrdered && jOrdered:
+			return pi < pj
+		case iOrdered != jOrdered:
+			return iOrdered
+		default:
+			return suites[i].Dir < suites[j].Dir
+		}
+	})
+	return suites
+}
+
+// scenarioTest creates a test for the scenario of the example. The test runs in the dir of the example
+func (g *Generator) scenarioTest(e *linker.LinkedExample, prefix string, scenario *parser.Scenario) *Test {
+	return &Test{
+		Dir:     e.Dir,
+		Name:    prefix + testName(scenario.Name),
+		Cleanup: scenario.Cleanup,
+		Run:     scenario.Run,
+		Matrix:  e.Matrix,
+
+		CommandTimeout: g.conf.CommandTimeout,
+		Dirs:           g.dirs(),
+		Shell:          e.Shell,
+		RequireNoError: g.conf.RequireNoError,
+		SharedSession:  g.conf.SharedSession,
+		Env:            g.env(e),
+		NoChdir:        e.NoChdir,
+		EnvFile:        g.envFile(e),
+		Timing:         g.conf.Timing,
+		LogCommands:    g.conf.LogCommands,
+	}
+}
+
+// env returns the environment of the runners of the example. It's nil if the environment is not declared
+func (g *Generator) env(e *linker.LinkedExample) *Env {
+	var result *Env
+	if g.conf.HermeticEnv {
+		result = &Env{Inherit: g.conf.EnvInherit}
+	}
+	if e.Env != nil {
+		result = result.Merge(&Env{Inherit: e.Env.Inherit, Vars: e.Env.Vars})
+	}
+	return result
+}
+
+// envFile returns the env file of the example. The env file of the front matter is relative to the dir of the example
+// and takes precedence over the env file of the config
+func (g *Generator) envFile(e *linker.LinkedExample) *EnvFile {
+	path := g.conf.EnvFile
+	if e.EnvFile != "" {
+		path = e.EnvFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(e.Dir, path)
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	return &EnvFile{Path: path, MissingOK: g.conf.EnvFileMissingOK}
+}
+
+// retryTimeout returns the timeout of the retried commands of the example. The timeout declared by the example takes
+// precedence over the timeout of the config
+func (g *Generator) retryTimeout(e *linker.LinkedExample) time.Duration {
+	if e.RetryTimeout > 0 {
+		return time.Duration(e.RetryTimeout) * time.Second
+	}
+	return g.conf.RetryTimeout
+}
+
+func testName(name string) string {
+	return cases.Title(language.Und, cases.NoLower).String(nameRegex.ReplaceAllString(name, "_"))
+}
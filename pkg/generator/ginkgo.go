@@ -0,0 +1,411 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+)
+
+const (
+	// FormatTestify renders suites as testify suites
+	FormatTestify = "testify"
+	// FormatGinkgo renders suites as ginkgo specs
+	FormatGinkgo = "ginkgo"
+)
+
+const ginkgoSuiteTemplate = `// Code generated by gotestmd DO NOT EDIT.
+package {{ .Name }}
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
+	{{ .Imports }}
+)
+
+// Setup sets up the dependencies of the suite and the suite itself. Cleanup is deferred until the current spec finishes
+func Setup() {
+	{{ range .Parents }}
+	{{ . }}.Setup()
+	{{ end }}
+	{{ if or .Run .Cleanup }}
+	r := newRunner({{ .NewShell }}, "{{ .Dir }}"{{ .EnvArgs }})
+	{{ if .Cleanup }}
+	DeferCleanup(func() {
+		{{ .Cleanup }}
+	})
+	{{ end }}
+	{{ .Run }}
+	{{ end }}
+}
+
+// newRunner creates a runner in the dir. Relative dir is resolved against the root of the go module.
+// The runner is closed when the current spec finishes
+func newRunner(newShell func(...bash.Option) (*bash.Bash, error), dir string, env ...string) *bash.Bash {
+	options := []bash.Option{bash.WithDir(runner.Resolve(dir))}
+	if env != nil {
+		options = append(options, bash.WithEnv(env))
+	}
+	r, err := newShell(options...)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(r.Close)
+	for _, assignment := range captured {
+		run(r, assignment)
+	}
+	return r
+}
+
+// captured are the assignments of the variables captured from the output of the commands, they are run by the new runners
+var captured []string
+
+// capture assigns the output of a command to the shell variable in the runner and in the runners created later
+func capture(r *bash.Bash, name, out string) {
+	assignment := name + "=" + bash.Quote(out)
+	captured = append(captured, assignment)
+	run(r, assignment)
+}
+
+// stdin returns a command that runs cmd with the stdin as its standard input
+func stdin(r *bash.Bash, cmd, input string) string {
+	result, err := r.StdinCommand(cmd, input)
+	Expect(err).NotTo(HaveOccurred(), cmd)
+	return result
+}
+
+// commandTimeout is the timeout for a single run of a command. Zero means no timeout
+const commandTimeout = {{ .CommandTimeout }}
+
+// run runs the command and returns its stdout. Tries to run the command several times, until it succeeds or a minute passes.
+// Fails the spec if the command can't be run successfully
+func run(r *bash.Bash, cmd string) string {
+	var stdout string
+	Eventually(func(g Gomega) {
+		ctx := context.Background()
+		if commandTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+		}
+		var stderr string
+		var exitCode int
+		var err error
+		stdout, stderr, exitCode, err = r.RunContext(ctx, cmd)
+		Expect(err).NotTo(HaveOccurred(), cmd)
+		g.Expect(exitCode).To(BeZero(), "command failed: %v\nstdout: %v\nstderr: %v", cmd, stdout, stderr)
+	}).WithTimeout(time.Minute).WithPolling(100 * time.Millisecond).Should(Succeed())
+	return stdout
+}
+
+// runFail runs the command until it fails with the exit code, or with any non-zero exit code if the exit code is zero.
+// Fails the spec if the command doesn't fail as expected until a minute passes or succeeds, a success is not retried
+func runFail(r *bash.Bash, cmd string, exitCode int) {
+	Eventually(func(g Gomega) {
+		ctx := context.Background()
+		if commandTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+		}
+		stdout, stderr, code, err := r.RunContext(ctx, cmd)
+		Expect(err).NotTo(HaveOccurred(), cmd)
+		Expect(code).NotTo(BeZero(), "command succeeded, but it's expected to fail: %v\nstdout: %v\nstderr: %v", cmd, stdout, stderr)
+		if exitCode > 0 {
+			g.Expect(code).To(Equal(exitCode), "command didn't fail with expected exit code: %v\nstdout: %v\nstderr: %v", cmd, stdout, stderr)
+		} else {
+			g.Expect(code).NotTo(BeZero(), "command didn't fail: %v\nstdout: %v\nstderr: %v", cmd, stdout, stderr)
+		}
+	}).WithTimeout(time.Minute).WithPolling(100 * time.Millisecond).Should(Succeed())
+}
+
+// tryRun runs the command once and returns true if it succeeds. The failure is only logged, it doesn't fail the spec
+func tryRun(r *bash.Bash, cmd string) bool {
+	ctx := context.Background()
+	if commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+	}
+	stdout, stderr, exitCode, err := r.RunContext(ctx, cmd)
+	if err != nil || exitCode != 0 {
+		GinkgoWriter.Printf("allowed to fail: %v\nexit code: %v, error: %v\nstdout: %v\nstderr: %v\n", cmd, exitCode, err, stdout, stderr)
+		return false
+	}
+	return true
+}
+`
+
+const ginkgoSpecsTemplate = `// Code generated by gotestmd DO NOT EDIT.
+package {{ .Name }}
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	{{ .Imports }}
+)
+
+func TestGeneratedSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "{{ .Name }}")
+}
+
+var _ = Describe("{{ .Name }}", {{ if .Serial }}Serial, {{ end }}func() {
+	BeforeEach(Setup)
+	{{ range .Specs }}
+	It("{{ .Name }}", func() {
+		{{ if or .Run .Cleanup }}
+		r := newRunner({{ .NewShell }}, "{{ .Dir }}"{{ .EnvArgs }})
+		{{ if .Cleanup }}
+		DeferCleanup(func() {
+			{{ .Cleanup }}
+		})
+		{{ end }}
+		{{ .Run }}
+		{{ end }}
+	})
+	{{ end }}
+})
+`
+
+// ginkgoString returns the body as a part of a ginkgo spec
+func (b Body) ginkgoString() string {
+	var sb strings.Builder
+	for _, block := range b {
+		var code strings.Builder
+		cmd := goCommand(block)
+		run := goStdinCommand(block, cmd, "stdin(r, %v, %q)")
+		output, mode, ok := expectedOutput(block)
+		name, captures := capture(block)
+		switch {
+		case allowFail(block):
+			code.WriteString("tryRun(r, " + run + ")\n")
+		case isExpectedFailure(block):
+			exitCode, _ := expectedFailure(block)
+			fmt.Fprintf(&code, "runFail(r, %v, %v)\n", run, exitCode)
+		case captures:
+			code.WriteString("{\nout := run(r, " + run + ")\n")
+			if ok {
+				code.WriteString(ginkgoExpectOutput("out", cmd, output, mode))
+			}
+			fmt.Fprintf(&code, "capture(r, %q, out)\n}\n", name)
+		case !ok:
+			code.WriteString("run(r, " + run + ")\n")
+		default:
+			code.WriteString(ginkgoExpectOutput("run(r, "+run+")", cmd, output, mode))
+		}
+		sb.WriteString(goCondition(block, code.String()))
+	}
+	return sb.String()
+}
+
+// ginkgoExpectOutput returns the expectation of the output of the expression
+func ginkgoExpectOutput(expr, cmd, output, mode string) string {
+	if mode == parser.OutputRegex {
+		return fmt.Sprintf("Expect(%v).To(MatchRegexp(%q), %v)\n", expr, output, cmd)
+	}
+	return fmt.Sprintf("Expect(%v).To(Equal(%q), %v)\n", goNormalizeOutput(mode, expr), output, cmd)
+}
+
+// ginkgoShell returns the constructor of the runner for the shell
+func ginkgoShell(shell string) string {
+	if shell == parser.ShellPowerShell {
+		return "powershell.New"
+	}
+	return "bash.New"
+}
+
+// ginkgoImports returns imports used by the bodies run with the shells and the envs
+func ginkgoImports(bodies []Body, shells []string, envs []*Env) string {
+	var imports []string
+	for _, shell := range shells {
+		if shell == parser.ShellPowerShell {
+			imports = append(imports, `"github.com/networkservicemesh/gotestmd/pkg/powershell"`)
+			break
+		}
+	}
+	usesOS := false
+	for _, env := range envs {
+		usesOS = usesOS || envUsesOS(env, nil)
+	}
+	for _, b := range bodies {
+		usesOS = usesOS || b.hasConditions()
+	}
+	if usesOS {
+		imports = append(imports, `"os"`)
+	}
+	// regular expressions are matched by gomega, regexp is used only to normalize the output
+	var usesStrings, usesRegexp bool
+	for _, b := range bodies {
+		modes := b.outputModes()
+		normalized := modes[parser.OutputTrimmed] || modes[parser.OutputNormalized]
+		usesStrings = usesStrings || modes[parser.OutputExact] || normalized
+		usesRegexp = usesRegexp || normalized
+	}
+	if usesStrings {
+		imports = append(imports, `"strings"`)
+	}
+	if usesRegexp {
+		imports = append(imports, `"regexp"`)
+	}
+	return strings.Join(imports, "\n")
+}
+
+// GinkgoSource returns the suite as a package with Setup function that sets up the suite and its dependencies
+// in ginkgo specs. Specs of the suite are rendered by GinkgoSpecsSource
+func (s *Suite) GinkgoSource() (string, error) {
+	if err := s.checkNoEnvFile("ginkgo specs"); err != nil {
+		return "", err
+	}
+	if err := s.checkNotGlobal("ginkgo specs"); err != nil {
+		return "", err
+	}
+	if err := s.checkNoSection("ginkgo specs"); err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("ginkgo").Parse(ginkgoSuiteTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	names, err := s.DepsToSetup[1:].LocalNames(s.QualifiedNames)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	var parents []string
+	var imports = []string{ginkgoImports([]Body{s.runAndAssert(), s.Cleanup}, []string{s.Shell}, []*Env{s.Env})}
+	for _, dep := range s.DepsToSetup[1:] {
+		parents = append(parents, localName(names, dep))
+		imports = append(imports, dep.importString(names))
+	}
+
+	var result = new(strings.Builder)
+	err = tmpl.Execute(result, struct {
+		Name           string
+		Imports        string
+		Parents        []string
+		Dir            string
+		NewShell       string
+		EnvArgs        string
+		CommandTimeout string
+		Cleanup        string
+		Run            string
+	}{
+		Name:           s.Name(),
+		Imports:        strings.Join(imports, "\n"),
+		Parents:        parents,
+		Dir:            s.runnerDir(),
+		NewShell:       ginkgoShell(s.Shell),
+		EnvArgs:        runnerEnvArgs(s.Env, nil, s.Dirs),
+		CommandTimeout: durationString(s.CommandTimeout),
+		Cleanup:        s.Cleanup.ginkgoString(),
+		Run:            s.runAndAssert().ginkgoString(),
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	return spaceRegex.ReplaceAllString(strings.TrimSpace(result.String()), "\n") + "\n", nil
+}
+
+// GinkgoSpecsSource returns a test file that runs an It spec for each test of the suite and for each combination of its matrix.
+// Each spec sets up the suite and its dependencies before it runs and cleans them up when it finishes
+func (s *Suite) GinkgoSpecsSource() (string, error) {
+	if err := s.checkNoEnvFile("ginkgo specs"); err != nil {
+		return "", err
+	}
+	if err := s.checkNotGlobal("ginkgo specs"); err != nil {
+		return "", err
+	}
+	if err := s.checkNoSection("ginkgo specs"); err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("ginkgospecs").Parse(ginkgoSpecsTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	type specData struct {
+		Name     string
+		Dir      string
+		NewShell string
+		EnvArgs  string
+		Cleanup  string
+		Run      string
+	}
+	var specs []*specData
+	var bodies []Body
+	var shells []string
+	var envs []*Env
+	var usesRunner bool
+	for _, test := range s.Tests {
+		if test.Name == "" {
+			continue
+		}
+		for _, c := range test.cases() {
+			name := test.Name
+			if c.Name != "" {
+				name += "/" + c.Name
+			}
+			specs = append(specs, &specData{
+				Name:     name,
+				Dir:      test.runnerDir(),
+				NewShell: ginkgoShell(test.Shell),
+				EnvArgs:  runnerEnvArgs(test.Env, nil, test.Dirs),
+				Cleanup:  c.Cleanup.ginkgoString(),
+				Run:      c.runAndAssert().ginkgoString(),
+			})
+			bodies = append(bodies, c.runAndAssert(), c.Cleanup)
+			usesRunner = usesRunner || len(c.runAndAssert()) > 0 || len(c.Cleanup) > 0
+		}
+		shells = append(shells, test.Shell)
+		envs = append(envs, test.Env)
+	}
+	if len(specs) == 0 {
+		// the suite is set up even if it has no tests
+		specs = append(specs, &specData{Name: "Setup"})
+	}
+
+	imports := ginkgoImports(bodies, shells, envs)
+	if usesRunner {
+		imports += "\n\"github.com/networkservicemesh/gotestmd/pkg/bash\""
+	}
+
+	var result = new(strings.Builder)
+	err = tmpl.Execute(result, struct {
+		Name    string
+		Imports string
+		Specs   []*specData
+		Serial  bool
+	}{
+		Name:    s.Name(),
+		Imports: imports,
+		Specs:   specs,
+		Serial:  s.Serial,
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	return spaceRegex.ReplaceAllString(strings.TrimSpace(result.String()), "\n") + "\n", nil
+}
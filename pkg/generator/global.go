@@ -0,0 +1,100 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const globalTemplate = `// Code generated by gotestmd DO NOT EDIT.
+package {{ .Name }}
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
+	{{ .Imports }}
+)
+
+// Main sets up the global suite before the tests and cleans it up after them. Returns the exit code for os.Exit.
+// Call it from TestMain of the packages that run the suites
+func Main(m *testing.M) int {
+	flag.Parse()
+	code := 1
+	if !scope("{{ .Dir }}", func() {
+		{{ .Setup }}
+		code = m.Run()
+	}) {
+		return 1
+	}
+	return code
+}
+
+// timeout is how long a failing command of the global suite is retried
+var timeout = flag.Duration("gotestmd.global.t", time.Minute, "how long a failing command of the global suite is retried")
+` + mainHelpersTemplate
+
+// GlobalSource returns the package of the global suite. Instead of a suite, the package has Main function that sets up
+// the global suite once for all the tests of a go test binary
+func (s *Suite) GlobalSource() (string, error) {
+	if err := s.checkNoEnvFile("global suites"); err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("global").Parse(globalTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	imports := mainImports([]Body{s.runAndAssert(), s.Cleanup}, map[string]bool{s.Shell: true})
+
+	var result = new(strings.Builder)
+	err = tmpl.Execute(result, struct {
+		Name           string
+		Dir            string
+		Imports        string
+		Setup          string
+		CommandTimeout string
+	}{
+		Name:           s.Name(),
+		Dir:            s.Dir,
+		Imports:        imports,
+		Setup:          mainStep(s.Shell, s.runnerDir(), runnerEnvArgs(s.Env, nil, s.Dirs), s.runAndAssert(), s.Cleanup),
+		CommandTimeout: durationString(s.CommandTimeout),
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	return spaceRegex.ReplaceAllString(strings.TrimSpace(result.String()), "\n") + "\n", nil
+}
+
+// checkNotGlobal returns an error if the suite is global, the global suite is not supported by the target
+func (s *Suite) checkNotGlobal(target string) error {
+	if s.IsGlobal {
+		return &Error{Kind: "suite", Dir: s.Dir, Err: errors.Errorf("global suites are not supported by %v", target)}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// List returns the inventory of the suites, one tab separated record per line in the order of generation:
+//
+//	suite	<dir>	<package>.<type>
+//	serial	<dir>
+//	test	<dir>	Test<name>	<dir of the test>
+//	requires	<dir>	<dir of the required suite>
+//	includes	<dir>	<dir of the included suite>
+//
+// The second field is always the dir of the suite, so the records of a suite can be found with grep
+func List(suites []*Suite) string {
+	var sb strings.Builder
+	for _, s := range suites {
+		_, _ = fmt.Fprintf(&sb, "suite\t%v\t%v.%v\n", s.Dir, s.packageName(), s.TypeName())
+		if s.Serial {
+			_, _ = fmt.Fprintf(&sb, "serial\t%v\n", s.Dir)
+		}
+		for _, t := range s.Tests {
+			if t.Name == "" {
+				continue
+			}
+			_, _ = fmt.Fprintf(&sb, "test\t%v\tTest%v\t%v\n", s.Dir, t.Name, t.Dir)
+		}
+		for _, parent := range s.Parents {
+			// required suites that are not generated are reported by the summary
+			if parent != nil {
+				_, _ = fmt.Fprintf(&sb, "requires\t%v\t%v\n", s.Dir, parent.Dir)
+			}
+		}
+		for _, child := range s.Children {
+			_, _ = fmt.Fprintf(&sb, "includes\t%v\t%v\n", s.Dir, child.Dir)
+		}
+	}
+	return sb.String()
+}
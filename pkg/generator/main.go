@@ -0,0 +1,439 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+)
+
+const mainTemplate = mainProgramTemplate + mainHelpersTemplate
+
+const mainProgramTemplate = `// Code generated by gotestmd DO NOT EDIT.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
+	{{ .Imports }}
+)
+
+func main() {
+	flag.Parse()
+	ok := scope("{{ .Dir }}", func() {
+		setup()
+		failed := false
+		{{ range .Tests }}
+		failed = !scope("{{ . }}", test{{ . }}) || failed
+		{{ end }}
+		if failed {
+			panic(failure{fmt.Errorf("tests failed")})
+		}
+	})
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// setup sets up the required suites and the suite
+func setup() {
+	{{ range .Setup }}
+	{
+		{{ . }}
+	}
+	{{ end }}
+}
+{{ range $name, $body := .TestBodies }}
+func test{{ $name }}() {
+	{{ range $body }}
+	{
+		{{ . }}
+	}
+	{{ end }}
+}
+{{ end }}
+// timeout is how long a failing command is retried
+var timeout = flag.Duration("timeout", time.Minute, "how long a failing command is retried")
+`
+
+// mainHelpersTemplate has the helpers of the generated programs, the program defines timeout of the retries
+const mainHelpersTemplate = `
+// commandTimeout is the timeout for a single run of a command. Zero means no timeout
+const commandTimeout = {{ .CommandTimeout }}
+
+// failure is a panic value of the failed commands
+type failure struct {
+	error
+}
+
+// cleanups are called in reverse order when the current scope finishes
+var cleanups []func()
+
+// deferCleanup registers f to be called when the current scope finishes
+func deferCleanup(f func()) {
+	cleanups = append(cleanups, f)
+}
+
+// scope runs f and then the cleanups registered by it in reverse order. Returns false if f or a cleanup fails
+func scope(name string, f func()) bool {
+	outer := cleanups
+	cleanups = nil
+	ok := try(name, f)
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		ok = try(name+" cleanup", cleanups[i]) && ok
+	}
+	cleanups = outer
+	return ok
+}
+
+// try runs f and prints its failure
+func try(name string, f func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, isFailure := r.(failure)
+			if !isFailure {
+				panic(r)
+			}
+			fmt.Fprintf(os.Stderr, "%v failed: %v\n", name, err)
+			ok = false
+		}
+	}()
+	f()
+	return true
+}
+
+// newRunner creates a runner in the dir. Relative dir is resolved against the root of the go module.
+// The runner is closed when the current scope finishes
+func newRunner(newShell func(...bash.Option) (*bash.Bash, error), dir string, env ...string) *bash.Bash {
+	options := []bash.Option{bash.WithDir(runner.Resolve(dir))}
+	if env != nil {
+		options = append(options, bash.WithEnv(env))
+	}
+	r, err := newShell(options...)
+	if err != nil {
+		panic(failure{err})
+	}
+	deferCleanup(r.Close)
+	for _, assignment := range captured {
+		run(r, assignment)
+	}
+	return r
+}
+
+// captured are the assignments of the variables captured from the output of the commands, they are run by the new runners
+var captured []string
+
+// capture assigns the output of a command to the shell variable in the runner and in the runners created later
+func capture(r *bash.Bash, name, out string) {
+	assignment := name + "=" + bash.Quote(out)
+	captured = append(captured, assignment)
+	run(r, assignment)
+}
+
+// run runs the command, prints it with its output and returns stdout. The command is retried until it succeeds
+// or the timeout passes. Fails the current scope if the command doesn't succeed
+func run(r *bash.Bash, cmd string) string {
+	deadline := time.Now().Add(*timeout)
+	for {
+		fmt.Printf("$ %v\n", cmd)
+		stdout, stderr, exitCode, err := runOnce(r, cmd)
+		if stdout != "" {
+			fmt.Println(stdout)
+		}
+		if stderr != "" {
+			fmt.Fprintln(os.Stderr, stderr)
+		}
+		if err != nil {
+			panic(failure{fmt.Errorf("can't run command %q: %v", cmd, err)})
+		}
+		if exitCode == 0 {
+			return stdout
+		}
+		if time.Now().After(deadline) {
+			panic(failure{fmt.Errorf("command %q didn't succeed until timeout, last exit code: %v", cmd, exitCode)})
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+// runFail runs the command and prints it with its output like run, but the command is retried until it fails with the exit code,
+// or with any non-zero exit code if the exit code is zero. Fails the current scope if the command doesn't fail as expected
+// or succeeds, a success is not retried
+func runFail(r *bash.Bash, cmd string, exitCode int) {
+	deadline := time.Now().Add(*timeout)
+	for {
+		fmt.Printf("$ %v\n", cmd)
+		stdout, stderr, code, err := runOnce(r, cmd)
+		if stdout != "" {
+			fmt.Println(stdout)
+		}
+		if stderr != "" {
+			fmt.Fprintln(os.Stderr, stderr)
+		}
+		if err != nil {
+			panic(failure{fmt.Errorf("can't run command %q: %v", cmd, err)})
+		}
+		if exitCode > 0 && code == exitCode || exitCode == 0 && code != 0 {
+			return
+		}
+		if code == 0 {
+			panic(failure{fmt.Errorf("command %q succeeded, but it's expected to fail", cmd)})
+		}
+		if time.Now().After(deadline) {
+			panic(failure{fmt.Errorf("command %q didn't fail as expected until timeout, last exit code: %v", cmd, code)})
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+// tryRun runs the command once, prints it with its output and returns true if it succeeds. The failure is only printed,
+// it doesn't fail the current scope
+func tryRun(r *bash.Bash, cmd string) bool {
+	fmt.Printf("$ %v\n", cmd)
+	stdout, stderr, exitCode, err := runOnce(r, cmd)
+	if stdout != "" {
+		fmt.Println(stdout)
+	}
+	if stderr != "" {
+		fmt.Fprintln(os.Stderr, stderr)
+	}
+	if err != nil || exitCode != 0 {
+		fmt.Fprintf(os.Stderr, "allowed to fail: %q, exit code: %v, error: %v\n", cmd, exitCode, err)
+		return false
+	}
+	return true
+}
+
+// runOnce runs the command once with the command timeout
+func runOnce(r *bash.Bash, cmd string) (stdout, stderr string, exitCode int, err error) {
+	ctx := context.Background()
+	if commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+	}
+	return r.RunContext(ctx, cmd)
+}
+
+// stdin returns a command that runs cmd with the stdin as its standard input
+func stdin(r *bash.Bash, cmd, input string) string {
+	result, err := r.StdinCommand(cmd, input)
+	if err != nil {
+		panic(failure{err})
+	}
+	return result
+}
+
+// expectOutput fails the current scope if the normalized output is not the expected one
+func expectOutput(out, expected, cmd string) {
+	if out != expected {
+		panic(failure{fmt.Errorf("unexpected output of %q, expected: %q", cmd, expected)})
+	}
+}
+
+// expectOutputRegex fails the current scope if the output doesn't match the pattern
+func expectOutputRegex(out, pattern, cmd string) {
+	if !regexp.MustCompile(pattern).MatchString(out) {
+		panic(failure{fmt.Errorf("output of %q doesn't match %q", cmd, pattern)})
+	}
+}
+`
+
+// mainString returns the body as a part of a standalone program
+func (b Body) mainString() string {
+	var sb strings.Builder
+	for _, block := range b {
+		var code strings.Builder
+		cmd := goCommand(block)
+		run := "run(r, " + goStdinCommand(block, cmd, "stdin(r, %v, %q)") + ")"
+		output, mode, ok := expectedOutput(block)
+		name, captures := capture(block)
+		switch {
+		case allowFail(block):
+			code.WriteString("tryRun(r, " + goStdinCommand(block, cmd, "stdin(r, %v, %q)") + ")\n")
+		case isExpectedFailure(block):
+			exitCode, _ := expectedFailure(block)
+			fmt.Fprintf(&code, "runFail(r, %v, %v)\n", goStdinCommand(block, cmd, "stdin(r, %v, %q)"), exitCode)
+		case captures:
+			code.WriteString("{\nout := " + run + "\n")
+			if ok {
+				code.WriteString(mainExpectOutput("out", cmd, output, mode))
+			}
+			fmt.Fprintf(&code, "capture(r, %q, out)\n}\n", name)
+		case !ok:
+			code.WriteString(run + "\n")
+		default:
+			code.WriteString(mainExpectOutput(run, cmd, output, mode))
+		}
+		sb.WriteString(goCondition(block, code.String()))
+	}
+	return sb.String()
+}
+
+// mainExpectOutput returns the check of the output of the expression
+func mainExpectOutput(expr, cmd, output, mode string) string {
+	if mode == parser.OutputRegex {
+		return fmt.Sprintf("expectOutputRegex(%v, %q, %v)\n", expr, output, cmd)
+	}
+	return fmt.Sprintf("expectOutput(%v, %q, %v)\n", goNormalizeOutput(mode, expr), output, cmd)
+}
+
+// mainImports returns imports of the generated program used by the bodies run with the shells
+func mainImports(bodies []Body, shells map[string]bool) string {
+	var imports []string
+	if shells[parser.ShellPowerShell] {
+		imports = append(imports, `"github.com/networkservicemesh/gotestmd/pkg/powershell"`)
+	}
+	for _, b := range bodies {
+		modes := b.outputModes()
+		if modes[parser.OutputExact] || modes[parser.OutputTrimmed] || modes[parser.OutputNormalized] {
+			imports = append(imports, `"strings"`)
+			break
+		}
+	}
+	return strings.Join(imports, "\n")
+}
+
+// mainStep returns a block of a standalone program that creates a runner, registers the cleanup and runs the commands
+func mainStep(shell, dir, envArgs string, run, cleanup Body) string {
+	if len(run)+len(cleanup) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "r := newRunner(%v, %q%v)\n", ginkgoShell(shell), dir, envArgs)
+	if len(cleanup) > 0 {
+		fmt.Fprintf(&sb, "deferCleanup(func() {\n%v})\n", cleanup.mainString())
+	}
+	sb.WriteString(run.mainString())
+	return sb.String()
+}
+
+// requiredSuites returns the suites required by the suite recursively in the order they should be set up. Each suite is listed once
+func (s *Suite) requiredSuites(seen map[*Suite]bool) []*Suite {
+	var result []*Suite
+	for _, p := range s.Parents {
+		if p == nil || seen[p] {
+			continue
+		}
+		result = append(result, p.requiredSuites(seen)...)
+		seen[p] = true
+		result = append(result, p)
+	}
+	return result
+}
+
+// MainLocation returns the location of the standalone program of the suite
+func (s *Suite) MainLocation() string {
+	if s.Section != "" {
+		return filepath.Join(filepath.Dir(s.Location), "main", normalizeName(s.Section), "main.gen.go")
+	}
+	return filepath.Join(filepath.Dir(s.Location), "main", "main.gen.go")
+}
+
+// MainSource returns a standalone program that sets up the required suites and the suite, runs all the tests and cleans up.
+// Each suite and test has own runner like in generated golang tests, the cleanup of a test is called when the test finishes.
+// The program exits with non-zero code if any step fails
+func (s *Suite) MainSource() (string, error) {
+	suites := append(s.requiredSuites(map[*Suite]bool{s: true}), s)
+	if s.Global != nil {
+		suites = append([]*Suite{s.Global}, suites...)
+	}
+	for _, suite := range suites {
+		if err := suite.checkNoEnvFile("standalone programs"); err != nil {
+			return "", err
+		}
+	}
+	tmpl, err := template.New("main").Parse(mainTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	var setup []string
+	var bodies []Body
+	shells := map[string]bool{}
+	for _, suite := range suites {
+		if step := mainStep(suite.Shell, suite.runnerDir(), runnerEnvArgs(suite.Env, nil, suite.Dirs), suite.runAndAssert(), suite.Cleanup); step != "" {
+			setup = append(setup, step)
+		}
+		bodies = append(bodies, suite.runAndAssert(), suite.Cleanup)
+		shells[suite.Shell] = true
+	}
+
+	var tests []string
+	testBodies := map[string][]string{}
+	for _, test := range s.Tests {
+		if test.Name == "" {
+			continue
+		}
+		tests = append(tests, test.Name)
+		testBodies[test.Name] = []string{}
+		for _, c := range test.cases() {
+			if step := mainStep(test.Shell, test.runnerDir(), runnerEnvArgs(test.Env, nil, test.Dirs), c.runAndAssert(), c.Cleanup); step != "" {
+				testBodies[test.Name] = append(testBodies[test.Name], step)
+			}
+			bodies = append(bodies, c.runAndAssert(), c.Cleanup)
+		}
+		shells[test.Shell] = true
+	}
+
+	var result = new(strings.Builder)
+	err = tmpl.Execute(result, struct {
+		Dir            string
+		Imports        string
+		Setup          []string
+		Tests          []string
+		TestBodies     map[string][]string
+		CommandTimeout string
+	}{
+		Dir:            s.Dir,
+		Imports:        mainImports(bodies, shells),
+		Setup:          setup,
+		Tests:          tests,
+		TestBodies:     testBodies,
+		CommandTimeout: durationString(s.CommandTimeout),
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	return spaceRegex.ReplaceAllString(strings.TrimSpace(result.String()), "\n") + "\n", nil
+}
+
+// checkNoEnvFile returns an error if the suite or its tests use env files, that are not supported by the target
+func (s *Suite) checkNoEnvFile(target string) error {
+	if s.EnvFile != nil {
+		return &Error{Kind: "suite", Dir: s.Dir, Err: errors.Errorf("env files are not supported by %v", target)}
+	}
+	for _, test := range s.Tests {
+		if test.EnvFile != nil {
+			return &Error{Kind: "test", Dir: test.Dir, Err: errors.Errorf("env files are not supported by %v", target)}
+		}
+	}
+	return nil
+}
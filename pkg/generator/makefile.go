@@ -0,0 +1,83 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Makefile returns a Makefile with a target for each suite. A target runs the bash script of the suite if bash is set,
+// or the suite with go test otherwise. Suites required by the suite are prerequisites of its target.
+// Paths of the recipes are relative to outputDir, where the Makefile is located
+func Makefile(outputDir string, suites []*Suite, bash bool) string {
+	targets := map[*Suite]string{}
+	for _, s := range suites {
+		targets[s] = makeTarget(outputDir, s)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Code generated by gotestmd DO NOT EDIT.\n\n")
+	var names []string
+	for _, s := range suites {
+		names = append(names, targets[s])
+	}
+	fmt.Fprintf(&sb, ".PHONY: all %v\n\nall: %v\n", strings.Join(names, " "), strings.Join(names, " "))
+
+	for _, s := range suites {
+		var prerequisites []string
+		for _, p := range s.Parents {
+			if target, ok := targets[p]; ok {
+				prerequisites = append(prerequisites, target)
+			}
+		}
+		dir := "./" + relDir(outputDir, s)
+		recipe := fmt.Sprintf("go test $(GO_TEST_FLAGS) %v -run '^%v$$'", dir, s.testFuncName())
+		if bash {
+			recipe = fmt.Sprintf("bash %v/%v run_all", dir, filepath.Base(s.Location))
+		}
+		fmt.Fprintf(&sb, "\n%v:", targets[s])
+		for _, p := range prerequisites {
+			sb.WriteString(" " + p)
+		}
+		fmt.Fprintf(&sb, "\n\t%v\n", recipe)
+	}
+	return sb.String()
+}
+
+// makeTarget returns the name of the target of the suite: the dir of the suite relative to outputDir,
+// or the name of the suite if it's located in outputDir
+func makeTarget(outputDir string, s *Suite) string {
+	target := s.Name()
+	if rel := relDir(outputDir, s); rel != "." {
+		target = rel
+	}
+	if s.Section != "" {
+		target += "/" + normalizeName(s.Section)
+	}
+	return target
+}
+
+// relDir returns the dir of the suite relative to outputDir
+func relDir(outputDir string, s *Suite) string {
+	rel, err := filepath.Rel(outputDir, filepath.Dir(s.Location))
+	if err != nil {
+		return filepath.ToSlash(filepath.Dir(s.Location))
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestFile is the name of the manifest in the output dir
+const ManifestFile = ".gotestmd-manifest.json"
+
+// Manifest records the inputs of the generated suites, so incremental generation can skip the suites that didn't change
+type Manifest struct {
+	// Version is the version of gotestmd that generated the suites
+	Version string `json:"version"`
+	// Options is a hash of the flags and args of the generation
+	Options string `json:"options"`
+	// Suites are hashes of the inputs of the suites by their locations
+	Suites map[string]string `json:"suites"`
+}
+
+// LoadManifest reads the manifest from the file
+func LoadManifest(path string) (*Manifest, error) {
+	source, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var result Manifest
+	if err := json.Unmarshal(source, &result); err != nil {
+		return nil, errors.Wrapf(err, "cannot parse manifest %v", path)
+	}
+	return &result, nil
+}
+
+// Save writes the manifest to the file
+func (m *Manifest) Save(path string) error {
+	source, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "cannot encode manifest")
+	}
+	if err := os.WriteFile(path, append(source, '\n'), 0o600); err != nil {
+		return errors.Errorf("cannot save manifest %v: %v", path, err.Error())
+	}
+	return nil
+}
+
+// Changed returns true if the suite should be regenerated: its inputs have another hash or the file of the suite is missing
+func (m *Manifest) Changed(s *Suite, hash string) bool {
+	if m.Suites[s.Location] != hash {
+		return true
+	}
+	_, err := os.Stat(s.Location)
+	return err != nil
+}
+
+// InputHash returns a hash of the markdown files that the generated suite depends on: the files of the suite, its tests,
+// the required and included suites and the global suite
+func (s *Suite) InputHash() (string, error) {
+	dirs := map[string]bool{}
+	s.collectInputs(dirs, map[*Suite]bool{})
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, dir := range sorted {
+		source, err := os.ReadFile(filepath.Join(dir, "README.md"))
+		if err != nil {
+			return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+		}
+		sum := sha256.Sum256(source)
+		_, _ = h.Write([]byte(dir + "\x00" + hex.EncodeToString(sum[:]) + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// collectInputs adds the dirs of the examples the suite depends on
+func (s *Suite) collectInputs(dirs map[string]bool, seen map[*Suite]bool) {
+	if s == nil || seen[s] {
+		return
+	}
+	seen[s] = true
+	dirs[s.Dir] = true
+	for _, test := range s.Tests {
+		if test.Dir != "" {
+			dirs[test.Dir] = true
+		}
+	}
+	for _, child := range s.Children {
+		dirs[child.Dir] = true
+	}
+	for _, p := range s.Parents {
+		p.collectInputs(dirs, seen)
+	}
+	s.Global.collectInputs(dirs, seen)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"sort"
+	"strings"
+)
+
+// Matrix represents values of the variables to run a test with
+type Matrix map[string][]string
+
+// Combination is a set of values of the matrix variables
+type Combination [][2]string
+
+// Combinations returns all combinations of the matrix values. Variables are sorted by name
+func (m Matrix) Combinations() []Combination {
+	if len(m) == 0 {
+		return nil
+	}
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var result = []Combination{nil}
+	for _, k := range keys {
+		var next []Combination
+		for _, c := range result {
+			for _, v := range m[k] {
+				combination := append(append(Combination{}, c...), [2]string{k, v})
+				next = append(next, combination)
+			}
+		}
+		result = next
+	}
+
+	return result
+}
+
+// Name returns the name of the combination, e.g. driver=kernel,ipam=static
+func (c Combination) Name() string {
+	var pieces []string
+	for _, kv := range c {
+		pieces = append(pieces, kv[0]+"="+kv[1])
+	}
+	return strings.Join(pieces, ",")
+}
+
+// Apply substitutes {{matrix:name}} placeholders with the values of the combination
+func (c Combination) Apply(b Body) Body {
+	var result Body
+	for _, block := range b {
+		for _, kv := range c {
+			block = strings.ReplaceAll(block, "{{matrix:"+kv[0]+"}}", kv[1])
+		}
+		result = append(result, block)
+	}
+	return result
+}
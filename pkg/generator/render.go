@@ -0,0 +1,122 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+// RenderOption is an option of the golang files rendered by Render and Suite.Files
+type RenderOption func(o *renderOptions)
+
+type renderOptions struct {
+	format     string
+	withSuite  bool
+	standalone bool
+	main       bool
+}
+
+// WithFormat sets the format of the rendered tests: FormatTestify or FormatGinkgo. FormatTestify is the default
+func WithFormat(format string) RenderOption {
+	return func(o *renderOptions) {
+		o.format = format
+	}
+}
+
+// WithSuiteTest adds the test file with TestGeneratedSuite function that runs the whole suite, e.g. for Makefile targets
+func WithSuiteTest() RenderOption {
+	return func(o *renderOptions) {
+		o.withSuite = true
+	}
+}
+
+// WithStandaloneTests adds the test file with a top-level test function for each test of the suite
+func WithStandaloneTests() RenderOption {
+	return func(o *renderOptions) {
+		o.standalone = true
+	}
+}
+
+// WithMain adds the standalone program of the suite
+func WithMain() RenderOption {
+	return func(o *renderOptions) {
+		o.main = true
+	}
+}
+
+// Files returns the golang files of the suite by their locations: the suite, its test file and its standalone program,
+// depending on the options. Nothing is written
+func (s *Suite) Files(options ...RenderOption) (map[string][]byte, error) {
+	o := renderOptions{format: FormatTestify}
+	for _, opt := range options {
+		opt(&o)
+	}
+	result := map[string][]byte{}
+	add := func(location string, render func() (string, error)) error {
+		source, err := render()
+		if err != nil {
+			return err
+		}
+		if source != "" {
+			result[location] = []byte(source)
+		}
+		return nil
+	}
+	var err error
+	switch {
+	case o.format == FormatGinkgo:
+		if err = add(s.Location, s.GinkgoSource); err == nil {
+			err = add(s.TestFileLocation(), s.GinkgoSpecsSource)
+		}
+	case o.withSuite || o.standalone:
+		if err = add(s.Location, s.Source); err == nil {
+			err = add(s.TestFileLocation(), func() (string, error) {
+				return s.TestFileSource(o.withSuite, o.standalone)
+			})
+		}
+	default:
+		err = add(s.Location, s.Source)
+	}
+	if err == nil && o.main {
+		err = add(s.MainLocation(), s.MainSource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Render returns the golang files of the suites by their locations, so the suites built by Generator.Generate or by hand
+// can be generated without writing files. The suites generated into a single file are rendered to that file only,
+// the options are ignored then. Returns the first error of the suites
+func Render(suites []*Suite, options ...RenderOption) (map[string][]byte, error) {
+	result := map[string][]byte{}
+	if len(suites) > 0 && suites[0].Siblings != nil {
+		source, err := SingleFileSource(suites)
+		if err != nil {
+			return nil, err
+		}
+		result[suites[0].Location] = []byte(source)
+		return result, nil
+	}
+	for _, s := range suites {
+		files, err := s.Files(options...)
+		if err != nil {
+			return nil, err
+		}
+		for location, source := range files {
+			result[location] = source
+		}
+	}
+	return result, nil
+}
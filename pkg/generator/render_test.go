@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkservicemesh/gotestmd/pkg/generator"
+)
+
+func helloSuite() *generator.Suite {
+	base := generator.Dependencies{"github.com/networkservicemesh/gotestmd/pkg/suites/shell"}
+	return &generator.Suite{
+		Dir:         "examples/HelloWorld",
+		Location:    filepath.Join("out", "hello", "suite.gen.go"),
+		Dependency:  "example.com/out/hello",
+		Deps:        base,
+		DepsToSetup: base,
+		Shell:       "bash",
+		Run:         generator.Body{"echo hello"},
+		Tests: []*generator.Test{
+			{Dir: "examples/HelloWorld", Name: "World", Run: generator.Body{"echo world"}, Shell: "bash"},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	suite := helloSuite()
+	files, err := generator.Render([]*generator.Suite{suite})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Contains(t, string(files[suite.Location]), "func (s *Suite) TestWorld() {")
+	require.Contains(t, string(files[suite.Location]), "r.Run(`echo world`)")
+
+	files, err = generator.Render([]*generator.Suite{suite}, generator.WithSuiteTest(), generator.WithMain())
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	require.Contains(t, string(files[suite.TestFileLocation()]), "func TestGeneratedSuite(")
+	require.Contains(t, string(files[suite.MainLocation()]), "package main")
+}
+
+func TestRenderGinkgo(t *testing.T) {
+	suite := helloSuite()
+	files, err := suite.Files(generator.WithFormat(generator.FormatGinkgo))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	require.Contains(t, string(files[suite.TestFileLocation()]), "ginkgo")
+}
+
+func TestRenderSerial(t *testing.T) {
+	suite := helloSuite()
+	suite.Serial = true
+	files, err := suite.Files()
+	require.NoError(t, err)
+	require.Contains(t, string(files[suite.Location]), "func (s *Suite) SetupSuite() {\ns.Serial()\n")
+
+	files, err = suite.Files(generator.WithFormat(generator.FormatGinkgo))
+	require.NoError(t, err)
+	require.Contains(t, string(files[suite.TestFileLocation()]), `Describe("hello", Serial, func() {`)
+
+	suite.Serial = false
+	files, err = suite.Files()
+	require.NoError(t, err)
+	require.NotContains(t, string(files[suite.Location]), "s.Serial()")
+}
+
+func TestBashWarnings(t *testing.T) {
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	t.Cleanup(func() { logrus.SetOutput(os.Stderr) })
+
+	suite := helloSuite()
+	suite.Run = generator.Body{"export GREETING=hello"}
+	suite.Tests[0].Run = generator.Body{"echo $GREETING"}
+	_, err := suite.BashSource(false)
+	require.NoError(t, err)
+	_, err = generator.Render([]*generator.Suite{suite})
+	require.NoError(t, err)
+	require.Empty(t, logs.String())
+	require.Equal(t, []string{"examples/HelloWorld: GREETING is exported by the setup and used by test World, it isn't visible " +
+		"if the targets of the bash script are run separately, use --persist-env to keep it"}, suite.BashWarnings())
+
+	suite.PersistEnv = true
+	require.Empty(t, suite.BashWarnings())
+}
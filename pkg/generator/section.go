@@ -0,0 +1,61 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// section returns a suite of the level 2 section of the example of the suite. The suite is generated in the package of the
+// example and sets up the same required suites, but has own commands and no tests or included suites
+func (s *Suite) section(name string, run, cleanup Body) *Suite {
+	result := *s
+	result.Section = name
+	result.Run = run
+	result.Cleanup = cleanup
+	result.Assert = nil
+	result.Tests = nil
+	result.Children = nil
+	result.Deps = s.DepsToSetup
+	dir, file := filepath.Split(s.Location)
+	result.Location = filepath.Join(dir, "suite_"+normalizeName(name)+strings.TrimPrefix(file, "suite"))
+	return &result
+}
+
+// sectionName returns the name of the section suite as a part of go identifiers
+func sectionName(section string) string {
+	return strings.ReplaceAll(testName(section), "_", "")
+}
+
+// testFuncName returns the name of the test function that runs the suite
+func (s *Suite) testFuncName() string {
+	if s.Section != "" {
+		return "TestGenerated" + s.TypeName()
+	}
+	return "TestGeneratedSuite"
+}
+
+// checkNoSection returns an error if the suite is generated from a section of the example, that is not supported by the target
+func (s *Suite) checkNoSection(target string) error {
+	if s.Section != "" {
+		return &Error{Kind: "suite", Dir: s.Dir, Err: errors.Errorf("suites of the sections are not supported by %v", target)}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// SingleFileName is the file in the output dir that all the golang suites are generated into with config.Config.SingleFile
+const SingleFileName = "suites.gen_test.go"
+
+// consolidate moves the suites into the package of the output dir. The suites are named by as many trailing elements
+// of the paths of their packages as needed to tell them apart, so the types of the suites don't collide in the package
+// and the suites embed each other as the sibling types instead of the imported ones
+func (g *Generator) consolidate(suites []*Suite) {
+	// the suites are referenced by the import paths of their packages, the paths are unique,
+	// so they can always be told apart
+	module := moduleName(g.conf.OutputDir)
+	pkgs := map[*Suite]Dependency{}
+	var deps Dependencies
+	seen := map[Dependency]bool{}
+	for _, s := range suites {
+		rel, err := filepath.Rel(filepath.Clean(g.conf.OutputDir), filepath.FromSlash(s.Pkg()))
+		if err != nil {
+			rel = s.Pkg()
+		}
+		pkgs[s] = normalizeDeps(module, []string{rel})[0]
+		if !seen[pkgs[s]] {
+			seen[pkgs[s]] = true
+			deps = append(deps, pkgs[s])
+		}
+	}
+	names, _ := deps.LocalNames(true)
+
+	dir, err := filepath.Abs(g.conf.OutputDir)
+	if err != nil {
+		dir = g.conf.OutputDir
+	}
+	location := filepath.Join(g.conf.OutputDir, SingleFileName)
+	for _, s := range suites {
+		s.Location = location
+		s.Package = normalizeName(filepath.Base(dir))
+		s.Siblings = names
+		s.siblingName = names[pkgs[s]]
+		for _, test := range s.Tests {
+			test.SuiteType = s.TypeName()
+		}
+	}
+}
+
+// siblingTypeName returns the name of the type of the suite named by name in the package shared by all the suites.
+// The name is always a part of the type name, e.g. ProducerConsumerSuite for producer_consumer and Suite pattern
+func siblingTypeName(pattern, name string) string {
+	if pattern == "" {
+		pattern = "Suite"
+	}
+	if !strings.Contains(pattern, "*") {
+		pattern = "*" + pattern
+	}
+	pieces := strings.Split(name, "_")
+	for i, piece := range pieces {
+		pieces[i] = cases.Title(language.Und, cases.NoLower).String(piece)
+	}
+	return strings.ReplaceAll(pattern, "*", strings.Join(pieces, ""))
+}
+
+// siblingFieldsString returns the declaration of the dependencies as fields for the suites generated into one package.
+// The base suite is imported, the other dependencies are the sibling suites
+func (d Dependencies) siblingFieldsString(suiteType string, names map[Dependency]string) string {
+	result := d[:1].FieldsString(suiteType, names)
+	for _, dep := range d[1:] {
+		result += fmt.Sprintf("\n%vSuite %v", localName(names, dep), siblingTypeName(suiteType, localName(names, dep)))
+	}
+	return result
+}
+
+// SingleFileSource returns the file with all the suites generated with config.Config.SingleFile, imports of the suites
+// are merged. Global suites are not supported
+func SingleFileSource(suites []*Suite) (string, error) {
+	var pkg string
+	var imports, bodies []string
+	seen := map[string]bool{}
+	for _, s := range suites {
+		if s.IsGlobal {
+			return "", &Error{Kind: "suite", Dir: s.Dir, Err: errors.New("global suites can't be generated into a single file")}
+		}
+		source, err := s.Source()
+		if err != nil {
+			return "", err
+		}
+		header, body, _ := strings.Cut(source, "\n)\n")
+		_, block, _ := strings.Cut(header, "import(\n")
+		for _, line := range strings.Split(block, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !seen[line] {
+				seen[line] = true
+				imports = append(imports, line)
+			}
+		}
+		bodies = append(bodies, body)
+		pkg = s.Package
+	}
+	return fmt.Sprintf("// Code generated by gotestmd DO NOT EDIT.\npackage %v\n\nimport(\n%v\n)\n\n%v\n",
+		pkg, strings.Join(imports, "\n"), strings.Join(bodies, "\n\n")), nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"encoding/json"
+	"path/filepath"
+)
+
+// SourcesFile is the name of the source map in the output dir
+const SourcesFile = "sources.gen.json"
+
+// SourceMap maps the generated suites and tests to the markdown files they are generated from
+type SourceMap struct {
+	Suites []*SuiteSource `json:"suites"`
+}
+
+// SuiteSource is a generated suite and the sources of its commands
+type SuiteSource struct {
+	// Package is the package of the suite
+	Package string `json:"package"`
+	// Type is the name of the suite type
+	Type string `json:"type"`
+	// Dir is the dir of the example
+	Dir string `json:"dir"`
+	// Location is the generated file of the suite
+	Location string           `json:"location"`
+	Run      []*CommandSource `json:"run,omitempty"`
+	Cleanup  []*CommandSource `json:"cleanup,omitempty"`
+	Assert   []*CommandSource `json:"assert,omitempty"`
+	Tests    []*TestSource    `json:"tests,omitempty"`
+}
+
+// TestSource is a test of the suite and the sources of its commands
+type TestSource struct {
+	// Name is the name of the test method. Commands of the matrix tests have the placeholders of the matrix values
+	Name    string           `json:"name"`
+	Dir     string           `json:"dir"`
+	Run     []*CommandSource `json:"run,omitempty"`
+	Cleanup []*CommandSource `json:"cleanup,omitempty"`
+	Assert  []*CommandSource `json:"assert,omitempty"`
+}
+
+// CommandSource is a command and the lines of its code block in the markdown file
+type CommandSource struct {
+	Command   string `json:"command"`
+	File      string `json:"file"`
+	FirstLine int    `json:"firstLine,omitempty"`
+	LastLine  int    `json:"lastLine,omitempty"`
+}
+
+// Sources returns the source map of the suites in json. The lines of the commands are known only if the suites are parsed
+// with parser.WithSourceLines
+func Sources(suites []*Suite) string {
+	result := SourceMap{Suites: []*SuiteSource{}}
+	for _, s := range suites {
+		suite := &SuiteSource{
+			Package:  s.packageName(),
+			Type:     s.TypeName(),
+			Dir:      s.Dir,
+			Location: s.Location,
+			Run:      s.Run.sources(s.Dir),
+			Cleanup:  s.Cleanup.sources(s.Dir),
+			Assert:   s.Assert.sources(s.Dir),
+		}
+		for _, t := range s.Tests {
+			if t.Name == "" {
+				continue
+			}
+			suite.Tests = append(suite.Tests, &TestSource{
+				Name:    "Test" + t.Name,
+				Dir:     t.Dir,
+				Run:     t.Run.sources(t.Dir),
+				Cleanup: t.Cleanup.sources(t.Dir),
+				Assert:  t.Assert.sources(t.Dir),
+			})
+		}
+		result.Suites = append(result.Suites, suite)
+	}
+	source, _ := json.MarshalIndent(&result, "", "  ")
+	return string(source) + "\n"
+}
+
+// sources returns the commands of the body and the lines of their code blocks in the markdown file of the dir
+func (b Body) sources(dir string) []*CommandSource {
+	var result []*CommandSource
+	for _, block := range b {
+		first, last, _ := sourceLines(block)
+		result = append(result, &CommandSource{
+			Command:   command(block),
+			File:      filepath.Join(dir, "README.md"),
+			FirstLine: first,
+			LastLine:  last,
+		})
+	}
+	return result
+}
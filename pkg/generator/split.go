@@ -0,0 +1,349 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// splittableAnnotations are the annotations that are copied to each command of a split block. Blocks with other annotations,
+// e.g. with the expected output or stdin, are checked as a whole and are not split
+var splittableAnnotations = map[string]bool{"lines": true, "if": true, "retry": true, "assert": true, "group": true}
+
+// splitCommands splits each block of the body into blocks with a single command, so a failure points to the command
+// instead of the whole block. See splitStatements for the rules
+func splitCommands(b Body) Body {
+	if len(b) == 0 {
+		return b
+	}
+	result := make(Body, 0, len(b))
+	for _, block := range b {
+		annotations, rest := splitAnnotations(block)
+		parsed, _ := cutAnnotations(block)
+		splittable := true
+		for name := range parsed {
+			splittable = splittable && splittableAnnotations[name]
+		}
+		if !splittable {
+			result = append(result, block)
+			continue
+		}
+		for _, cmd := range splitStatements(rest) {
+			result = append(result, annotations+cmd)
+		}
+	}
+	return result
+}
+
+// stripComments removes blank and comment lines from the commands of each block of the body. Lines of heredocs and multi-line
+// quoted strings are kept, as well as the line after a line continued with \. Blocks that have only comments are dropped,
+// blocks run by an interpreter are kept as is
+func stripComments(b Body) Body {
+	if len(b) == 0 {
+		return b
+	}
+	result := make(Body, 0, len(b))
+	for _, block := range b {
+		annotations, rest := splitAnnotations(block)
+		if parsed, _ := cutAnnotations(block); parsed["interpreter"] != "" {
+			result = append(result, block)
+			continue
+		}
+		var lines []string
+		var s statementScanner
+		for _, line := range strings.Split(rest, "\n") {
+			trimmed := strings.TrimSpace(line)
+			inside := s.quote != 0 || s.heredoc != ""
+			continued := len(lines) > 0 && strings.HasSuffix(lines[len(lines)-1], "\\")
+			if !inside && !continued && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+				continue
+			}
+			lines = append(lines, line)
+			s.scan(line)
+		}
+		if len(lines) > 0 {
+			result = append(result, annotations+strings.Join(lines, "\n"))
+		}
+	}
+	return result
+}
+
+// heredocRegex matches the beginning of a heredoc and captures its delimiter
+var heredocRegex = regexp.MustCompile(`<<-?\s*['"]?([\w.-]+)['"]?`)
+
+// compoundEnds are the keywords that end compound commands by the keywords that begin them
+var compoundEnds = map[string]string{"if": "fi", "for": "done", "while": "done", "until": "done", "select": "done", "case": "esac"}
+
+// splitStatements splits bash commands into statements by lines. A line continues the statement if:
+//   - the previous line ends with \, |, && or ||;
+//   - a quoted string, a heredoc, parentheses, braces or a compound command like if/fi, for/done or case/esac
+//     of the previous lines is not closed yet.
+//
+// Several commands on the same line, e.g. separated by ;, stay in one statement. Blank lines are dropped, comment lines
+// are attached to the following statement
+func splitStatements(cmd string) []string {
+	var result, current []string
+	var s statementScanner
+	for _, line := range strings.Split(cmd, "\n") {
+		if len(current) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		current = append(current, line)
+		if s.scan(line) {
+			result = append(result, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		if len(result) > 0 && !s.pending {
+			// only comments are left, they belong to the last statement
+			result[len(result)-1] += "\n" + strings.Join(current, "\n")
+		} else {
+			result = append(result, strings.Join(current, "\n"))
+		}
+	}
+	return result
+}
+
+// statementScanner keeps the state of the statement between the lines
+type statementScanner struct {
+	quote    byte
+	heredoc  string
+	heredocs []string
+	stack    []string
+	// pending means that the statement has commands, so a statement of only comments is not complete
+	pending bool
+	// continued means that the last line of the commands ends with \, | or &&
+	continued bool
+	// function means that the name of a function is defined, but its body is not begun yet, e.g. f() is followed by {
+	// on the next line
+	function bool
+}
+
+// complete returns true if nothing is left open by the scanned lines
+func (s *statementScanner) complete() bool {
+	return s.quote == 0 && s.heredoc == "" && len(s.heredocs) == 0 && len(s.stack) == 0 && !s.function
+}
+
+// scan scans the next line of the statement. Returns true if the line completes the statement
+func (s *statementScanner) scan(line string) bool {
+	if s.heredoc != "" {
+		if strings.TrimLeft(line, "\t") == s.heredoc {
+			s.heredoc = ""
+			s.nextHeredoc()
+		}
+		return s.done()
+	}
+	l := &lineScanner{statementScanner: s, line: line, commandStart: true}
+	for ; l.i < len(line); l.i++ {
+		if s.quote != 0 {
+			l.quoted()
+			continue
+		}
+		l.unquoted()
+	}
+	l.endWord()
+	continued := l.continued
+	if s.quote == 0 && !continued {
+		trimmed := strings.TrimSpace(stripComment(line))
+		continued = strings.HasSuffix(trimmed, "|") || strings.HasSuffix(trimmed, "&&")
+	}
+	// the operator at the end of the line continues the statement after the heredocs of the line
+	s.continued = continued
+	s.nextHeredoc()
+	return s.done()
+}
+
+// lineScanner keeps the state of the line scanned by the statementScanner
+type lineScanner struct {
+	*statementScanner
+	line string
+	// i is the position of the current character
+	i    int
+	word string
+	// commandStart means that the current word is the first word of a command, so it can be a keyword
+	commandStart bool
+	// continued means that the line ends with \
+	continued bool
+}
+
+// quoted scans the character of a quoted string
+func (l *lineScanner) quoted() {
+	c := l.line[l.i]
+	switch {
+	case l.quote == '$' && c == '\'' || l.quote != '$' && c == l.quote:
+		l.quote = 0
+	case c == '\\' && l.quote != '\'':
+		l.i++
+	}
+}
+
+// unquoted scans the character outside of quoted strings
+func (l *lineScanner) unquoted() {
+	if l.escapeOrQuote() {
+		return
+	}
+	c, rest := l.line[l.i], l.line[l.i:]
+	switch {
+	case c == '#' && l.word == "":
+		l.i = len(l.line)
+	case strings.HasPrefix(rest, "<<") && !strings.HasPrefix(rest, "<<<") && !l.arithmetic():
+		if m := heredocRegex.FindStringSubmatch(rest); m != nil {
+			l.heredocs = append(l.heredocs, m[1])
+			l.i += len(m[0]) - 1
+		}
+		l.pending = true
+	case c == ' ' || c == '\t':
+		l.endWord()
+	case c == ';' || c == '&' || c == '|':
+		l.endWord()
+		l.commandStart, l.pending = true, true
+	case c == '(':
+		l.openParen()
+	case c == ')':
+		l.endWord()
+		l.closeParen(l.line, &l.i)
+		l.commandStart = true
+	default:
+		l.word += string(c)
+		l.pending = true
+	}
+}
+
+// escapeOrQuote scans an escaped character or the beginning of a quoted string. Returns false for other characters
+func (l *lineScanner) escapeOrQuote() bool {
+	switch c := l.line[l.i]; {
+	case c == '\\':
+		l.continued = l.i == len(l.line)-1
+		l.word += "\\"
+		l.i++
+	case c == '\'' && strings.HasSuffix(l.word, "$"):
+		// ANSI-C quoted string, e.g. $'it\'s', its quotes can be escaped
+		l.quote = '$'
+		l.word += "x"
+	case c == '\'' || c == '"' || c == '`':
+		l.quote = c
+		l.word += "x"
+	default:
+		return false
+	}
+	return true
+}
+
+// openParen scans ( that begins a subshell, a command substitution, an arithmetic expression or () of a function definition
+func (l *lineScanner) openParen() {
+	rest := l.line[l.i:]
+	if strings.HasPrefix(rest, "()") && (l.function || l.commandStart && l.word != "" && !strings.ContainsAny(l.word, "=$")) {
+		// the name of a function is defined, its body follows
+		l.endWord()
+		l.function, l.commandStart = true, true
+		l.i++
+		return
+	}
+	arithmetic := strings.HasPrefix(rest, "((") && (l.commandStart && l.word == "" || strings.HasSuffix(l.word, "$"))
+	l.endWord()
+	l.function, l.commandStart = false, true
+	if arithmetic {
+		l.stack = append(l.stack, "((")
+		l.i++
+		return
+	}
+	l.stack = append(l.stack, "(")
+}
+
+// endWord updates the stack of the compound commands by the scanned word
+func (l *lineScanner) endWord() {
+	word := l.word
+	if word == "" {
+		return
+	}
+	// the body of a function begins like a command, also after the name of the function
+	if l.commandStart || l.function && word == "{" {
+		l.keyword(word)
+	}
+	l.commandStart = word == "then" || word == "do" || word == "else" || word == "elif" || word == "!" || word == "{" ||
+		compoundEnds[word] != "" && word != "case" && word != "for" && word != "select"
+	l.word = ""
+}
+
+// closeParen updates the stack by ) at the position i of the line. )) closes an arithmetic expression, patterns of case end
+// with ) that doesn't close anything
+func (s *statementScanner) closeParen(line string, i *int) {
+	if len(s.stack) == 0 {
+		return
+	}
+	switch top := s.stack[len(s.stack)-1]; {
+	case top == "(":
+		s.stack = s.stack[:len(s.stack)-1]
+	case top == "((" && strings.HasPrefix(line[*i:], "))"):
+		s.stack = s.stack[:len(s.stack)-1]
+		*i++
+	}
+}
+
+// arithmetic returns true if the scanner is inside an arithmetic expression, e.g. $(( 1 << 2 )), where << is not a heredoc
+func (s *statementScanner) arithmetic() bool {
+	for _, open := range s.stack {
+		if open == "((" {
+			return true
+		}
+	}
+	return false
+}
+
+// keyword updates the stack of the compound commands by the word at the beginning of a command
+func (s *statementScanner) keyword(word string) {
+	if word == "{" || compoundEnds[word] != "" {
+		s.function = false
+	}
+	switch {
+	case word == "function":
+		s.function = true
+	case word == "{":
+		s.stack = append(s.stack, "}")
+	case compoundEnds[word] != "":
+		s.stack = append(s.stack, compoundEnds[word])
+	case len(s.stack) > 0 && s.stack[len(s.stack)-1] == word:
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+}
+
+// nextHeredoc starts the next heredoc of the line, if any
+func (s *statementScanner) nextHeredoc() {
+	if s.heredoc == "" && len(s.heredocs) > 0 {
+		s.heredoc, s.heredocs = s.heredocs[0], s.heredocs[1:]
+	}
+}
+
+// done returns true and resets the scanner if the statement is complete
+func (s *statementScanner) done() bool {
+	if s.continued || !s.complete() || !s.pending {
+		return false
+	}
+	*s = statementScanner{}
+	return true
+}
+
+// stripComment returns the line without a trailing comment. Quotes are not taken into account, it's only used
+// to find the operators at the end of the line
+func stripComment(line string) string {
+	if i := strings.Index(line, " #"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
@@ -0,0 +1,1097 @@
+// Copyright (c) 2020-2023 Doc.ai and/or its affiliates.
+//
+// Copyright (c) 2022-2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+
+	"github.com/networkservicemesh/gotestmd/internal/parser"
+)
+
+const suiteTemplate = `// Code generated by gotestmd DO NOT EDIT.
+package {{ .Name }}
+
+import(
+	{{ .Imports }}
+)
+
+type {{ .TypeName }} struct {
+	{{ .Fields }}
+}
+
+func (s *{{ .TypeName }}) SetupSuite() {
+	{{ if .Serial }}
+	s.Serial()
+	{{ end }}
+	{{ .Setup }}
+	{{ if or .Run .Cleanup }}
+	r := s.{{ .RunnerFunc }}("{{.Dir}}"{{ .EnvArgs }})
+	{{ if .CommandTimeout }}
+	r.SetCommandTimeout({{ .CommandTimeout }})
+	{{ end }}
+	{{ else if .SharedSession }}
+	s.Session("{{.Dir}}"{{ .EnvArgs }})
+	{{ end }}
+	{{ .Cleanup }}
+	{{ .Run }}
+
+{{ if .TestIncludedSuites }}
+	s.RunIncludedSuites()
+}
+
+func (s *{{ .TypeName }}) RunIncludedSuites() {
+	{{ .TestIncludedSuites }}
+{{ end }}
+}
+`
+
+const includedSuiteTemplate = `
+	{{ range .Suites }}
+		s.Run("{{ .Title }}", func() {
+			suite.Run(s.T(), &s.{{ .Name }}Suite)
+		})
+	{{ end }}
+`
+
+// Body represents a body of the method. Each element is a code block with its annotations, that is run as a single command,
+// or a single command of a block split with config.Config.SplitCommands
+type Body []string
+
+// String returns the body as part of the method
+func (b Body) String() string {
+	return b.goString("", false, false)
+}
+
+// goString returns the body as part of the method. If requireNoError is set, each command is checked with
+// require.NoError and the command is used as the message of the assertion. If logCommands is set, each command is logged
+// with s.T().Log before it runs. Each code block is preceded by a comment with its location in the markdown file source, if it's not empty
+func (b Body) goString(source string, requireNoError, logCommands bool) string {
+	var sb strings.Builder
+
+	if len(b) == 0 {
+		return ""
+	}
+
+	previous := ""
+	for _, block := range b {
+		// the commands of a split block share the comment
+		if comment := goSourceComment(source, block); comment != previous {
+			sb.WriteString(comment)
+			previous = comment
+		}
+		code := goBlockString(block, requireNoError)
+		if logCommands {
+			code = "s.T().Log(" + goCommand(block) + ")\n" + code
+		}
+		sb.WriteString(goCondition(block, code))
+	}
+
+	return sb.String()
+}
+
+// goSourceComment returns a comment with the first line of the code block in the markdown file, e.g. // from: foo/README.md:12
+func goSourceComment(source, block string) string {
+	first, _, ok := sourceLines(block)
+	if !ok || source == "" {
+		return ""
+	}
+	return fmt.Sprintf("// from: %v:%v\n", source, first)
+}
+
+// goBlockString returns the code that runs the command of the block, see goString
+func goBlockString(block string, requireNoError bool) string {
+	cmd := goCommand(block)
+	run := goStdinCommand(block, cmd, "r.Stdin(%v, %q)")
+	if allowFail(block) {
+		return "r.TryRun(" + run + ")\n"
+	}
+	if exitCode, ok := expectedFailure(block); ok {
+		if requireNoError {
+			return fmt.Sprintf("require.NoError(s.T(), r.RunFailE(%v, %v), %v)\n", run, exitCode, cmd)
+		}
+		return fmt.Sprintf("r.RunFail(%v, %v)\n", run, exitCode)
+	}
+	if name, ok := capture(block); ok {
+		return goCapture(block, run, cmd, name, requireNoError)
+	}
+	if output, mode, ok := expectedOutput(block); ok {
+		return goOutputCheck(run, cmd, output, mode, requireNoError)
+	}
+	if requireNoError {
+		return "require.NoError(s.T(), r.RunE(" + run + "), " + cmd + ")\n"
+	}
+	return "r.Run(" + run + ")\n"
+}
+
+// goCommand returns the command of the block as a go string expression. Lines with characters that can't be written
+// to raw strings, e.g. backticks, are written to interpreted string literals
+func goCommand(block string) string {
+	var lines = strings.Split(command(block), "\n")
+	for i := range lines {
+		if _, ok := unsafeRune(lines[i]); ok {
+			lines[i] = strconv.Quote(lines[i])
+			continue
+		}
+		lines[i] = "`" + lines[i] + "`"
+	}
+	return strings.Join(lines, "+\"\\n\"+")
+}
+
+// goStdinCommand returns a go expression of the command. If the block has stdin, the command is formatted with it
+// by the format, e.g. r.Stdin(%v, %q)
+func goStdinCommand(block, cmd, format string) string {
+	if stdin, ok := stdinInput(block); ok {
+		return fmt.Sprintf(format, cmd, stdin)
+	}
+	return cmd
+}
+
+// goOutputCheck returns a block that runs the command and checks its output. The expected output is compared with
+// stdout without trailing newlines, a regex is matched against the whole stdout. The run expression runs the command,
+// cmd is shown in the messages
+func goOutputCheck(run, cmd, output, mode string, requireNoError bool) string {
+	return "{\n" + goOutput(run, cmd, requireNoError) + goOutputAssertion(cmd, output, mode) + "}\n"
+}
+
+// goCapture returns a block that runs the command, checks its output if it's expected and captures it to the variable
+// of the runners of the suite, so the later commands can use it
+func goCapture(block, run, cmd, name string, requireNoError bool) string {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	sb.WriteString(goOutput(run, cmd, requireNoError))
+	if output, mode, ok := expectedOutput(block); ok {
+		sb.WriteString(goOutputAssertion(cmd, output, mode))
+	}
+	fmt.Fprintf(&sb, "r.Capture(%q, out)\n}\n", name)
+	return sb.String()
+}
+
+// goOutput returns the statements that run the command and assign its stdout to out variable
+func goOutput(run, cmd string, requireNoError bool) string {
+	if requireNoError {
+		return "out, err := r.OutputE(" + run + ")\nrequire.NoError(s.T(), err, " + cmd + ")\n"
+	}
+	return "out := r.Output(" + run + ")\n"
+}
+
+// goOutputAssertion returns the statement that checks out variable, see goOutputCheck
+func goOutputAssertion(cmd, output, mode string) string {
+	if mode == parser.OutputRegex {
+		return fmt.Sprintf("if !regexp.MustCompile(%q).MatchString(out) {\n", output) +
+			fmt.Sprintf("s.T().Fatalf(\"output of the command doesn't match %%q:\\n%%v\\ncommand: %%v\", %q, out, %v)\n}\n", output, cmd)
+	}
+	return fmt.Sprintf("s.Require().Equal(%q, %v, %v)\n", output, goNormalizeOutput(mode, "out"), cmd)
+}
+
+// outputModes returns the modes of the checks of the expected output of the body
+func (b Body) outputModes() map[string]bool {
+	modes := map[string]bool{}
+	for _, block := range b {
+		if _, mode, ok := expectedOutput(block); ok {
+			modes[mode] = true
+		}
+	}
+	return modes
+}
+
+// bashOutputCheck returns bash commands that run the command, print its output and check it
+func bashOutputCheck(cmd, output, mode string) string {
+	check := `[ "$gotestmd_out" = "$gotestmd_expected" ]`
+	switch mode {
+	case parser.OutputRegex:
+		check = `[[ $gotestmd_out =~ $gotestmd_expected ]]`
+	case parser.OutputTrimmed, parser.OutputNormalized:
+		// the output is normalized by sed the same way as the expected output is normalized by gotestmd
+		script := `s/[[:blank:]]*$//`
+		if mode == parser.OutputNormalized {
+			script += `;s/[[:blank:]][[:blank:]]*/ /g`
+		}
+		check = fmt.Sprintf(`[ "$(printf '%%s\n' "$gotestmd_out" | sed -e '%v')" = "$gotestmd_expected" ]`, script)
+	}
+	return fmt.Sprintf("gotestmd_out=\"$(\n%v\n\t)\" && echo \"$gotestmd_out\" && gotestmd_expected=%v && "+
+		"{ %v || { echo \"unexpected output, expected: $gotestmd_expected\" >&2; false; }; }",
+		cmd, bashQuote(output), check)
+}
+
+// bashQuote returns the string in single quotes
+func bashQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
+
+// hasAnnotation returns true if a block of the body has the annotation
+func (b Body) hasAnnotation(name string) bool {
+	for _, block := range b {
+		annotations, _ := cutAnnotations(block)
+		if _, ok := annotations[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BashString returns the body as a bash script for the suite
+func (b Body) BashString(withExit, retry bool) string {
+	return b.bashString(withExit, retry, false)
+}
+
+// bashString returns the body as a bash script for the suite. If timing is set, the duration of each command is echoed
+// as "took Ns: <the first line of the command>"
+func (b Body) bashString(withExit, retry, timing bool) string {
+	var sb strings.Builder
+
+	if len(b) == 0 {
+		return "\t:\n"
+	}
+
+	for _, block := range b {
+		var code strings.Builder
+		annotations, _ := cutAnnotations(block)
+		cmd := command(block)
+		// the first line of the command is enough to tell the commands apart in the messages
+		title, _, _ := strings.Cut(strings.TrimSpace(cmd), "\n")
+		title = bashQuote(strings.TrimSpace(title))
+		if sensitive(block) {
+			title = bashQuote(sensitivePlaceholder)
+		}
+		if stdin, ok := stdinInput(block); ok {
+			// the commands of the scripts are not read from stdin, so the stdin of the command can be a heredoc
+			cmd = heredoc("{\n"+cmd+"\n}", strings.TrimSuffix(stdin, "\n"))
+		}
+		output, mode, checkOutput := expectedOutput(block)
+		if checkOutput {
+			cmd = bashOutputCheck(cmd, output, mode)
+		}
+		if name, ok := capture(block); ok && checkOutput {
+			cmd += " && " + name + "=\"$gotestmd_out\""
+		} else if ok {
+			// the captured output is printed like the output of the other commands
+			cmd = fmt.Sprintf("%[1]v=\"$(\n%[2]v\n\t)\" && echo \"$%[1]v\"", name, cmd)
+		}
+		exitCode, expectFail := expectedFailure(block)
+		if _, ok := annotations["retry"]; (ok || retry) && !expectFail {
+			cmd = "try_run '" + strings.ReplaceAll(cmd, "'", "'\\''") + "'"
+			if sensitive(block) {
+				cmd += " sensitive"
+			}
+		}
+		if _, ok := annotations["once"]; ok {
+			// the marker is created only if the command succeeds
+			marker := fmt.Sprintf("\"$%v/%v\"", stateDirVar, blockHash(command(block)))
+			cmd = fmt.Sprintf("[ -f %[1]v ] || { %[2]v\n\t} && mkdir -p \"$%[3]v\" && touch %[1]v", marker, cmd, stateDirVar)
+		}
+		if sensitive(block) {
+			// the tracing is disabled silently and restored after the command, so set -x doesn't print the secrets
+			code.WriteString("\t{ gotestmd_xtrace=\"${-//[^x]/}\"; set +x; } 2>/dev/null\n")
+		}
+		if timing {
+			code.WriteString("\techo \"+ \"" + title + "\n")
+			code.WriteString("\tgotestmd_start=$SECONDS\n")
+		}
+		code.WriteString("\t")
+		code.WriteString(cmd)
+		code.WriteString("\n")
+		status := "$?"
+		if timing || sensitive(block) {
+			// the status is saved before the echo, so the checks below get the status of the command
+			code.WriteString("\tgotestmd_status=$?\n")
+			status = "$gotestmd_status"
+		}
+		if timing {
+			code.WriteString("\techo \"took $((SECONDS - gotestmd_start))s: \"" + title + "\n")
+		}
+		if sensitive(block) {
+			code.WriteString("\t{ [ -z \"$gotestmd_xtrace\" ] || set -x; } 2>/dev/null\n")
+		}
+		fail := "exit 1"
+		if _, ok := annotations["assert"]; ok {
+			fail = "{ echo \"assertion failed: \"" + title + " >&2; exit 1; }"
+		}
+		switch {
+		case allowFail(block):
+			code.WriteString("\t[ " + status + " = 0 ] || echo \"allowed to fail: \"" + title + " >&2\n")
+		case withExit && expectFail && exitCode > 0:
+			fmt.Fprintf(&code, "\t[ %v = %v ] || %v\n", status, exitCode, fail)
+		case withExit && expectFail:
+			code.WriteString("\t[ " + status + " != 0 ] || " + fail + "\n")
+		case withExit:
+			code.WriteString("\t[ " + status + " = 0 ] || " + fail + "\n")
+		}
+		sb.WriteString(bashCondition(block, code.String()))
+	}
+
+	return sb.String()
+}
+
+// Suite represents a template for generating a testify suite.Suite
+type Suite struct {
+	Dir      string
+	Location string
+	Dependency
+	Cleanup Body
+	Run     Body
+	// Assert are the commands that verify the result of Run. Golang suites check them in Test method with require
+	Assert      Body
+	Tests       []*Test
+	Children    []*Suite
+	Parents     []*Suite
+	Deps        Dependencies
+	DepsToSetup Dependencies
+	// CommandTimeout is a timeout for a single run of a command. Zero means no timeout
+	CommandTimeout time.Duration
+	Dirs           Dirs
+	// Shell is the shell to run the commands with
+	Shell string
+	// RequireNoError makes the commands checked with require.NoError, so failed commands are shown in the assertions
+	RequireNoError bool
+	// SharedSession makes the suite and its tests run the commands in a single shell session
+	SharedSession bool
+	Env           *Env
+	// NoChdir leaves the runners in the current dir instead of the dir of the example
+	NoChdir bool
+	EnvFile *EnvFile
+	// Timing makes bash scripts echo each command and its duration
+	Timing bool
+	// LogCommands makes golang tests log each command before it runs
+	LogCommands bool
+	// RetryMaxAttempts limits the number of attempts of the retried commands in bash scripts. Zero means no limit
+	RetryMaxAttempts int
+	// RetryJitter is the maximum random delay added to the interval between the attempts of the retried commands in bash scripts
+	RetryJitter time.Duration
+	// RetryTimeout is the timeout of the retried commands in bash scripts. Zero means defaultRetryTimeout
+	RetryTimeout time.Duration
+	// Serial marks the suite that must not run concurrently with other serial suites, e.g. of the packages run by go test
+	// in parallel. Generated suites wait for the other serial suites in SetupSuite, ginkgo specs are decorated with Serial
+	Serial bool
+	// SuiteType is the pattern of the names of the generated suite types, see config.Config
+	SuiteType string
+	// PersistEnv makes bash scripts save the variables exported by the setup for the targets run separately
+	PersistEnv bool
+	// QualifiedNames makes the suites import the dependencies with the same package name by their paths
+	QualifiedNames bool
+	// IsGlobal marks the suite that is set up once before all the other suites and cleaned up after them
+	IsGlobal bool
+	// Global is the global suite set up before the suite, nil if there is no global suite or the suite is global
+	Global *Suite
+	// GlobalPkg is the package of the global suite
+	GlobalPkg Dependency
+	// Section is the level 2 heading the suite is generated from, empty for the suites of the whole examples
+	Section string
+	// Flat are the suites which setup is inlined into the setup of the suite instead of the nested suites, including
+	// the suite itself, see Suite.flatten. Empty if the suite isn't flattened
+	Flat []*Suite
+	// Package is the package of the file all the suites are generated into, see config.Config.SingleFile. Empty if each
+	// suite is generated into own package
+	Package string
+	// Siblings are the names of the suites generated into one package by their packages, nil if each suite is generated
+	// into own package
+	Siblings map[Dependency]string
+
+	// siblingName is the name of the suite in Siblings
+	siblingName string
+}
+
+// TypeName returns the name of the generated suite type
+func (s *Suite) TypeName() string {
+	name := suiteTypeName(s.SuiteType, s.Name())
+	if s.Siblings != nil {
+		name = siblingTypeName(s.SuiteType, s.siblingName)
+	}
+	if s.Section != "" {
+		return sectionName(s.Section) + name
+	}
+	return name
+}
+
+// packageName returns the name of the package the suite is generated into
+func (s *Suite) packageName() string {
+	if s.Package != "" {
+		return s.Package
+	}
+	return s.Name()
+}
+
+// runnerDir returns the dir of the runner in generated golang code
+func (s *Suite) runnerDir() string {
+	if s.NoChdir {
+		return ""
+	}
+	return s.Dirs.Runner(s.Dir)
+}
+
+// sourceFile returns the markdown file of the suite as it's referenced in the comments of generated golang code
+func (s *Suite) sourceFile() string {
+	return filepath.Join(s.Dirs.Runner(s.Dir), "README.md")
+}
+
+// bashChdir returns commands that change the dir to the dir of the example in generated bash scripts
+func (s *Suite) bashChdir() []string {
+	if s.NoChdir {
+		return nil
+	}
+	return []string{"cd " + s.Dirs.Bash(s.Dir)}
+}
+
+// imports returns imports of the generated suite
+func (s *Suite) imports(deps Dependencies, names map[Dependency]string) string {
+	imports := deps.ImportsString(names)
+	usesRunner := len(s.Assert) > 0
+	usesOS := usesRunner && envUsesOS(s.Env, s.EnvFile)
+	usesRequire := s.RequireNoError || len(s.Assert) > 0
+	usesTime := s.CommandTimeout > 0
+	bodies := []Body{s.Assert}
+	for _, x := range s.setupSuites() {
+		setupUsesRunner := len(x.Run)+len(x.Cleanup) > 0
+		usesRunner = usesRunner || setupUsesRunner
+		usesOS = usesOS || setupUsesRunner && envUsesOS(x.Env, x.EnvFile)
+		usesRequire = usesRequire || x.RequireNoError
+		usesTime = usesTime || x.CommandTimeout > 0
+		bodies = append(bodies, x.Run, x.Cleanup)
+	}
+	for _, test := range s.Tests {
+		testUsesRunner := len(test.Run)+len(test.Cleanup)+len(test.Assert) > 0
+		usesRunner = usesRunner || testUsesRunner
+		usesOS = usesOS || testUsesRunner && envUsesOS(test.Env, test.EnvFile)
+		usesRequire = usesRequire || len(test.Assert) > 0 || test.Run.hasGroups()
+		usesTime = usesTime || test.CommandTimeout > 0
+		bodies = append(bodies, test.Run, test.Cleanup, test.Assert)
+	}
+	var usesStrings, usesRegexp bool
+	for _, b := range bodies {
+		modes := b.outputModes()
+		normalized := modes[parser.OutputTrimmed] || modes[parser.OutputNormalized]
+		usesStrings = usesStrings || modes[parser.OutputExact] || normalized
+		usesRegexp = usesRegexp || modes[parser.OutputRegex] || normalized
+		usesOS = usesOS || b.hasConditions()
+	}
+	if !usesRunner {
+		return imports
+	}
+	if usesOS {
+		imports += "\n\"os\""
+	}
+	if usesRegexp {
+		imports += "\n\"regexp\""
+	}
+	if usesStrings {
+		imports += "\n\"strings\""
+	}
+	if usesTime {
+		imports += "\n\"time\""
+	}
+	if usesRequire {
+		imports += "\n\"github.com/stretchr/testify/require\""
+	}
+	return imports
+}
+
+// setupSuites returns the suites which commands are run by the setup of the suite
+func (s *Suite) setupSuites() []*Suite {
+	if len(s.Flat) > 0 {
+		return s.Flat
+	}
+	return []*Suite{s}
+}
+
+// isSerial returns true if the suite or a suite of its inlined setup is serial
+func (s *Suite) isSerial() bool {
+	for _, x := range append([]*Suite{s}, s.Flat...) {
+		if x.Serial {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Suite) commandTimeout() string {
+	if s.CommandTimeout == 0 {
+		return ""
+	}
+	return durationString(s.CommandTimeout)
+}
+
+func (s *Suite) generateChildrenTesting(names map[Dependency]string) (string, error) {
+	tmpl, err := template.New("test").Parse(includedSuiteTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	type suiteData struct {
+		Title string
+		Name  string
+	}
+
+	if len(s.Children) == 0 {
+		return "", nil
+	}
+
+	var suites []*suiteData
+	for _, child := range s.Children {
+		_, title := path.Split(child.Dir)
+		title = cases.Title(language.Und, cases.NoLower).String(nameRegex.ReplaceAllString(title, "_"))
+		suite := &suiteData{
+			Title: title,
+			Name:  localName(names, child.Dependency),
+		}
+
+		suites = append(suites, suite)
+	}
+
+	var result = new(strings.Builder)
+	err = tmpl.Execute(result, struct {
+		Suites []*suiteData
+	}{
+		Suites: suites,
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	return result.String(), nil
+}
+
+// checkSharedSession returns an error if the suite has a shared session, but the suite or its tests are not written for bash
+func (s *Suite) checkSharedSession() error {
+	if !s.SharedSession {
+		return nil
+	}
+	if s.Shell != parser.ShellBash {
+		return &Error{Kind: "suite", Dir: s.Dir, Err: errors.Errorf("shared sessions are not supported for %v examples", s.Shell)}
+	}
+	for _, test := range s.Tests {
+		if test.Shell != parser.ShellBash {
+			return &Error{Kind: "test", Dir: test.Dir, Err: errors.Errorf("shared sessions are not supported for %v examples", test.Shell)}
+		}
+	}
+	return nil
+}
+
+// String returns a string that contains generated testify.Suite. Panics if the suite can't be generated
+func (s *Suite) String() string {
+	source, err := s.Source()
+	if err != nil {
+		panic(err.Error())
+	}
+	return source
+}
+
+// Source returns a string that contains generated testify.Suite. The global suite is generated by GlobalSource
+func (s *Suite) Source() (string, error) {
+	if s.IsGlobal {
+		return s.GlobalSource()
+	}
+	if err := s.checkSharedSession(); err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("test").Parse(
+		suiteTemplate,
+	)
+
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	// A flattened suite imports only the base suite, the setup of the other suites is inlined
+	deps, depsToSetup := s.Deps, s.DepsToSetup
+	if len(s.Flat) > 0 {
+		deps, depsToSetup = deps[:1], depsToSetup[:1]
+	}
+	// The suites generated into one package embed each other as the sibling types, only the base suite is imported
+	names, imported := s.Siblings, deps[:1]
+	fields := deps.siblingFieldsString(s.SuiteType, names)
+	if s.Siblings == nil {
+		if names, err = deps.LocalNames(s.QualifiedNames); err != nil {
+			return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+		}
+		imported, fields = deps, deps.FieldsString(s.SuiteType, names)
+	}
+	var childrenTesting string
+	if len(s.Flat) == 0 {
+		if childrenTesting, err = s.generateChildrenTesting(names); err != nil {
+			return "", err
+		}
+	}
+
+	cleanup := s.Cleanup.goString(s.sourceFile(), s.RequireNoError, s.LogCommands)
+	if len(cleanup) > 0 {
+		cleanup = fmt.Sprintf(`	s.T().Cleanup(func() {
+		%v
+	})`, cleanup)
+	}
+	run := s.Run.goString(s.sourceFile(), s.RequireNoError, s.LogCommands)
+	setup := depsToSetup.SetupString(names)
+	if len(s.Flat) > 0 {
+		for _, x := range s.Flat {
+			setup += x.flatSetup()
+		}
+		cleanup, run = "", ""
+	}
+
+	var result = new(strings.Builder)
+
+	err = tmpl.Execute(result, struct {
+		Dir                string
+		Name               string
+		TypeName           string
+		Cleanup            string
+		Run                string
+		Fields             string
+		Imports            string
+		Setup              string
+		TestIncludedSuites string
+		CommandTimeout     string
+		RunnerFunc         string
+		EnvArgs            string
+		SharedSession      bool
+		Serial             bool
+	}{
+		Dir:                s.runnerDir(),
+		Name:               s.packageName(),
+		TypeName:           s.TypeName(),
+		Cleanup:            cleanup,
+		Run:                run,
+		Imports:            s.imports(imported, names),
+		Fields:             fields,
+		Setup:              setup,
+		TestIncludedSuites: childrenTesting,
+		CommandTimeout:     s.commandTimeout(),
+		RunnerFunc:         runnerFunc(s.Shell, s.SharedSession),
+		EnvArgs:            runnerEnvArgs(s.Env, s.EnvFile, s.Dirs),
+		SharedSession:      s.SharedSession,
+		Serial:             s.isSerial(),
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	if len(s.Tests) == 0 && len(s.Assert) == 0 {
+		s.Tests = append(s.Tests, &Test{SuiteType: s.TypeName()})
+	}
+
+	for _, test := range append(s.assertTest(), s.Tests...) {
+		source, err := test.Source()
+		if err != nil {
+			return "", err
+		}
+		_, _ = result.WriteString(source)
+	}
+
+	return spaceRegex.ReplaceAllString(strings.TrimSpace(result.String()), "\n"), nil
+}
+
+const bashSuiteTemplate = `
+#!/usr/bin/env bash
+{{ .Root }}{{ .StateDir }}{{ .RetryFunction }}
+setup_dependencies() {
+{{ .SetupDependencies }}}
+
+setup_main() {
+{{ .SetupMain }}}
+{{ .SaveEnv }}
+setup() {
+{{ .EnvFile }}	setup_dependencies && setup_main{{ if .SaveEnv }} && save_env{{ end }}
+}
+{{ if .AssertMain }}
+assert_main() {
+{{ .EnvFile }}{{ .AssertMain }}}
+{{ end }}{{ if .NoCleanup }}
+# the suite and its dependencies have nothing to clean up
+cleanup() {
+	:
+}
+{{ else }}
+cleanup_dependencies() {
+{{ .CleanupDependencies }}	# cleanup shouldn't report errors
+	true
+}
+
+cleanup_main() {
+{{ .CleanupMain }}	# cleanup shouldn't report errors
+	true
+}
+
+cleanup() {
+{{ .CleanupTests }}	cleanup_main
+	cleanup_dependencies
+	rm -rf "$gotestmd_state_dir"
+}
+{{ end }}`
+
+const bashRunAllTemplate = `
+
+test() {
+	# behave as the builtin when called with arguments, documented commands may rely on it
+	if [ $# -gt 0 ]; then
+		builtin test "$@"
+		return
+	fi
+{{ .Tests }}}
+
+run_all() {
+	trap cleanup EXIT
+	if [ -z "${SUITE_TIMEOUT_SECONDS:-}" ]; then
+		setup && test
+		return
+	fi
+	# job control runs the suite and the watchdog in own process groups, so they can be killed with all the commands
+	set -m
+	{ setup && test; } &
+	local suite_pid=$!
+	{
+		sleep "$SUITE_TIMEOUT_SECONDS" || exit 1
+		# the watchdog succeeds only if it has killed the suite
+		trap '' TERM
+		echo "suite timed out after $SUITE_TIMEOUT_SECONDS seconds" >&2
+		kill -- -"$suite_pid"
+	} &
+	local watchdog_pid=$!
+	set +m
+	wait "$suite_pid"
+	local status=$?
+	kill -- -"$watchdog_pid" 2>/dev/null
+	if wait "$watchdog_pid"; then
+		return 124
+	fi
+	return $status
+}
+`
+
+// defaultRetryTimeout is the timeout of the retried commands of the suites that don't set it
+const defaultRetryTimeout = 300 * time.Second
+
+const retryTemplate = `
+function try_run() {
+    command="$1"
+    attempt=0
+    retry_interval=1
+    timeout="${RETRY_TIMEOUT_SECONDS:-{{ .TimeoutSeconds }}}"
+    # zero means the number of attempts is not limited
+    max_attempts="${RETRY_MAX_ATTEMPTS:-{{ .MaxAttempts }}}"
+    # a random delay up to the jitter is added to the interval, so the retries of parallel scripts are spread out
+    jitter_ms="${RETRY_JITTER_MS:-{{ .JitterMS }}}"
+    if [ -n "${RETRY_JITTER_SEED:-}" ] && [ -z "${gotestmd_jitter_seeded:-}" ]; then
+        RANDOM=$RETRY_JITTER_SEED
+        gotestmd_jitter_seeded=1
+    fi
+    start_time="$(date -u +%s)"
+    echo "===== next command ====="
+    if [ "${2:-}" = sensitive ]; then
+        echo "<sensitive command>"
+    else
+        echo "$command"
+    fi
+    while true; do
+        attempt=$((attempt + 1))
+        echo "===== attempt $attempt ====="
+        echo "current time $(date +"%Y-%m-%dT%H:%M:%S%z")"
+        source /dev/stdin <<<"$(echo "${command}")"
+        retval=$?
+		echo
+        echo "retval = $retval"
+        current_time="$(date -u +%s)"
+        elapsed=$((current_time-start_time))
+        echo "elapsed = $elapsed"
+        [ $retval = 0 ] && echo "===== command success =====" && return 0
+        [ "$elapsed" -gt "$timeout" ] && echo "===== command timed out =====" && return 1
+        [ "$max_attempts" -gt 0 ] && [ "$attempt" -ge "$max_attempts" ] && echo "===== attempts exhausted =====" && return 1
+        if [ "$jitter_ms" -gt 0 ]; then
+            delay_ms=$((retry_interval * 1000 + ($RANDOM * 32768 + $RANDOM) % (jitter_ms + 1)))
+            echo "===== retry in $delay_ms ms ====="
+            sleep "$((delay_ms / 1000)).$(printf '%03d' $((delay_ms % 1000)))"
+        else
+            sleep $retry_interval
+        fi
+    done
+}
+`
+
+// BashString generates bash script for the suite. Panics if the script can't be generated
+func (s *Suite) BashString(retry bool) string {
+	source, err := s.BashSource(retry)
+	if err != nil {
+		panic(err.Error())
+	}
+	return source
+}
+
+// bashSetupDependencies returns the setup commands of the global suite and the parents run by the bash script of the suite
+func (s *Suite) bashSetupDependencies() Body {
+	var result Body
+	if s.Global != nil {
+		result = append(result, s.Global.getDependenciesSetup()...)
+	}
+	for _, p := range s.Parents {
+		result = append(result, p.getDependenciesSetup()...)
+	}
+	return result
+}
+
+// BashWarnings returns the warnings about the bash script of the suite, e.g. the variables exported by the setup that
+// the other targets use. BashSource doesn't report them, so the callers decide whether to show them
+func (s *Suite) BashWarnings() []string {
+	if s.PersistEnv {
+		return nil
+	}
+	return s.exportWarnings(exportedNames(append(s.bashSetupDependencies(), s.Run...)))
+}
+
+// BashSource generates bash script for the suite
+func (s *Suite) BashSource(retry bool) (string, error) {
+	setupDependencies := s.bashSetupDependencies()
+	var cleanupDependencies Body
+	for _, p := range s.Parents {
+		cleanupDependencies = append(cleanupDependencies, p.getDependenciesCleanup()...)
+	}
+	if s.Global != nil {
+		cleanupDependencies = append(cleanupDependencies, s.Global.getDependenciesCleanup()...)
+	}
+
+	// variables exported by the setup are visible for the other targets only if they are saved
+	exported := exportedNames(append(append(Body{}, setupDependencies...), s.Run...))
+	saveEnv := ""
+	if s.PersistEnv && len(exported) > 0 {
+		saveEnv = bashSaveEnv(exported)
+	}
+
+	// the cleanup machinery is omitted if there are no cleanup commands and no markers of the commands annotated with once
+	// or saved variables
+	noCleanup := !s.hasCleanup() && !setupDependencies.hasAnnotation("once") && !s.Run.hasAnnotation("once") && saveEnv == ""
+	for _, test := range s.Tests {
+		noCleanup = noCleanup && !test.Run.hasAnnotation("once") && !test.hasBashCleanup()
+	}
+
+	absDir := s.Dirs.Bash(s.Dir)
+	// the suite is not changed, so the suites that require it and the source map get its own commands
+	run := append(append(Body{fmt.Sprintf("echo 'setup suite %s'", filepath.Dir(s.Location))}, s.bashChdir()...), s.Run...)
+	cleanup := append(append(Body{fmt.Sprintf("echo 'cleanup suite %s'", filepath.Dir(s.Location))}, s.bashChdir()...), s.Cleanup...)
+
+	tmpl, err := template.New("test").Parse(bashSuiteTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+
+	var result = new(strings.Builder)
+
+	// try_run is needed for all the commands or for the commands annotated with retry
+	retryFunction := ""
+	bodies := []Body{setupDependencies, cleanupDependencies, run, cleanup, s.Assert}
+	for _, test := range s.Tests {
+		bodies = append(bodies, test.Run, test.Cleanup, test.Assert)
+	}
+	for _, b := range bodies {
+		if retry || b.hasAnnotation("retry") {
+			retryFunction = retryTemplate
+		}
+	}
+	if retryFunction != "" {
+		if retryFunction, err = s.retryFunction(); err != nil {
+			return "", err
+		}
+	}
+	err = tmpl.Execute(result, struct {
+		Dir                 string
+		SetupDependencies   string
+		SetupMain           string
+		CleanupDependencies string
+		CleanupMain         string
+		CleanupTests        string
+		AssertMain          string
+		RetryFunction       string
+		Root                string
+		StateDir            string
+		EnvFile             string
+		SaveEnv             string
+		NoCleanup           bool
+	}{
+		Dir:                 absDir,
+		SetupDependencies:   setupDependencies.bashString(true, retry, s.Timing),
+		SetupMain:           run.bashString(true, retry, s.Timing),
+		CleanupDependencies: cleanupDependencies.bashString(false, false, s.Timing),
+		CleanupMain:         cleanup.bashString(false, false, s.Timing),
+		CleanupTests:        s.bashCleanupTests(),
+		AssertMain:          s.bashAssert(retry),
+		RetryFunction:       retryFunction,
+		Root:                s.Dirs.BashRoot(s.Location),
+		StateDir:            s.bashStateDir(),
+		EnvFile:             s.EnvFile.BashString(s.Dirs),
+		SaveEnv:             saveEnv,
+		NoCleanup:           noCleanup,
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	var tests Body
+	if len(s.Assert) > 0 {
+		// the assertions of the suite are checked before its tests
+		tests = append(tests, "assert_main")
+	}
+	for _, test := range s.Tests {
+		source, err := test.BashSource(retry)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(source)
+		tests = append(tests, "test"+test.Name)
+	}
+
+	tmpl, err = template.New("runall").Parse(bashRunAllTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	err = tmpl.Execute(result, struct {
+		Tests string
+	}{
+		Tests: tests.BashString(true, false),
+	})
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	result.WriteString("\n\n")
+	if saveEnv != "" {
+		result.WriteString(bashLoadEnv())
+	}
+	result.WriteString("\"$1\"\n")
+
+	return result.String(), nil
+}
+
+// runAndAssert returns the commands of the suite followed by its assertions, for the formats that check the assertions
+// as steps of the setup
+func (s *Suite) runAndAssert() Body {
+	return append(append(Body{}, s.Run...), s.Assert...)
+}
+
+// assertTest returns Test method of the golang suite that checks the assertions of the suite, if any
+func (s *Suite) assertTest() []*Test {
+	if len(s.Assert) == 0 {
+		return nil
+	}
+	return []*Test{{
+		Dir:            s.Dir,
+		Assert:         s.Assert,
+		CommandTimeout: s.CommandTimeout,
+		Dirs:           s.Dirs,
+		Shell:          s.Shell,
+		SharedSession:  s.SharedSession,
+		Env:            s.Env,
+		NoChdir:        s.NoChdir,
+		EnvFile:        s.EnvFile,
+		LogCommands:    s.LogCommands,
+		SuiteType:      s.TypeName(),
+	}}
+}
+
+// bashAssert returns the assertions of the suite for generated bash scripts
+func (s *Suite) bashAssert(retry bool) string {
+	if len(s.Assert) == 0 {
+		return ""
+	}
+	return Body(append(s.bashChdir(), s.Assert...)).bashString(true, retry, s.Timing)
+}
+
+// bashCleanupTests returns the commands that tear down the failed or interrupted tests before the suite in generated bash scripts.
+// The tests are torn down in reverse order
+func (s *Suite) bashCleanupTests() string {
+	var sb strings.Builder
+	for i := len(s.Tests) - 1; i >= 0; i-- {
+		if test := s.Tests[i]; test.hasBashCleanup() {
+			fmt.Fprintf(&sb, "\t[ ! -f %v ] || cleanup_test%v\n", test.bashMarker(), test.Name)
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "\t# the tests tear down before the suite\n" + sb.String()
+}
+
+// hasCleanup returns true if the suite or its dependencies have cleanup commands
+func (s *Suite) hasCleanup() bool {
+	if len(s.Cleanup) > 0 || s.Global != nil && s.Global.hasCleanup() {
+		return true
+	}
+	for _, p := range s.Parents {
+		if p.hasCleanup() {
+			return true
+		}
+	}
+	return false
+}
+
+// retryFunction returns try_run function of the bash script
+func (s *Suite) retryFunction() (string, error) {
+	tmpl, err := template.New("retry").Parse(retryTemplate)
+	if err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	timeout := s.RetryTimeout
+	if timeout == 0 {
+		timeout = defaultRetryTimeout
+	}
+	var result strings.Builder
+	if err := tmpl.Execute(&result, struct {
+		MaxAttempts    int
+		JitterMS       int64
+		TimeoutSeconds int64
+	}{
+		MaxAttempts:    s.RetryMaxAttempts,
+		JitterMS:       s.RetryJitter.Milliseconds(),
+		TimeoutSeconds: int64(timeout / time.Second),
+	}); err != nil {
+		return "", &Error{Kind: "suite", Dir: s.Dir, Err: err}
+	}
+	return result.String(), nil
+}
+
+// bashStateDir returns the declaration of the dir with markers of the commands annotated with once
+func (s *Suite) bashStateDir() string {
+	absLocation, _ := filepath.Abs(s.Location)
+	return fmt.Sprintf("%v=\"${%v:-${TMPDIR:-/tmp}/gotestmd}/%v-%v\"\n",
+		stateDirVar, stateDirEnv, s.Name(), blockHash(absLocation))
+}
+
+func (s *Suite) getDependenciesSetup() []string {
+	setup := make([]string, 0)
+	for _, p := range s.Parents {
+		setup = append(setup, p.getDependenciesSetup()...)
+	}
+
+	setup = append(setup, fmt.Sprintf("echo 'setup suite %s'", filepath.Dir(s.Location)))
+	setup = append(setup, s.bashChdir()...)
+	setup = append(setup, s.Run...)
+	return setup
+}
+
+func (s *Suite) getDependenciesCleanup() []string {
+	cleanup := []string{fmt.Sprintf("echo 'cleanup suite %s'", filepath.Dir(s.Location))}
+	cleanup = append(cleanup, s.bashChdir()...)
+	cleanup = append(cleanup, s.Cleanup...)
+	for _, p := range s.Parents {
+		cleanup = append(cleanup, p.getDependenciesCleanup()...)
+	}
+
+	return cleanup
+}
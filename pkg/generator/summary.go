@@ -0,0 +1,94 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summary is a report of the generated suites
+type Summary struct {
+	Suites   int
+	Commands int
+	// Unchanged is the number of the suites skipped by incremental generation
+	Unchanged int
+	// NoTests are dirs of the suites that have no tests
+	NoTests []string
+	// Warnings are possible authoring problems of the examples
+	Warnings []string
+}
+
+// Summarize returns a report of the suites
+func Summarize(suites []*Suite) *Summary {
+	result := &Summary{Suites: len(suites)}
+	// the commands of the examples split into suites are usually in the suites of the sections
+	split := map[string]bool{}
+	for _, s := range suites {
+		if s.Section != "" {
+			split[s.Dir] = true
+		}
+	}
+	for _, s := range suites {
+		commands := len(s.Run) + len(s.Cleanup) + len(s.Assert)
+		var tests int
+		for _, test := range s.Tests {
+			if test.Name == "" {
+				continue
+			}
+			tests++
+			for _, c := range test.cases() {
+				commands += len(c.Run) + len(c.Cleanup) + len(c.Assert)
+			}
+		}
+		result.Commands += commands
+		if tests == 0 && !s.IsGlobal && !split[s.Dir] {
+			result.NoTests = append(result.NoTests, s.Dir)
+		}
+		if commands == 0 && len(s.Children) == 0 && !split[s.Dir] {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%v: the suite has no commands, tests or included suites", s.Dir))
+		}
+		for _, parent := range s.Parents {
+			if parent == nil && s.Section == "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%v: a required suite is not generated", s.Dir))
+			}
+		}
+	}
+	return result
+}
+
+// String returns the report in a human readable form
+func (s *Summary) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "generated %v suites with %v commands\n", s.Suites, s.Commands)
+	if s.Unchanged > 0 {
+		fmt.Fprintf(&sb, "skipped %v unchanged suites\n", s.Unchanged)
+	}
+	if len(s.NoTests) > 0 {
+		fmt.Fprintf(&sb, "suites without tests (%v):\n", len(s.NoTests))
+		for _, dir := range s.NoTests {
+			fmt.Fprintf(&sb, "\t%v\n", dir)
+		}
+	}
+	if len(s.Warnings) > 0 {
+		fmt.Fprintf(&sb, "warnings (%v):\n", len(s.Warnings))
+		for _, warning := range s.Warnings {
+			fmt.Fprintf(&sb, "\t%v\n", warning)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2020-2023 Doc.ai and/or its affiliates.
+//
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const emptyTest = `func (s *{{ .TypeName }}) Test() {}`
+
+const testTemplate = `
+func (s *{{ .TypeName }}) Test{{ .Name }}() {
+	{{ range .Cases }}
+	{{ if .Name }}
+	s.Run("{{ .Name }}", func() {
+	{{ end }}
+	r := s.{{ $.RunnerFunc }}("{{ $.Dir }}"{{ $.EnvArgs }})
+	{{ if $.CommandTimeout }}
+	r.SetCommandTimeout({{ $.CommandTimeout }})
+	{{ end }}
+	{{ .Cleanup }}
+	{{ .Run }}
+	{{ if .Name }}
+	})
+	{{ end }}
+	{{ end }}
+}
+`
+
+// Test is a template for a test for a suite
+type Test struct {
+	Dir     string
+	Name    string
+	Cleanup Body
+	Run     Body
+	// Assert are the commands that verify the result of Run, their failures are reported with require
+	Assert Body
+	Matrix Matrix
+	// CommandTimeout is a timeout for a single run of a command. Zero means no timeout
+	CommandTimeout time.Duration
+	Dirs           Dirs
+	// Shell is the shell to run the commands with
+	Shell string
+	// RequireNoError makes the commands checked with require.NoError, so failed commands are shown in the assertions
+	RequireNoError bool
+	// SharedSession makes the test run the commands in the shell session of the suite
+	SharedSession bool
+	Env           *Env
+	// NoChdir leaves the runners in the current dir instead of the dir of the example
+	NoChdir bool
+	EnvFile *EnvFile
+	// Timing makes bash scripts echo each command and its duration
+	Timing bool
+	// LogCommands makes golang tests log each command before it runs
+	LogCommands bool
+	// SuiteType is the name of the suite type the test belongs to. Defaults to Suite
+	SuiteType string
+}
+
+// testCase is a single run of the test. Tests with a matrix have a case for each combination
+type testCase struct {
+	Name    string
+	Cleanup Body
+	Run     Body
+	Assert  Body
+}
+
+// runAndAssert returns the commands of the case followed by its assertions, for the formats that check the assertions
+// as steps of the test
+func (c *testCase) runAndAssert() Body {
+	return append(append(Body{}, c.Run...), c.Assert...)
+}
+
+func (t *Test) cases() []*testCase {
+	combinations := t.Matrix.Combinations()
+	if len(combinations) == 0 {
+		return []*testCase{{Cleanup: t.Cleanup, Run: t.Run, Assert: t.Assert}}
+	}
+
+	var result []*testCase
+	for _, c := range combinations {
+		result = append(result, &testCase{
+			Name:    c.Name(),
+			Cleanup: c.Apply(t.Cleanup),
+			Run:     c.Apply(t.Run),
+			Assert:  c.Apply(t.Assert),
+		})
+	}
+	return result
+}
+
+// goRunString returns the commands and the assertions of the case as part of the test method. The assertions are always
+// checked with require, so their failures are failures of the test. Consecutive blocks annotated with the same group are run
+// in a subtest named by the group. The commands of a group are checked with require too, because the runner fails the test
+// it was created in, and the test stops if the subtest fails
+func (c *testCase) goRunString(source string, requireNoError, logCommands bool) string {
+	var sb strings.Builder
+	blocks := c.runAndAssert()
+	for i := 0; i < len(blocks); {
+		name := group(blocks[i])
+		end := i + 1
+		for end < len(blocks) && group(blocks[end]) == name {
+			end++
+		}
+		if name != "" {
+			_, _ = fmt.Fprintf(&sb, "if !s.Run(%q, func() {\n%v}) {\ns.T().FailNow()\n}\n", name, blocks[i:end].goString(source, true, logCommands))
+			i = end
+			continue
+		}
+		// the blocks before len(c.Run) are the commands, the rest are the assertions
+		split := len(c.Run)
+		if split < i {
+			split = i
+		}
+		if split > end {
+			split = end
+		}
+		sb.WriteString(blocks[i:split].goString(source, requireNoError, logCommands))
+		sb.WriteString(blocks[split:end].goString(source, true, logCommands))
+		i = end
+	}
+	return sb.String()
+}
+
+// hasBashCleanup returns true if the test has the cleanup that is called by the cleanup of the suite in generated bash scripts.
+// The cleanup of each matrix combination is run right after the combination
+func (t *Test) hasBashCleanup() bool {
+	return len(t.Matrix.Combinations()) == 0 && len(t.Cleanup) > 0
+}
+
+// bashMarker returns the marker of the running test in generated bash scripts
+func (t *Test) bashMarker() string {
+	return fmt.Sprintf("\"$%v/test%v\"", stateDirVar, t.Name)
+}
+
+// runnerDir returns the dir of the runner in generated golang code
+func (t *Test) runnerDir() string {
+	if t.NoChdir {
+		return ""
+	}
+	return t.Dirs.Runner(t.Dir)
+}
+
+// sourceFile returns the markdown file of the test as it's referenced in the comments of generated golang code
+func (t *Test) sourceFile() string {
+	return filepath.Join(t.Dirs.Runner(t.Dir), "README.md")
+}
+
+// typeName returns the name of the suite type the test belongs to
+func (t *Test) typeName() string {
+	if t.SuiteType == "" {
+		return "Suite"
+	}
+	return t.SuiteType
+}
+
+// String returns string as a test for the suite. Panics if the test can't be generated
+func (t *Test) String() string {
+	source, err := t.Source()
+	if err != nil {
+		panic(err.Error())
+	}
+	return source
+}
+
+// Source returns string as a test for the suite
+func (t *Test) Source() (string, error) {
+	source := testTemplate
+	if len(t.Cleanup)+len(t.Run)+len(t.Assert) == 0 {
+		source = emptyTest
+	}
+
+	tmpl, err := template.New("test").Parse(
+		source,
+	)
+
+	if err != nil {
+		return "", &Error{Kind: "test", Dir: t.Dir, Err: err}
+	}
+
+	type caseData struct {
+		Name    string
+		Cleanup string
+		Run     string
+	}
+
+	var cases []*caseData
+	for _, c := range t.cases() {
+		cleanup := c.Cleanup.goString(t.sourceFile(), t.RequireNoError, t.LogCommands)
+		if len(cleanup) > 0 {
+			cleanup = fmt.Sprintf(`	s.T().Cleanup(func() {
+		%v
+	})`, cleanup)
+		}
+		cases = append(cases, &caseData{
+			Name:    c.Name,
+			Cleanup: cleanup,
+			Run:     c.goRunString(t.sourceFile(), t.RequireNoError, t.LogCommands),
+		})
+	}
+
+	var result = new(strings.Builder)
+
+	var commandTimeout string
+	if t.CommandTimeout > 0 {
+		commandTimeout = durationString(t.CommandTimeout)
+	}
+
+	err = tmpl.Execute(result, struct {
+		Dir            string
+		Name           string
+		TypeName       string
+		Cases          []*caseData
+		CommandTimeout string
+		RunnerFunc     string
+		EnvArgs        string
+	}{
+		Name:           t.Name,
+		TypeName:       t.typeName(),
+		Dir:            t.runnerDir(),
+		Cases:          cases,
+		CommandTimeout: commandTimeout,
+		RunnerFunc:     runnerFunc(t.Shell, t.SharedSession),
+		EnvArgs:        runnerEnvArgs(t.Env, t.EnvFile, t.Dirs),
+	})
+	if err != nil {
+		return "", &Error{Kind: "test", Dir: t.Dir, Err: err}
+	}
+
+	return result.String(), nil
+}
+
+// bashTestTemplate moves the cleanup of the test into own function. The test leaves a marker while it runs,
+// so the cleanup of the suite tears the test down first if the test has failed or was interrupted
+const bashTestTemplate = `{{ if .Cleanup }}
+cleanup_test{{ .Name }}() {
+	rm -f {{ .Marker }}
+{{ .Cleanup }}}
+{{ end }}
+test{{ .Name }}() {
+{{ if .Cleanup }}	mkdir -p "$gotestmd_state_dir" && touch {{ .Marker }}
+{{ end }}{{ .EnvFile }}{{ .Run }}{{ if .Cleanup }}	cleanup_test{{ .Name }}
+{{ else }}
+{{ end }}}`
+
+// BashString generates a bash script for the test. Panics if the script can't be generated
+func (t *Test) BashString(retry bool) string {
+	source, err := t.BashSource(retry)
+	if err != nil {
+		panic(err.Error())
+	}
+	return source
+}
+
+// BashSource generates a bash script for the test
+func (t *Test) BashSource(retry bool) (string, error) {
+	tmpl, err := template.New("bashtest").Parse(bashTestTemplate)
+	if err != nil {
+		return "", &Error{Kind: "test", Dir: t.Dir, Err: err}
+	}
+	absDir := t.Dirs.Bash(t.Dir)
+
+	var run strings.Builder
+	for _, c := range t.cases() {
+		body := c.runAndAssert()
+		if c.Name != "" {
+			body = append(Body{fmt.Sprintf("echo 'run test %s with %s'", t.Name, c.Name)}, body...)
+		}
+		if !t.NoChdir {
+			body = append(body, "cd "+absDir)
+		}
+		run.WriteString(body.bashString(true, retry, t.Timing))
+		if c.Name != "" {
+			// cleanup each combination before the next one
+			run.WriteString(c.Cleanup.bashString(false, false, t.Timing))
+		}
+	}
+	var cleanup string
+	if t.hasBashCleanup() {
+		// the cleanup of the suite calls the cleanup of the test from any dir
+		body := Body{fmt.Sprintf("echo 'cleanup test %s'", t.Name)}
+		if !t.NoChdir {
+			body = append(body, "cd "+absDir)
+		}
+		cleanup = append(body, t.Cleanup...).bashString(false, false, t.Timing)
+	}
+	result := new(strings.Builder)
+
+	err = tmpl.Execute(result, struct {
+		Dir     string
+		Name    string
+		Run     string
+		Cleanup string
+		Marker  string
+		EnvFile string
+	}{
+		Name:    t.Name,
+		Dir:     absDir,
+		Run:     run.String(),
+		Cleanup: cleanup,
+		Marker:  t.bashMarker(),
+		EnvFile: t.EnvFile.BashString(t.Dirs),
+	})
+	if err != nil {
+		return "", &Error{Kind: "test", Dir: t.Dir, Err: err}
+	}
+
+	return result.String(), nil
+}
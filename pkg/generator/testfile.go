@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const standaloneTemplate = `// Code generated by gotestmd DO NOT EDIT.
+package {{ .Name }}
+
+import(
+	{{ if .GlobalPkg }}"os"{{ end }}
+	"testing"
+	{{ if .Suite }}
+	"github.com/stretchr/testify/suite"
+	{{ end }}
+	{{ if .GlobalPkg }}"{{ .GlobalPkg.Pkg }}"{{ end }}
+)
+{{ if .GlobalPkg }}
+func TestMain(m *testing.M) {
+	os.Exit({{ .GlobalPkg.Name }}.Main(m))
+}
+{{ end }}{{ if .Suite }}
+func {{ .FuncName }}(t *testing.T) {
+	suite.Run(t, new({{ .TypeName }}))
+}
+{{ end }}{{ range .Tests }}
+func Test{{ . }}(t *testing.T) {
+	s := new({{ $.TypeName }})
+	s.SetT(t)
+	s.SetupSuite()
+	s.Test{{ . }}()
+}
+{{ end }}`
+
+// TestFileLocation returns the location of the test file of the suite
+func (s *Suite) TestFileLocation() string {
+	if s.Section != "" {
+		return strings.TrimSuffix(s.Location, ".go") + "_test.go"
+	}
+	return filepath.Join(filepath.Dir(s.Location), "suite.gen_test.go")
+}
+
+// TestFileSource returns a test file of the suite. If withSuite is set, the file has TestGeneratedSuite function that runs
+// the whole suite. If standalone is set, the file has a top-level test function for each test of the suite, so the tests can be
+// selected with go test -run. Each function sets up the suite and its dependencies on its own, the setup is not shared
+// between the functions and is cleaned up when the function finishes. If there is a global suite, the file has TestMain that
+// sets it up. Returns empty string if the file has no functions or the suite is global
+func (s *Suite) TestFileSource(withSuite, standalone bool) (string, error) {
+	if s.IsGlobal {
+		return "", nil
+	}
+	var tests []string
+	for _, test := range s.Tests {
+		if standalone && test.Name != "" {
+			tests = append(tests, test.Name)
+		}
+	}
+	if len(tests) == 0 && !withSuite {
+		return "", nil
+	}
+
+	tmpl, err := template.New("standalone").Parse(standaloneTemplate)
+	if err != nil {
+		return "", &Error{Kind: "test file", Dir: s.Dir, Err: err}
+	}
+	// TestMain is declared once in the package, by the test file of the suite of the whole example
+	globalPkg := s.GlobalPkg
+	if s.Section != "" {
+		globalPkg = ""
+	}
+
+	var result = new(strings.Builder)
+	err = tmpl.Execute(result, struct {
+		Name      string
+		TypeName  string
+		FuncName  string
+		Suite     bool
+		Tests     []string
+		GlobalPkg Dependency
+	}{
+		Name:      s.Name(),
+		TypeName:  s.TypeName(),
+		FuncName:  s.testFuncName(),
+		Suite:     withSuite,
+		Tests:     tests,
+		GlobalPkg: globalPkg,
+	})
+	if err != nil {
+		return "", &Error{Kind: "test file", Dir: s.Dir, Err: err}
+	}
+
+	return spaceRegex.ReplaceAllString(result.String(), "\n"), nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Modes of the commands with characters that can't be written to go raw strings
+const (
+	// UnsafeEscape writes the lines of the commands with such characters to interpreted string literals
+	UnsafeEscape = "escape"
+	// UnsafeReject fails the generation of golang code with such commands
+	UnsafeReject = "reject"
+)
+
+// unsafeRune returns the first character of the line that can't be written to a go raw string as is: a backtick,
+// a carriage return that is dropped from raw strings, another control character except tab, a byte order mark
+// or a byte of invalid UTF-8
+func unsafeRune(line string) (rune, bool) {
+	for i, r := range line {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(line[i:]); size == 1 {
+				return r, true
+			}
+		}
+		if r == '`' || r == '\uFEFF' || r != '\t' && unicode.IsControl(r) {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// describeRune returns a description of the unsafe character for the messages
+func describeRune(r rune) string {
+	switch r {
+	case '`':
+		return "a backtick"
+	case utf8.RuneError:
+		return "invalid UTF-8"
+	}
+	return fmt.Sprintf("unprintable character %q", r)
+}
+
+// CheckCommands returns an error for the first command of the suites or their tests with a character that can't be written
+// to a go raw string. The error points to the markdown file and the lines of the code block
+func CheckCommands(suites []*Suite) error {
+	for _, s := range suites {
+		if err := checkCommands(s.Dir, s.Run, s.Cleanup, s.Assert); err != nil {
+			return err
+		}
+		for _, test := range s.Tests {
+			if err := checkCommands(test.Dir, test.Run, test.Cleanup, test.Assert); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkCommands(dir string, bodies ...Body) error {
+	for _, b := range bodies {
+		for _, block := range b {
+			_, cmd := cutAnnotations(block)
+			r, ok := unsafeRune(strings.ReplaceAll(cmd, "\n", ""))
+			if !ok {
+				continue
+			}
+			location := filepath.Join(dir, "README.md")
+			if first, last, ok := sourceLines(block); ok {
+				location = fmt.Sprintf("%v:%v-%v", location, first, last)
+			}
+			return errors.Errorf("%v: command contains %v, that can't be written to a go raw string, "+
+				"use --unsafe-commands=escape to escape it: %q", location, describeRune(r), cmd)
+		}
+	}
+	return nil
+}
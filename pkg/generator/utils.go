@@ -19,12 +19,18 @@
 package generator
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+
+	"github.com/networkservicemesh/gotestmd/internal/parser"
 )
 
 var nameRegex = regexp.MustCompile("[^a-zA-Z0-9]+")
@@ -34,6 +40,38 @@ func normalizeName(s string) string {
 	return strings.ToLower(nameRegex.ReplaceAllString(s, "_"))
 }
 
+// durationString returns go code of the duration, e.g. 90 * time.Second
+func durationString(d time.Duration) string {
+	switch {
+	case d%time.Second == 0:
+		return fmt.Sprintf("%d * time.Second", d/time.Second)
+	case d%time.Millisecond == 0:
+		return fmt.Sprintf("%d * time.Millisecond", d/time.Millisecond)
+	default:
+		return fmt.Sprintf("time.Duration(%d)", d)
+	}
+}
+
+// runnerFunc returns the name of the suite method that creates a runner for the shell
+func runnerFunc(shell string, sharedSession bool) string {
+	if sharedSession {
+		return "Session"
+	}
+	if shell == parser.ShellPowerShell {
+		return "PowerShellRunner"
+	}
+	return "Runner"
+}
+
+// suiteTypeName returns the name of the suite type of the package. "*" of the pattern is replaced with the title-cased
+// package name, e.g. *Suite gives FooSuite for foo package. Empty pattern means Suite
+func suiteTypeName(pattern, pkg string) string {
+	if pattern == "" {
+		return "Suite"
+	}
+	return strings.ReplaceAll(pattern, "*", cases.Title(language.Und, cases.NoLower).String(pkg))
+}
+
 func normalizeDeps(module string, deps []string) Dependencies {
 	var d Dependencies
 	for _, dep := range deps {
@@ -63,7 +101,26 @@ func moduleName(start string) string {
 			moduleName := strings.TrimPrefix(strings.Split(string(source), "\n")[0], "module ")
 			return filepath.Clean(filepath.Join(moduleName, start))
 		}
+		if filepath.Dir(currDir) == currDir {
+			break
+		}
 		currDir = filepath.Dir(currDir)
 	}
 	return ""
 }
+
+// findRoot returns the dir of the go module containing the current working dir
+func findRoot() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	for currDir := wd; ; currDir = filepath.Dir(currDir) {
+		if _, err := os.Stat(filepath.Join(currDir, "go.mod")); err == nil {
+			return currDir
+		}
+		if filepath.Dir(currDir) == currDir {
+			return wd
+		}
+	}
+}
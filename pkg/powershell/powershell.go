@@ -0,0 +1,43 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package powershell provides PowerShell runner
+package powershell
+
+import (
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+)
+
+// Shell returns bash.Shell for PowerShell.
+//
+// Exit code of a command is 0 if the command succeeds, otherwise it's $LASTEXITCODE of a native command or 1 for cmdlets.
+// PrintStatus starts with an empty line to finish multiline statements of the command.
+func Shell() bash.Shell {
+	return bash.Shell{
+		Path: "pwsh",
+		Args: []string{"-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "-"},
+		PrintStatus: "\n" + `$gotestmdStatus = if ($?) { 0 } elseif ($LASTEXITCODE) { $LASTEXITCODE } else { 1 }; ` +
+			`[Console]::Out.WriteLine(); [Console]::Out.WriteLine($gotestmdStatus)`,
+		PrintStdout: `[Console]::Out.WriteLine("%v")`,
+		PrintStderr: `[Console]::Error.WriteLine("%v")`,
+		Exit:        "exit 0",
+	}
+}
+
+// New creates a new PowerShell runner and initializes it
+func New(options ...bash.Option) (*bash.Bash, error) {
+	return bash.New(append([]bash.Option{bash.WithShell(Shell())}, options...)...)
+}
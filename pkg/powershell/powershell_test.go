@@ -0,0 +1,59 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package powershell_test
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"github.com/networkservicemesh/gotestmd/pkg/powershell"
+)
+
+func TestPowerShellProc(t *testing.T) {
+	if _, err := exec.LookPath("pwsh"); err != nil {
+		t.Skip("pwsh is not installed")
+	}
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	runner, err := powershell.New()
+	require.NoError(t, err)
+	defer runner.Close()
+
+	stdout, stderr, exitCode, err := runner.Run(`$A = "hello"`)
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Empty(t, stdout)
+	require.Empty(t, stderr)
+
+	stdout, stderr, exitCode, err = runner.Run(`Write-Output "$A world"`)
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+	require.Equal(t, "hello world", stdout)
+	require.Empty(t, stderr)
+
+	_, _, exitCode, err = runner.Run(`pwsh -NoProfile -Command "exit 42"`)
+	require.NoError(t, err)
+	require.Equal(t, 42, exitCode)
+
+	_, stderr, exitCode, err = runner.Run(`Get-Item ./does-not-exist`)
+	require.NoError(t, err)
+	require.Equal(t, 1, exitCode)
+	require.NotEmpty(t, stderr)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// RootEnv overrides the dir that relative dirs of the runners are resolved against. Defaults to the root of the go module
+const RootEnv = "GOTESTMD_ROOT"
+
+// Resolve resolves relative path against GOTESTMD_ROOT env or the root of the go module containing the current dir.
+// Empty path means the current dir and is returned as is
+func Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	root := os.Getenv(RootEnv)
+	if root == "" {
+		root = findRoot()
+	}
+	return filepath.Join(root, path)
+}
+
+// findRoot returns the dir of the go module containing the current dir or empty string if there is no go module
+func findRoot() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for currDir := wd; ; currDir = filepath.Dir(currDir) {
+		if _, err := os.Stat(filepath.Join(currDir, "go.mod")); err == nil {
+			return currDir
+		}
+		if filepath.Dir(currDir) == currDir {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runner provides an interface of the shell runners
+package runner
+
+import (
+	"context"
+)
+
+// Runner runs commands one by one in a shell process. Shell state like env variables or current dir is kept between commands.
+type Runner interface {
+	// Run runs the command and returns its output and exit code
+	Run(cmd string) (stdout, stderr string, exitCode int, err error)
+	// RunContext runs the command like Run. If ctx is done before the command finishes, the runner is closed.
+	RunContext(ctx context.Context, cmd string) (stdout, stderr string, exitCode int, err error)
+	// Dir returns the initial dir of the runner
+	Dir() string
+	// Close closes the runner and all the resources used by it
+	Close()
+}
+
+// StdinRunner is a Runner that can run commands with the given stdin
+type StdinRunner interface {
+	Runner
+	// StdinCommand returns a command that runs cmd with stdin as its standard input
+	StdinCommand(cmd, stdin string) (string, error)
+}
+
+// Factory creates a runner in the dir with the env variables
+type Factory func(dir string, env ...string) (Runner, error)
@@ -0,0 +1,128 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ssh provides a runner that runs the commands on a remote host over SSH
+package ssh
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
+)
+
+// Starter returns bash.Starter that starts the shell on the remote host of the client.
+// The shell is started in the dir on the remote host, env variables are set for the shell.
+func Starter(client *ssh.Client) bash.Starter {
+	return func(shell bash.Shell, dir string, env []string) (bash.Process, error) {
+		session, err := client.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		result := &process{session: session}
+		if result.stdin, err = session.StdinPipe(); err != nil {
+			_ = session.Close()
+			return nil, err
+		}
+		if result.stdout, err = session.StdoutPipe(); err != nil {
+			_ = session.Close()
+			return nil, err
+		}
+		if result.stderr, err = session.StderrPipe(); err != nil {
+			_ = session.Close()
+			return nil, err
+		}
+		if err = session.Start(command(shell, dir, env)); err != nil {
+			_ = session.Close()
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// New creates a new runner that runs the commands on the remote host of the client.
+// bash.WithDir and bash.WithEnv options set the dir and env variables on the remote host. The client is not closed with the runner.
+func New(client *ssh.Client, options ...bash.Option) (*bash.Bash, error) {
+	return bash.New(append([]bash.Option{bash.WithStarter(Starter(client))}, options...)...)
+}
+
+// Factory returns runner.Factory that creates runners on the remote host of the client.
+// Dirs passed to the factory should exist on the remote host.
+func Factory(client *ssh.Client) runner.Factory {
+	return func(dir string, env ...string) (runner.Runner, error) {
+		b, err := New(client, bash.WithDir(dir), bash.WithEnv(env))
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+// command returns the remote command that starts the shell
+func command(shell bash.Shell, dir string, env []string) string {
+	var sb strings.Builder
+	if dir != "" {
+		sb.WriteString("cd " + bash.Quote(dir) + " && ")
+	}
+	sb.WriteString("exec ")
+	if len(env) > 0 {
+		sb.WriteString("env")
+		for _, e := range env {
+			sb.WriteString(" " + bash.Quote(e))
+		}
+		sb.WriteString(" ")
+	}
+	sb.WriteString(bash.Quote(shell.Path))
+	for _, arg := range shell.Args {
+		sb.WriteString(" " + bash.Quote(arg))
+	}
+	return sb.String()
+}
+
+// process is a shell process on the remote host
+type process struct {
+	session *ssh.Session
+	stdin   io.Writer
+	stdout  io.Reader
+	stderr  io.Reader
+}
+
+func (p *process) Stdin() io.Writer {
+	return p.stdin
+}
+
+func (p *process) Stdout() io.Reader {
+	return p.stdout
+}
+
+func (p *process) Stderr() io.Reader {
+	return p.stderr
+}
+
+func (p *process) Wait() error {
+	err := p.session.Wait()
+	_ = p.session.Close()
+	return err
+}
+
+// Kill kills the remote process if the server supports signals and closes the session
+func (p *process) Kill() error {
+	_ = p.session.Signal(ssh.SIGKILL)
+	return p.session.Close()
+}
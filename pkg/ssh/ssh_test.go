@@ -0,0 +1,145 @@
+// Copyright (c) 2023 Cisco and/or its affiliates.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os/exec"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	gotestmdssh "github.com/networkservicemesh/gotestmd/pkg/ssh"
+)
+
+// startServer starts a ssh server that runs exec requests with local bash. Returns the client and a func that drops the connection
+func startServer(t *testing.T) (client *ssh.Client, drop func()) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	connCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		connCh <- conn
+		serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		defer func() { _ = serverConn.Close() }()
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			go serveSession(channel, channelRequests)
+		}
+	}()
+
+	client, err = ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		//nolint:gosec
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	conn := <-connCh
+	return client, func() { _ = conn.Close() }
+}
+
+func serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	for r := range requests {
+		if r.Type != "exec" {
+			_ = r.Reply(false, nil)
+			continue
+		}
+		length := binary.BigEndian.Uint32(r.Payload)
+		//nolint:gosec
+		cmd := exec.Command("bash", "-c", string(r.Payload[4:4+length]))
+		cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+		// stdin is copied separately, because the channel is not closed when the process exits
+		stdin, err := cmd.StdinPipe()
+		if err != nil || cmd.Start() != nil {
+			_ = r.Reply(false, nil)
+			continue
+		}
+		go func() {
+			_, _ = io.Copy(stdin, channel)
+		}()
+		_ = r.Reply(true, nil)
+		go func() {
+			_ = cmd.Wait()
+			status := make([]byte, 4)
+			binary.BigEndian.PutUint32(status, uint32(cmd.ProcessState.ExitCode()))
+			_, _ = channel.SendRequest("exit-status", false, status)
+			_ = channel.Close()
+		}()
+	}
+}
+
+func TestSSHRunner(t *testing.T) {
+	client, _ := startServer(t)
+	dir := t.TempDir()
+
+	runner, err := gotestmdssh.New(client, bash.WithDir(dir), bash.WithEnv([]string{"A=it's"}))
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, _, exitCode, err := runner.Run("B=works")
+	require.NoError(t, err)
+	require.Zero(t, exitCode)
+
+	stdout, stderr, exitCode, err := runner.Run(`echo "$A $B in $(pwd)"; echo error >&2; false`)
+	require.NoError(t, err)
+	require.Equal(t, 1, exitCode)
+	require.Equal(t, "it's works in "+dir, stdout)
+	require.Equal(t, "error", stderr)
+}
+
+func TestSSHConnectionLoss(t *testing.T) {
+	client, drop := startServer(t)
+
+	runner, err := gotestmdssh.New(client)
+	require.NoError(t, err)
+	defer runner.Close()
+
+	_, _, _, err = runner.Run("echo hello")
+	require.NoError(t, err)
+
+	drop()
+	_, _, _, err = runner.Run("echo hello")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, bash.ErrProcessExited), err.Error())
+}
@@ -18,44 +18,148 @@
 package shell
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/networkservicemesh/gotestmd/pkg/bash"
+	"github.com/networkservicemesh/gotestmd/pkg/envfile"
+	"github.com/networkservicemesh/gotestmd/pkg/powershell"
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
 )
 
 var timeoutFlag = flag.Duration("gotestmd.t", time.Minute, "timeout for command execution. Usage: set timeout in duratiom format via shell.timeout flag")
+var summaryFlag = flag.Bool("gotestmd.summary", false, "log durations of the commands of each runner sorted from the slowest when the test finishes")
+var jitterFlag = flag.Duration("gotestmd.jitter", 0, "maximum random delay added to the interval between the retries of a command, "+
+	"so the retries of parallel tests are spread out")
+var jitterSeedFlag = flag.Int64("gotestmd.jitter-seed", 0, "seed of the random delays of the retries, zero means a random seed")
 var once sync.Once
 
+// retryInterval is the interval between the attempts to run a command without jitter
+const retryInterval = time.Millisecond * 100
+
 // Suite is testify suite that provides a shell helper functions for each test.
 type Suite struct {
 	suite.Suite
+	runnerFactory runner.Factory
+	session       runner.Runner
+	// captured are the assignments of the variables captured by the runners of the suite and its tests
+	captured []capturedVar
+}
+
+// capturedVar is an assignment of a variable captured by a runner of the test. The new runners of the test and its subtests
+// run it, e.g. the runners of the tests of a suite run the assignments captured in SetupSuite
+type capturedVar struct {
+	test       string
+	assignment string
 }
 
-// Runner creates runner and sets the passed dir and envs
+// SetRunnerFactory sets the factory of the runners created by Runner. By default Runner uses bash.
+// Can be called in SetupSuite of a base suite, so generated suites run the commands with a custom runner.
+func (s *Suite) SetRunnerFactory(factory runner.Factory) {
+	s.runnerFactory = factory
+}
+
+// Runner creates runner and sets the passed dir and envs. Empty dir means the current dir
 func (s *Suite) Runner(dir string, env ...string) *Runner {
-	result := &Runner{
-		t: s.T(),
+	if s.runnerFactory != nil {
+		return s.runner(s.runnerFactory, dir, env...)
+	}
+	return s.runner(factory(bash.New), dir, env...)
+}
+
+// Session returns a runner of the shell session shared by the suite and its tests, so exported variables and the current dir
+// are kept between the commands, unlike the runners created by Runner. The session is started by the first call, that should be
+// in SetupSuite, and closed when the suite finishes. The later calls change the current dir of the session to the dir,
+// unless it's empty, and export the envs. The current dir and the envs are restored when the test of the call finishes,
+// so the next tests and the cleanup of the suite run in the dir and with the env of the suite
+func (s *Suite) Session(dir string, env ...string) *Runner {
+	if s.session == nil {
+		result := s.Runner(dir, env...)
+		s.session = result.bash
+		s.T().Cleanup(func() {
+			s.session = nil
+		})
+		return result
+	}
+	result := s.attach(s.session)
+	restore := []string{"cd " + bash.Quote(result.Output("pwd"))}
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		restore = append(restore, result.restoreVar(name))
+	}
+	s.T().Cleanup(func() {
+		result.Run(strings.Join(restore, " && "))
+	})
+	if dir != "" {
+		result.Run("cd " + bash.Quote(runner.Resolve(dir)))
+	}
+	for _, e := range env {
+		result.Run("export " + bash.Quote(e))
 	}
-	if !filepath.IsAbs(dir) {
-		dir = filepath.Join(findRoot(), dir)
+	return result
+}
+
+// restoreVar returns a command that restores the current value of the exported variable or unsets it if it's not set
+func (r *Runner) restoreVar(name string) string {
+	// x marks whether the variable is set and keeps the spaces of the value
+	output := r.Output(fmt.Sprintf(`printf '%%s' "${%[1]v+x}${%[1]v}x"`, name))
+	value, ok := strings.CutPrefix(strings.TrimSuffix(output, "x"), "x")
+	if !ok {
+		return "unset " + name
+	}
+	return "export " + bash.Quote(name+"="+value)
+}
+
+// PowerShellRunner creates runner based on PowerShell and sets the passed dir and envs
+func (s *Suite) PowerShellRunner(dir string, env ...string) *Runner {
+	return s.runner(factory(powershell.New), dir, env...)
+}
+
+// factory converts a constructor of bash.Bash based runners to runner.Factory
+func factory(newBash func(options ...bash.Option) (*bash.Bash, error)) runner.Factory {
+	return func(dir string, env ...string) (runner.Runner, error) {
+		b, err := newBash(bash.WithDir(dir), bash.WithEnv(env))
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
 	}
-	b, err := bash.New(bash.WithDir(dir), bash.WithEnv(env))
+}
+
+func (s *Suite) runner(newRunner runner.Factory, dir string, env ...string) *Runner {
+	b, err := newRunner(runner.Resolve(dir), env...)
 	if err != nil {
-		s.FailNowf("can't initialize bash", "%v", err)
+		s.FailNowf("can't initialize shell", "%v", err)
 	}
-	result.bash = b
+	s.T().Cleanup(b.Close)
+	return s.attach(b)
+}
 
+// attach returns a runner of the current test that runs the commands with b
+func (s *Suite) attach(b runner.Runner) *Runner {
+	result := &Runner{
+		t:            s.T(),
+		bash:         b,
+		lastExitCode: -1,
+		captured:     &s.captured,
+	}
 	s.T().Cleanup(func() {
-		result.bash.Close()
+		if *summaryFlag {
+			result.logSummary()
+		}
 	})
 	result.logger = &logrus.Logger{
 		Out:   os.Stderr,
@@ -67,33 +171,133 @@ func (s *Suite) Runner(dir string, env ...string) *Runner {
 	once.Do(func() {
 		flag.Parse()
 	})
+	result.SetRetryJitter(*jitterFlag, *jitterSeedFlag)
+	for _, c := range s.captured {
+		if result.t.Name() == c.test || strings.HasPrefix(result.t.Name(), c.test+"/") {
+			result.Run(c.assignment)
+		}
+	}
 	return result
 }
 
-func findRoot() string {
-	wd, err := os.Getwd()
+// EnvFile reads variables of the env file in KEY=VALUE format. Relative path is resolved like dirs of the runners.
+// If the file doesn't exist, the test fails, or only a warning is logged if missingOK is set
+func (s *Suite) EnvFile(path string, missingOK bool) []string {
+	env, err := envfile.Load(runner.Resolve(path))
+	if os.IsNotExist(errors.Cause(err)) && missingOK {
+		logrus.Warnf("env file %v doesn't exist", path)
+		return nil
+	}
 	if err != nil {
-		logrus.Fatal(err.Error())
+		s.FailNowf("can't load env file", "%v: %v", path, err)
 	}
-	currDir := wd
-	for len(currDir) > 0 {
-		if err != nil {
-			logrus.Fatal(err.Error())
-		}
-		p := filepath.Clean(filepath.Join(currDir, "go.mod"))
-		if _, err := os.Open(p); err == nil {
-			return currDir
-		}
-		currDir = filepath.Dir(currDir)
+	return env
+}
+
+// serialLockFile is locked by the serial suites of all the test processes, e.g. the packages run by go test in parallel
+var serialLockFile = filepath.Join(os.TempDir(), "gotestmd-serial.lock")
+
+// serialMu is held by the serial suite of the process, serialTest is the name of its test
+var serialMu sync.Mutex
+var serialTestMu sync.Mutex
+var serialTest string
+
+// Serial waits until the other serial suites finish, also the suites of the other test processes, and holds them until
+// the suite finishes. It should be called at the beginning of SetupSuite. The suites set up and run by the serial suite,
+// e.g. its required and included suites, don't wait for it. The suites that are not serial are not held
+func (s *Suite) Serial() {
+	t := s.T()
+	serialTestMu.Lock()
+	nested := serialTest != "" && (t.Name() == serialTest || strings.HasPrefix(t.Name(), serialTest+"/"))
+	serialTestMu.Unlock()
+	if nested {
+		return
+	}
+	serialMu.Lock()
+	unlock, err := lockFile(serialLockFile)
+	if err != nil {
+		serialMu.Unlock()
+		s.FailNowf("can't lock the serial suites", "%v: %v", serialLockFile, err)
 	}
-	return ""
+	serialTestMu.Lock()
+	serialTest = t.Name()
+	serialTestMu.Unlock()
+	t.Cleanup(func() {
+		serialTestMu.Lock()
+		serialTest = ""
+		serialTestMu.Unlock()
+		unlock()
+		serialMu.Unlock()
+	})
 }
 
 // Runner is shell runner.
 type Runner struct {
-	t      *testing.T
-	logger *logrus.Logger
-	bash   *bash.Bash
+	t              *testing.T
+	logger         *logrus.Logger
+	bash           runner.Runner
+	commandTimeout time.Duration
+	retryJitter    time.Duration
+	random         *rand.Rand
+	durations      []CommandDuration
+	// lastExitCode is the exit code of the last attempt to run the last command, -1 if it didn't finish
+	lastExitCode int
+	// captured are the assignments of the variables captured by the runners of the suite
+	captured *[]capturedVar
+}
+
+// CommandDuration is the wall-clock duration of a command including all the attempts to run it
+type CommandDuration struct {
+	Cmd      string
+	Duration time.Duration
+}
+
+// Durations returns durations of the commands run by the runner in the order they were run
+func (r *Runner) Durations() []CommandDuration {
+	return r.durations
+}
+
+// logSummary logs durations of the commands sorted from the slowest
+func (r *Runner) logSummary() {
+	durations := append([]CommandDuration{}, r.durations...)
+	sort.SliceStable(durations, func(i, j int) bool {
+		return durations[i].Duration > durations[j].Duration
+	})
+	for _, d := range durations {
+		r.logger.WithField(r.t.Name(), "summary").Infof("%v\t%v", d.Duration, d.Cmd)
+	}
+}
+
+// LastExitCode returns the exit code of the last attempt to run the last command, e.g. to check a specific non-zero status
+// after RunE or TryRun. Returns -1 if no command was run or the last attempt didn't finish
+func (r *Runner) LastExitCode() int {
+	return r.lastExitCode
+}
+
+// SetCommandTimeout sets timeout for a single attempt to run a command. Zero means no timeout.
+// A command that doesn't finish in time fails the test, the runner can't be used after that.
+func (r *Runner) SetCommandTimeout(timeout time.Duration) {
+	r.commandTimeout = timeout
+}
+
+// SetRetryJitter sets the maximum random delay added to the interval between the attempts to run a command, so the retries
+// of parallel tests against a shared resource are spread out. A non-zero seed makes the delays reproducible, zero means a random seed
+func (r *Runner) SetRetryJitter(jitter time.Duration, seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r.retryJitter = jitter
+	// the delays don't need a secure source
+	//nolint:gosec
+	r.random = rand.New(rand.NewSource(seed))
+}
+
+// retryDelay returns the interval before the next attempt to run a command
+func (r *Runner) retryDelay() time.Duration {
+	if r.retryJitter <= 0 {
+		return retryInterval
+	}
+	return retryInterval + time.Duration(r.random.Int63n(int64(r.retryJitter)+1))
 }
 
 // Dir returns the directory where current runner instance is located
@@ -101,18 +305,127 @@ func (r *Runner) Dir() string {
 	return r.bash.Dir()
 }
 
+// Stdin returns a command that runs cmd with stdin as its standard input, e.g. to answer the prompts of the command.
+// Fails the test if the runner doesn't support it
+func (r *Runner) Stdin(cmd, stdin string) string {
+	stdinRunner, ok := r.bash.(runner.StdinRunner)
+	if !ok {
+		r.t.Fatalf("runner %T doesn't support stdin of the commands", r.bash)
+	}
+	result, err := stdinRunner.StdinCommand(cmd, stdin)
+	if err != nil {
+		r.t.Fatal(err.Error())
+	}
+	return result
+}
+
 // Run runs cmd, logs stdin, stdout, stderr
 // Tries to run cmd several times, until it succeeds or timeout passes.
 //
 // Fails the test if the command can't be run successfully.
 func (r *Runner) Run(cmd string) {
+	if err := r.RunE(cmd); err != nil {
+		r.t.Fatal(err.Error())
+	}
+}
+
+// RunE runs cmd like Run, but returns an error instead of failing the test if the command can't be run successfully
+func (r *Runner) RunE(cmd string) error {
+	_, err := r.OutputE(cmd)
+	return err
+}
+
+// Output runs cmd like Run and returns stdout of the successful run
+func (r *Runner) Output(cmd string) string {
+	stdout, err := r.OutputE(cmd)
+	if err != nil {
+		r.t.Fatal(err.Error())
+	}
+	return stdout
+}
+
+// Capture assigns the value, e.g. the output of a command, to the shell variable in the runner. The runners created by the suite
+// later for the same test assign it too. A variable captured in SetupSuite is assigned by the runners of all the tests of the suite,
+// so their commands can use it, and a variable captured by a test is not assigned by the runners of the other tests
+func (r *Runner) Capture(name, value string) {
+	assignment := name + "=" + bash.Quote(value)
+	if r.captured != nil {
+		*r.captured = append(*r.captured, capturedVar{test: r.t.Name(), assignment: assignment})
+	}
+	r.Run(assignment)
+}
+
+// TryRun runs cmd once and returns true if it succeeds. Unlike Run, the command is not retried and its failure is only logged,
+// so it's used for best-effort commands, e.g. removing resources that may be already removed
+func (r *Runner) TryRun(cmd string) bool {
+	defer r.trackDuration(cmd, time.Now())
+	r.logger.WithField(r.t.Name(), "stdin").Info(cmd)
+	stdout, stderr, exitCode, err := r.runOnce(cmd)
+	if stdout != "" {
+		r.logger.WithField(r.t.Name(), "stdout").Info(stdout)
+	}
+	if stderr != "" {
+		r.logger.WithField(r.t.Name(), "stderr").Info(stderr)
+	}
+	if err != nil {
+		r.logger.WithField(r.t.Name(), "allowed to fail").Warnf("can't run command %q: %v", cmd, err)
+		return false
+	}
+	if exitCode != 0 {
+		r.logger.WithField(r.t.Name(), "allowed to fail").Warnf("command %q failed with exit code %v", cmd, exitCode)
+		return false
+	}
+	return true
+}
+
+// OutputE runs cmd like Output, but returns an error instead of failing the test if the command can't be run successfully
+func (r *Runner) OutputE(cmd string) (string, error) {
+	return r.runUntil(cmd, "succeed", func(exitCode int) (bool, error) {
+		return exitCode == 0, nil
+	})
+}
+
+// RunFail runs cmd like Run, but expects it to fail: the command is retried until it exits with non-zero code,
+// or with the exitCode if it's positive. Fails the test if the command doesn't fail as expected until timeout passes
+// or if it succeeds, a success is not retried
+func (r *Runner) RunFail(cmd string, exitCode int) {
+	if err := r.RunFailE(cmd, exitCode); err != nil {
+		r.t.Fatal(err.Error())
+	}
+}
+
+// RunFailE runs cmd like RunFail, but returns an error instead of failing the test
+func (r *Runner) RunFailE(cmd string, exitCode int) error {
+	expectation, expected := "fail", func(code int) bool {
+		return code != 0
+	}
+	if exitCode > 0 {
+		expectation, expected = fmt.Sprintf("fail with exit code %v", exitCode), func(code int) bool {
+			return code == exitCode
+		}
+	}
+	_, err := r.runUntil(cmd, expectation, func(code int) (bool, error) {
+		if code == 0 {
+			return false, errors.Errorf("command %q succeeded, but it's expected to %v", cmd, expectation)
+		}
+		return expected(code), nil
+	})
+	return err
+}
+
+// runUntil runs cmd until its exit code is expected or timeout passes. Returns stdout of the last run.
+// The expectation describes the expected exit code in the errors. The command is not retried if expected returns an error
+func (r *Runner) runUntil(cmd, expectation string, expected func(exitCode int) (bool, error)) (string, error) {
+	defer r.trackDuration(cmd, time.Now())
 	timeoutCh := time.After(*timeoutFlag)
 	for {
 		r.logger.WithField(r.t.Name(), "stdin").Info(cmd)
-		stdout, stderr, exitCode, err := r.bash.Run(cmd)
+		stdout, stderr, exitCode, err := r.runOnce(cmd)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", errors.Errorf("command %q didn't finish in %v", cmd, r.commandTimeout)
+		}
 		if err != nil {
-			r.logger.Fatalf("can't run command: %v", err)
-			r.t.FailNow()
+			return "", errors.Wrapf(err, "can't run command %q", cmd)
 		}
 		if stdout != "" {
 			r.logger.WithField(r.t.Name(), "stdout").Info(stdout)
@@ -120,16 +433,43 @@ func (r *Runner) Run(cmd string) {
 		if stderr != "" {
 			r.logger.WithField(r.t.Name(), "stderr").Info(stderr)
 		}
-		if exitCode == 0 {
-			return
+		if exitCode != 0 {
+			r.logger.WithField(r.t.Name(), "exitCode").Info(exitCode)
+		}
+		ok, err := expected(exitCode)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return stdout, nil
 		}
-		r.logger.WithField(r.t.Name(), "exitCode").Info(exitCode)
 		select {
 		case <-timeoutCh:
-			r.logger.WithField("cmd", cmd).Error("command didn't succeed until timeout")
-			require.Equal(r.t, 0, exitCode)
+			return "", errors.Errorf("command %q didn't %v until timeout, last exit code: %v, stderr: %v", cmd, expectation, exitCode, stderr)
 		default:
-			time.Sleep(time.Millisecond * 100)
+			time.Sleep(r.retryDelay())
+		}
+	}
+}
+
+// trackDuration records and logs the duration of the command started at the start time
+func (r *Runner) trackDuration(cmd string, start time.Time) {
+	d := time.Since(start)
+	r.durations = append(r.durations, CommandDuration{Cmd: cmd, Duration: d})
+	r.logger.WithField(r.t.Name(), "duration").Info(d)
+}
+
+func (r *Runner) runOnce(cmd string) (stdout, stderr string, exitCode int, err error) {
+	defer func() {
+		r.lastExitCode = exitCode
+		if err != nil {
+			r.lastExitCode = -1
 		}
+	}()
+	if r.commandTimeout == 0 {
+		return r.bash.Run(cmd)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.commandTimeout)
+	defer cancel()
+	return r.bash.RunContext(ctx, cmd)
 }
@@ -19,13 +19,21 @@
 package shell_test
 
 import (
+	"context"
+	"flag"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
 	"go.uber.org/goleak"
 
+	"github.com/networkservicemesh/gotestmd/pkg/runner"
 	"github.com/networkservicemesh/gotestmd/pkg/suites/shell"
 )
 
@@ -47,6 +55,36 @@ func TestShellFirstTry(t *testing.T) {
 	require.Equal(t, fileContent+"\n", string(bytes))
 }
 
+func TestShellOutput(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	require.Equal(t, "hello", strings.TrimRight(r.Output("echo hello"), "\n"))
+}
+
+func TestShellStdin(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	require.Equal(t, "yes", strings.TrimRight(r.Output(r.Stdin("read -r answer && echo $answer", "yes")), "\n"))
+}
+
+func TestShellStderrWithSuccess(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	require.NoError(t, r.RunE("echo warn >&2; true"))
+}
+
 func TestShellEventually(t *testing.T) {
 	t.Cleanup(func() { goleak.VerifyNone(t) })
 
@@ -69,3 +107,255 @@ fi`)
 	require.NoError(t, err)
 	require.Equal(t, "1\n11\n111\n", string(bytes))
 }
+
+type fakeRunner struct {
+	dir  string
+	cmds []string
+}
+
+func (r *fakeRunner) Run(cmd string) (stdout, stderr string, exitCode int, err error) {
+	r.cmds = append(r.cmds, cmd)
+	return "", "", 0, nil
+}
+
+func (r *fakeRunner) RunContext(_ context.Context, cmd string) (stdout, stderr string, exitCode int, err error) {
+	return r.Run(cmd)
+}
+
+func (r *fakeRunner) Dir() string {
+	return r.dir
+}
+
+func (r *fakeRunner) Close() {}
+
+func TestShellRunnerFactory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var created *fakeRunner
+	suite := shell.Suite{}
+	suite.SetT(t)
+	suite.SetRunnerFactory(func(dir string, env ...string) (runner.Runner, error) {
+		created = &fakeRunner{dir: dir}
+		return created, nil
+	})
+	r := suite.Runner(tempDir)
+	r.Run("echo hello")
+
+	require.Equal(t, tempDir, r.Dir())
+	require.Equal(t, []string{"echo hello"}, created.cmds)
+}
+
+func TestShellDurations(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	r.Run("true")
+	r.Run("sleep 0.2")
+
+	durations := r.Durations()
+	require.Len(t, durations, 2)
+	require.Equal(t, "true", durations[0].Cmd)
+	require.Equal(t, "sleep 0.2", durations[1].Cmd)
+	require.True(t, durations[1].Duration >= 200*time.Millisecond)
+}
+
+func TestShellTryRun(t *testing.T) {
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	require.True(t, r.TryRun("true"))
+	require.False(t, r.TryRun("false"))
+	require.Len(t, r.Durations(), 2)
+}
+
+func TestShellRetryJitter(t *testing.T) {
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	// the delays of the runner are the same as the delays of the same seed
+	const jitter = 300 * time.Millisecond
+	r.SetRetryJitter(jitter, 42)
+	random := rand.New(rand.NewSource(42)) //nolint:gosec
+	expected := 200 * time.Millisecond
+	for i := 0; i < 2; i++ {
+		expected += time.Duration(random.Int63n(int64(jitter) + 1))
+	}
+	r.Run("[ -f second ] && touch third; [ -f first ] && touch second; touch first; [ -f third ]")
+	require.Len(t, r.Durations(), 1)
+	require.True(t, r.Durations()[0].Duration >= expected, "%v < %v", r.Durations()[0].Duration, expected)
+}
+
+func TestShellRunFail(t *testing.T) {
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	r.RunFail("false", 0)
+	r.RunFail("$(exit 3)", 3)
+	require.Equal(t, 3, r.LastExitCode())
+	require.NoError(t, r.RunFailE("[ -d missing ]", 0))
+
+	// a success is not retried until timeout
+	start := time.Now()
+	err := r.RunFailE("true", 3)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `command "true" succeeded, but it's expected to fail with exit code 3`)
+	require.True(t, time.Since(start) < time.Second, time.Since(start))
+}
+
+func TestShellFailureMessage(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	timeout := flag.Lookup("gotestmd.t").Value.String()
+	require.NoError(t, flag.Set("gotestmd.t", "300ms"))
+	t.Cleanup(func() { _ = flag.Set("gotestmd.t", timeout) })
+
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	err := r.RunE("echo 'error validating x' >&2; (exit 2)")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `command "echo 'error validating x' >&2; (exit 2)" didn't succeed until timeout`)
+	require.Contains(t, err.Error(), "last exit code: 2, stderr: error validating x")
+}
+
+type sessionSuite struct {
+	shell.Suite
+	dir string
+}
+
+func (s *sessionSuite) SetupSuite() {
+	r := s.Session(s.dir)
+	r.Run("export GREETING=hello && mkdir nested")
+	s.T().Cleanup(func() {
+		r.Run(`echo "$PWD ${NAME-unset}" >` + filepath.Join(s.dir, "cleanup"))
+	})
+}
+
+// the tests are run in the order of their names, the dir and the env of the previous test are restored
+func (s *sessionSuite) Test1ExportedVariable() {
+	r := s.Session(filepath.Join(s.dir, "nested"), "NAME=first")
+	s.Equal("hello", strings.TrimRight(r.Output("echo $GREETING"), "\n"))
+	s.Equal("first", strings.TrimRight(r.Output("echo $NAME"), "\n"))
+	r.Run("cd ..")
+}
+
+func (s *sessionSuite) Test2DirAndEnv() {
+	r := s.Session("")
+	s.Equal(s.dir, strings.TrimRight(r.Output("pwd"), "\n"))
+	s.Equal("unset", strings.TrimRight(r.Output("echo ${NAME-unset}"), "\n"))
+
+	nested := filepath.Join(s.dir, "nested")
+	r = s.Session(nested, "NAME=it's")
+	s.Equal(nested, strings.TrimRight(r.Output("pwd"), "\n"))
+	s.Equal("it's", strings.TrimRight(r.Output("echo $NAME"), "\n"))
+}
+
+func TestShellSession(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	dir := t.TempDir()
+	t.Run("suite", func(t *testing.T) {
+		suite.Run(t, &sessionSuite{dir: dir})
+	})
+
+	// the cleanup of the suite runs in the dir and with the env of the suite
+	bytes, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "cleanup")))
+	require.NoError(t, err)
+	require.Equal(t, dir+" unset\n", string(bytes))
+}
+
+func TestShellLastExitCode(t *testing.T) {
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	require.Equal(t, -1, r.LastExitCode())
+	require.False(t, r.TryRun("$(exit 7)"))
+	require.Equal(t, 7, r.LastExitCode())
+	r.Run("true")
+	require.Zero(t, r.LastExitCode())
+}
+
+func TestShellCapture(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	suite := shell.Suite{}
+	suite.SetT(t)
+	r := suite.Runner(t.TempDir())
+
+	r.Capture("NAME", r.Output("echo \"it's captured\""))
+	require.Equal(t, "it's captured", strings.TrimRight(r.Output("echo $NAME"), "\n"))
+	require.Equal(t, "it's captured", strings.TrimRight(suite.Runner(t.TempDir()).Output("echo $NAME"), "\n"))
+}
+
+type captureSuite struct {
+	shell.Suite
+}
+
+func (s *captureSuite) SetupSuite() {
+	s.Runner("").Capture("SUITE", "captured by the suite")
+}
+
+// the tests are run in the order of their names
+func (s *captureSuite) Test1Capture() {
+	r := s.Runner("")
+	s.Equal("captured by the suite", strings.TrimRight(r.Output("echo $SUITE"), "\n"))
+	r.Capture("TEST", "captured by the test")
+	s.Equal("captured by the test", strings.TrimRight(s.Runner("").Output("echo $TEST"), "\n"))
+}
+
+func (s *captureSuite) Test2Sibling() {
+	r := s.Runner("")
+	s.Equal("captured by the suite", strings.TrimRight(r.Output("echo $SUITE"), "\n"))
+	s.Equal("unset", strings.TrimRight(r.Output("echo ${TEST-unset}"), "\n"))
+}
+
+func TestShellCaptureScope(t *testing.T) {
+	t.Cleanup(func() { goleak.VerifyNone(t) })
+
+	suite.Run(t, new(captureSuite))
+}
+
+func TestShellSerial(t *testing.T) {
+	var running, maxRunning int32
+	var mu sync.Mutex
+	for _, name := range []string{"first", "second", "third"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := shell.Suite{}
+			s.SetT(t)
+			s.Serial()
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			// the suites run by the serial suite don't wait for it
+			t.Run("included", func(t *testing.T) {
+				included := shell.Suite{}
+				included.SetT(t)
+				included.Serial()
+			})
+			// the serial suites of the other processes wait for it
+			r := s.Runner(t.TempDir())
+			r.RunFail("flock --nonblock "+filepath.Join(os.TempDir(), "gotestmd-serial.lock")+" true", 1)
+
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	t.Cleanup(func() {
+		require.Equal(t, int32(1), maxRunning)
+	})
+}